@@ -0,0 +1,86 @@
+package acme
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// caaCritical is the issuer critical flag of a CAA record (RFC 6844, section 5.1).
+const caaCritical = 128
+
+// CheckCAA looks up the CAA records relevant for domain and returns an error
+// if they do not allow the CA identified by caaIdentity, e.g.
+// "letsencrypt.org", to issue a certificate for it. Following RFC 6844, the
+// relevant records are the first non-empty CAA RRset found when walking up
+// from domain towards the root. Without any CAA records every CA may issue.
+func CheckCAA(domain, caaIdentity string) error {
+	wildcard := strings.HasPrefix(domain, "*.")
+	fqdn := dns.Fqdn(strings.TrimPrefix(domain, "*."))
+
+	for _, index := range dns.Split(fqdn) {
+		name := fqdn[index:]
+
+		r, err := dnsQuery(name, dns.TypeCAA, RecursiveNameservers, true)
+		if err != nil {
+			return err
+		}
+
+		if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+			return fmt.Errorf("Could not look up CAA records for %s: %s", name, dns.RcodeToString[r.Rcode])
+		}
+
+		var caas []*dns.CAA
+		for _, rr := range r.Answer {
+			if caa, ok := rr.(*dns.CAA); ok {
+				caas = append(caas, caa)
+			}
+		}
+
+		if len(caas) > 0 {
+			return checkCAASet(domain, name, caaIdentity, caas, wildcard)
+		}
+	}
+
+	return nil
+}
+
+// checkCAASet evaluates the relevant CAA RRset found at name for domain.
+func checkCAASet(domain, name, caaIdentity string, caas []*dns.CAA, wildcard bool) error {
+	var issue, issuewild []string
+	for _, caa := range caas {
+		switch strings.ToLower(caa.Tag) {
+		case "issue":
+			issue = append(issue, caa.Value)
+		case "issuewild":
+			issuewild = append(issuewild, caa.Value)
+		case "iodef":
+		default:
+			if caa.Flag&caaCritical != 0 {
+				return fmt.Errorf("CAA record at %s has an unknown critical property %q, issuance for %s is forbidden", name, caa.Tag, domain)
+			}
+		}
+	}
+
+	// For wildcard names issuewild takes precedence over issue, if present.
+	values := issue
+	if wildcard && len(issuewild) > 0 {
+		values = issuewild
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	for _, value := range values {
+		issuer := value
+		if i := strings.Index(value, ";"); i >= 0 {
+			issuer = value[:i]
+		}
+		if strings.EqualFold(strings.TrimSpace(issuer), caaIdentity) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("CAA records at %s do not allow %s to issue certificates for %s", name, caaIdentity, domain)
+}
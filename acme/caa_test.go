@@ -0,0 +1,121 @@
+package acme
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+var caaTestRecords = map[string][]*dns.CAA{
+	"permissive.example.com.": {
+		{Tag: "issue", Value: "letsencrypt.org"},
+		{Tag: "iodef", Value: "mailto:security@example.com"},
+	},
+	"forbidding.example.com.": {{Tag: "issue", Value: "ca.example.net; account=1234"}},
+	"nobody.example.com.":     {{Tag: "issue", Value: ";"}},
+	"iodef.example.com.":      {{Tag: "iodef", Value: "mailto:security@example.com"}},
+	"critical.example.com.":   {{Flag: caaCritical, Tag: "tbs", Value: "unknown"}, {Tag: "issue", Value: "letsencrypt.org"}},
+	"wild.example.com.": {
+		{Tag: "issue", Value: "letsencrypt.org"},
+		{Tag: "issuewild", Value: "ca.example.net"},
+	},
+}
+
+// serverHandlerCAA answers CAA queries from caaTestRecords. Names below
+// example.com. without records do not exist.
+func serverHandlerCAA(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	name := req.Question[0].Name
+	caas, ok := caaTestRecords[name]
+	switch {
+	case ok && req.Question[0].Qtype == dns.TypeCAA:
+		for _, caa := range caas {
+			rr := *caa
+			rr.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 300}
+			m.Answer = append(m.Answer, &rr)
+		}
+	case !ok && name != "example.com." && !strings.HasSuffix(name, ".permissive.example.com."):
+		m.Rcode = dns.RcodeNameError
+	}
+
+	w.WriteMsg(m)
+}
+
+// serverHandlerNoCAA answers every query with an empty response.
+func serverHandlerNoCAA(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	w.WriteMsg(m)
+}
+
+func TestCheckCAA(t *testing.T) {
+	dns.HandleFunc("example.com.", serverHandlerCAA)
+	defer dns.HandleRemove("example.com.")
+	dns.HandleFunc("com.", serverHandlerNoCAA)
+	defer dns.HandleRemove("com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	defer func(nss []string) { RecursiveNameservers = nss }(RecursiveNameservers)
+	RecursiveNameservers = []string{addrstr}
+
+	tests := []struct {
+		domain  string
+		allowed bool
+	}{
+		{"permissive.example.com", true},
+		{"www.permissive.example.com", true},
+		{"absent.example.com", true},
+		{"iodef.example.com", true},
+		{"forbidding.example.com", false},
+		{"nobody.example.com", false},
+		{"critical.example.com", false},
+		{"wild.example.com", true},
+		{"*.wild.example.com", false},
+		{"*.permissive.example.com", true},
+	}
+	for _, tt := range tests {
+		err := CheckCAA(tt.domain, "letsencrypt.org")
+		if tt.allowed && err != nil {
+			t.Errorf("CheckCAA(%q): expected issuance to be allowed but got %v", tt.domain, err)
+		}
+		if !tt.allowed && err == nil {
+			t.Errorf("CheckCAA(%q): expected issuance to be forbidden", tt.domain)
+		}
+	}
+
+	if err := CheckCAA("forbidding.example.com", "ca.example.net"); err != nil {
+		t.Errorf("CheckCAA: expected the issuer with parameters to be allowed but got %v", err)
+	}
+}
+
+func TestObtainCertificateChecksCAA(t *testing.T) {
+	dns.HandleFunc("example.com.", serverHandlerCAA)
+	defer dns.HandleRemove("example.com.")
+	dns.HandleFunc("com.", serverHandlerNoCAA)
+	defer dns.HandleRemove("com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	defer func(nss []string) { RecursiveNameservers = nss }(RecursiveNameservers)
+	RecursiveNameservers = []string{addrstr}
+
+	client := &Client{}
+	client.SetCAAIdentity("letsencrypt.org")
+
+	_, failures := client.ObtainCertificate([]string{"forbidding.example.com"}, false, nil)
+	if err := failures["forbidding.example.com"]; err == nil || !strings.Contains(err.Error(), "do not allow letsencrypt.org") {
+		t.Errorf("Expected ObtainCertificate to fail on the CAA check but got %v", err)
+	}
+}
@@ -1,5 +1,10 @@
 package acme
 
+import (
+	"errors"
+	"strings"
+)
+
 type Challenge string
 
 const (
@@ -9,7 +14,45 @@ const (
 	// TLSSNI01 is the "tls-sni-01" ACME challenge https://github.com/ietf-wg-acme/acme/blob/master/draft-ietf-acme-acme.md#tls-with-server-name-indication-tls-sni
 	// Note: TLSSNI01ChallengeCert returns a certificate to fulfill this challenge
 	TLSSNI01 = Challenge("tls-sni-01")
+	// TLSALPN01 is the "tls-alpn-01" ACME challenge https://tools.ietf.org/html/rfc8737
+	// Note: TLSALPN01ChallengeCert returns a certificate to fulfill this challenge
+	TLSALPN01 = Challenge("tls-alpn-01")
 	// DNS01 is the "dns-01" ACME challenge https://github.com/ietf-wg-acme/acme/blob/master/draft-ietf-acme-acme.md#dns
 	// Note: DNS01Record returns a DNS record which will fulfill this challenge
 	DNS01 = Challenge("dns-01")
 )
+
+// ChallengeSelector decides which of the challenge types offered for a
+// domain the client attempts. available holds the offered types the client
+// has a solver for, in the order the server offered them; Select must return
+// one of them or an error if none is acceptable. If the server only offers
+// the selected type together with challenges the client cannot solve, the
+// client falls back to the first combination it can solve.
+type ChallengeSelector interface {
+	Select(domain string, available []Challenge) (Challenge, error)
+}
+
+// DefaultChallengeSelector is the ChallengeSelector used unless another one
+// is set. It prefers dns-01 for wildcard domains, which cannot be validated
+// any other way, and http-01 for all other domains. If the preferred type is
+// not available, the first available one is used.
+type DefaultChallengeSelector struct{}
+
+// Select implements ChallengeSelector.
+func (DefaultChallengeSelector) Select(domain string, available []Challenge) (Challenge, error) {
+	if len(available) == 0 {
+		return "", errors.New("No challenge types available")
+	}
+
+	preferred := HTTP01
+	if strings.HasPrefix(domain, "*.") {
+		preferred = DNS01
+	}
+
+	for _, chlng := range available {
+		if chlng == preferred {
+			return chlng, nil
+		}
+	}
+	return available[0], nil
+}
@@ -1,8 +1,10 @@
 package acme
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -11,12 +13,37 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// defaultDNSConcurrency is the number of dns-01 challenges solved at the same time.
+const defaultDNSConcurrency = 6
+
+// authorizationTimeout is how long to wait for a solved authorization to become valid.
+const authorizationTimeout = 60 * time.Second
+
+const (
+	// defaultOrderPollInterval is the wait between two polls for a requested
+	// certificate if the server sends no Retry-After.
+	defaultOrderPollInterval = time.Second
+	// defaultOrderTimeout is how long to wait for a requested certificate to
+	// be issued.
+	defaultOrderTimeout = 5 * time.Minute
+)
+
+var (
+	// pollInitialInterval is the first wait between two authorization polls.
+	pollInitialInterval = time.Second
+	// pollMaxInterval caps the exponential backoff of authorization polls.
+	pollMaxInterval = 16 * time.Second
+)
+
 var (
 	// Logger is an optional custom logger.
 	Logger *log.Logger
@@ -49,18 +76,50 @@ type validateFunc func(j *jws, domain, uri string, chlng challenge) error
 
 // Client is the user-friendy way to ACME
 type Client struct {
-	directory  directory
-	user       User
-	jws        *jws
-	keyBits    int
-	issuerCert []byte
-	solvers    map[Challenge]solver
+	directory     directory
+	user          User
+	jws           *jws
+	keyBits       int
+	issuerCert    []byte
+	issuerCertURL string
+	solvers       map[Challenge]solver
+
+	dnsConcurrency    int
+	caaIdentity       string
+	selector          ChallengeSelector
+	orderPollInterval time.Duration
+	orderTimeout      time.Duration
+}
+
+// ClientOption configures a Client before NewClient or NewClientWithAccount
+// fetch the directory.
+type ClientOption func(c *Client)
+
+// WithHTTPClient makes the client send all requests to the ACME server with
+// httpClient, e.g. one with a proxy or timeouts of its own. Requests to DNS
+// provider APIs are not affected.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.jws.setHTTPClient(func(*http.Client) *http.Client { return httpClient })
+	}
+}
+
+// WithCACertificates is like Client.SetCACertificates, but also applies to
+// the directory request of NewClient.
+func WithCACertificates(pool *x509.CertPool) ClientOption {
+	return func(c *Client) { c.SetCACertificates(pool) }
+}
+
+// WithInsecureSkipVerify is like Client.SetInsecureSkipVerify, but also
+// applies to the directory request of NewClient.
+func WithInsecureSkipVerify(skip bool) ClientOption {
+	return func(c *Client) { c.SetInsecureSkipVerify(skip) }
 }
 
 // NewClient creates a new ACME client on behalf of the user. The client will depend on
 // the ACME directory located at caDirURL for the rest of its actions. It will
 // generate private keys for certificates of size keyBits.
-func NewClient(caDirURL string, user User, keyBits int) (*Client, error) {
+func NewClient(caDirURL string, user User, keyBits int, opts ...ClientOption) (*Client, error) {
 	privKey := user.GetPrivateKey()
 	if privKey == nil {
 		return nil, errors.New("private key was nil")
@@ -70,9 +129,15 @@ func NewClient(caDirURL string, user User, keyBits int) (*Client, error) {
 		return nil, fmt.Errorf("invalid private key: %v", err)
 	}
 
+	jws := &jws{privKey: privKey, directoryURL: caDirURL}
+	c := &Client{user: user, jws: jws, keyBits: keyBits, dnsConcurrency: defaultDNSConcurrency}
+	for _, opt := range opts {
+		opt(c)
+	}
+
 	var dir directory
-	if _, err := getJSON(caDirURL, &dir); err != nil {
-		return nil, fmt.Errorf("get directory at '%s': %v", caDirURL, err)
+	if _, err := getJSON(jws.httpClient(), caDirURL, &dir); err != nil {
+		return nil, directoryError{url: caDirURL, err: err}
 	}
 
 	if dir.NewRegURL == "" {
@@ -87,8 +152,9 @@ func NewClient(caDirURL string, user User, keyBits int) (*Client, error) {
 	if dir.RevokeCertURL == "" {
 		return nil, errors.New("directory missing revoke certificate URL")
 	}
+	c.directory = dir
 
-	jws := &jws{privKey: privKey, directoryURL: caDirURL}
+	jws.nonceURL = dir.NewNonceURL
 
 	// REVIEW: best possibility?
 	// Add all available solvers with the right index as per ACME
@@ -96,17 +162,106 @@ func NewClient(caDirURL string, user User, keyBits int) (*Client, error) {
 	solvers := make(map[Challenge]solver)
 	solvers[HTTP01] = &httpChallenge{jws: jws, validate: validate}
 	solvers[TLSSNI01] = &tlsSNIChallenge{jws: jws, validate: validate}
+	c.solvers = solvers
+
+	return c, nil
+}
+
+// NewClientWithAccount creates a client for an account registered earlier,
+// identified by its URL, e.g. the URI of a saved RegistrationResource, and
+// its key. Nothing is registered; instead the account is fetched from the
+// server, which also checks that key belongs to it. The User of the client
+// is built from the fetched registration. Only RSA keys are supported.
+func NewClientWithAccount(caDirURL string, key crypto.Signer, accountURL string, keyBits int, opts ...ClientOption) (*Client, error) {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("acme: Unsupported account key type %T", key)
+	}
+	if accountURL == "" {
+		return nil, errors.New("acme: No account URL given")
+	}
+
+	user := &accountUser{key: rsaKey}
+	client, err := NewClient(caDirURL, user, keyBits, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := client.fetchAccount(accountURL)
+	if err != nil {
+		return nil, err
+	}
+	user.reg = reg
+	for _, contact := range reg.Body.Contact {
+		if strings.HasPrefix(contact, "mailto:") {
+			user.email = strings.TrimPrefix(contact, "mailto:")
+			break
+		}
+	}
+
+	logf("[INFO] acme: Using existing account %s", accountURL)
+	return client, nil
+}
+
+// accountUser is the User of a client created by NewClientWithAccount.
+type accountUser struct {
+	email string
+	reg   *RegistrationResource
+	key   *rsa.PrivateKey
+}
+
+func (u *accountUser) GetEmail() string                       { return u.email }
+func (u *accountUser) GetRegistration() *RegistrationResource { return u.reg }
+func (u *accountUser) GetPrivateKey() *rsa.PrivateKey         { return u.key }
+
+// fetchAccount gets the registration at accountURL, which must belong to the
+// key of the client.
+func (c *Client) fetchAccount(accountURL string) (*RegistrationResource, error) {
+	var serverReg Registration
+	hdr, err := postJSON(c.jws, accountURL, accountQueryMessage{Resource: "reg"}, &serverReg)
+	if err != nil {
+		remoteErr, ok := err.(RemoteError)
+		if !ok || (remoteErr.StatusCode != http.StatusForbidden && remoteErr.StatusCode != http.StatusUnauthorized) {
+			return nil, err
+		}
+		if strings.Contains(remoteErr.Detail, accountDeactivated) {
+			return nil, errAccountDeactivated
+		}
+		return nil, fmt.Errorf("acme: The key does not belong to the account %s: %v", accountURL, err)
+	}
+
+	// Servers may ignore the signing key when looking up the account, so
+	// compare it with the key of the account.
+	pub := c.jws.key().PublicKey
+	if serverReg.Key.N != "" && strings.TrimRight(serverReg.Key.N, "=") != base64.RawURLEncoding.EncodeToString(pub.N.Bytes()) {
+		return nil, fmt.Errorf("acme: The key does not belong to the account %s", accountURL)
+	}
+	if serverReg.Status == accountDeactivated {
+		return nil, errAccountDeactivated
+	}
+
+	reg := &RegistrationResource{Body: serverReg, URI: accountURL}
+	links := parseLinks(hdr["Link"])
+	reg.TosURL = links["terms-of-service"]
+	reg.NewAuthzURL = links["next"]
+	if reg.NewAuthzURL == "" {
+		reg.NewAuthzURL = c.directory.NewAuthzURL
+	}
 
-	return &Client{directory: dir, user: user, jws: jws, keyBits: keyBits, solvers: solvers}, nil
+	return reg, nil
 }
 
-// SetChallengeProvider specifies a custom provider that will make the solution available
+// SetChallengeProvider specifies a custom provider that will make the solution available.
+// tls-alpn-01 is only attempted once it has been enabled this way, e.g. with
+// NewTLSALPNProviderServer.
 func (c *Client) SetChallengeProvider(challenge Challenge, p ChallengeProvider) error {
 	switch challenge {
 	case HTTP01:
 		c.solvers[challenge] = &httpChallenge{jws: c.jws, validate: validate, provider: p}
 	case TLSSNI01:
 		c.solvers[challenge] = &tlsSNIChallenge{jws: c.jws, validate: validate, provider: p}
+	case TLSALPN01:
+		c.solvers[challenge] = &tlsALPNChallenge{jws: c.jws, validate: validate, provider: p}
 	case DNS01:
 		c.solvers[challenge] = &dnsChallenge{jws: c.jws, validate: validate, provider: p}
 	default:
@@ -125,7 +280,7 @@ func (c *Client) SetHTTPAddress(iface string) error {
 	}
 
 	if chlng, ok := c.solvers[HTTP01]; ok {
-		chlng.(*httpChallenge).provider = &httpChallengeServer{iface: host, port: port}
+		chlng.(*httpChallenge).provider = NewHTTPProviderServer(host, port)
 	}
 
 	return nil
@@ -134,6 +289,7 @@ func (c *Client) SetHTTPAddress(iface string) error {
 // SetTLSAddress specifies a custom interface:port to be used for TLS based challenges.
 // If this option is not used, the default port 443 and all interfaces will be used.
 // To only specify a port and no interface use the ":port" notation.
+// It also applies to tls-alpn-01 if that has been enabled with SetChallengeProvider.
 func (c *Client) SetTLSAddress(iface string) error {
 	host, port, err := net.SplitHostPort(iface)
 	if err != nil {
@@ -143,9 +299,93 @@ func (c *Client) SetTLSAddress(iface string) error {
 	if chlng, ok := c.solvers[TLSSNI01]; ok {
 		chlng.(*tlsSNIChallenge).provider = &tlsSNIChallengeServer{iface: host, port: port}
 	}
+	if chlng, ok := c.solvers[TLSALPN01]; ok {
+		chlng.(*tlsALPNChallenge).provider = NewTLSALPNProviderServer(host, port)
+	}
+	return nil
+}
+
+// SetPostAsGet specifies whether authorizations, challenges and certificates
+// are fetched with POST-as-GET requests as defined by RFC 8555 instead of
+// plain GETs. By default plain GETs are sent until the server refuses one
+// with 405 Method Not Allowed, after which the client uses POST-as-GET.
+func (c *Client) SetPostAsGet(enabled bool) {
+	c.jws.setPostAsGet(enabled)
+}
+
+// SetNoncePoolSize specifies how many unused nonces of past responses are kept
+// for signing later requests, so that concurrent requests rarely have to ask
+// the server for a fresh nonce. A non-positive size restores the default of 16.
+func (c *Client) SetNoncePoolSize(size int) {
+	c.jws.mu.Lock()
+	c.jws.maxNonces = size
+	c.jws.mu.Unlock()
+}
+
+// SetCAAIdentity enables checking the CAA records of every domain before
+// any challenge is solved, so that ObtainCertificate fails fast if the CA
+// identified by identity, e.g. "letsencrypt.org", may not issue for it.
+// An empty identity disables the check, which is the default.
+func (c *Client) SetCAAIdentity(identity string) {
+	c.caaIdentity = identity
+}
+
+// SetCACertificates makes the TLS connections to the ACME server trust the
+// certificates in pool instead of the system roots, e.g. those of an
+// internal CA or of a test CA like Pebble. A nil pool restores the system
+// roots. Requests to DNS provider APIs are not affected. Use
+// WithCACertificates for the directory request of NewClient.
+func (c *Client) SetCACertificates(pool *x509.CertPool) {
+	c.jws.setHTTPClient(func(client *http.Client) *http.Client {
+		return withTLSConfig(client, func(config *tls.Config) { config.RootCAs = pool })
+	})
+}
+
+// SetInsecureSkipVerify disables the verification of the TLS certificate of
+// the ACME server if skip is true. This makes the connections vulnerable to
+// man-in-the-middle attacks and is only meant for local test CAs. Requests
+// to DNS provider APIs are not affected. Use WithInsecureSkipVerify for the
+// directory request of NewClient.
+func (c *Client) SetInsecureSkipVerify(skip bool) {
+	c.jws.setHTTPClient(func(client *http.Client) *http.Client {
+		return withTLSConfig(client, func(config *tls.Config) { config.InsecureSkipVerify = skip })
+	})
+}
+
+// SetDNSConcurrency specifies how many authorizations solved solely by dns-01
+// challenges are worked on in parallel. The default is 6. Other challenge types
+// listen on fixed ports and are always solved one after another, as are
+// dns-01 challenges presented with DNSProviderManual.
+func (c *Client) SetDNSConcurrency(n int) error {
+	if n < 1 {
+		return fmt.Errorf("Invalid DNS concurrency %d", n)
+	}
+	c.dnsConcurrency = n
 	return nil
 }
 
+// SetOrderPollInterval sets how often the client checks whether a requested
+// certificate has been issued, unless the server asks for a different
+// interval with a Retry-After header. A non-positive d restores the default
+// of one second.
+func (c *Client) SetOrderPollInterval(d time.Duration) {
+	c.orderPollInterval = d
+}
+
+// SetOrderTimeout sets how long the client waits for a requested certificate
+// to be issued before giving up. A non-positive d restores the default of
+// five minutes.
+func (c *Client) SetOrderTimeout(d time.Duration) {
+	c.orderTimeout = d
+}
+
+// SetChallengeSelector installs the ChallengeSelector deciding which of the
+// offered challenge types is attempted for a domain. A nil selector restores
+// DefaultChallengeSelector.
+func (c *Client) SetChallengeSelector(s ChallengeSelector) {
+	c.selector = s
+}
+
 // ExcludeChallenges explicitly removes challenges from the pool for solving.
 func (c *Client) ExcludeChallenges(challenges []Challenge) {
 	// Loop through all challenges and delete the requested one if found.
@@ -156,13 +396,46 @@ func (c *Client) ExcludeChallenges(challenges []Challenge) {
 
 // Register the current account to the ACME server.
 func (c *Client) Register() (*RegistrationResource, error) {
+	return c.register(nil)
+}
+
+// RegisterWithEAB registers the current account to the ACME server and binds it
+// to an existing account at the CA (External Account Binding). kid is the key
+// identifier and hmacKey the base64url encoded MAC key, both issued by the CA.
+func (c *Client) RegisterWithEAB(kid, hmacKey string) (*RegistrationResource, error) {
+	if c == nil || c.user == nil {
+		return nil, errors.New("acme: cannot register a nil client or user")
+	}
+	if kid == "" {
+		return nil, errors.New("acme: EAB key identifier missing")
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(hmacKey, "="))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("acme: EAB HMAC key is not valid base64url: %v", err)
+	}
+
+	eab, err := c.jws.signEABContent(c.directory.NewRegURL, kid, key)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := c.register(eab)
+	if remoteErr, ok := err.(RemoteError); ok && strings.Contains(remoteErr.Type, "externalAccount") {
+		return nil, fmt.Errorf("acme: The CA rejected the external account binding: %v", err)
+	}
+	return reg, err
+}
+
+func (c *Client) register(eab *externalAccountBinding) (*RegistrationResource, error) {
 	if c == nil || c.user == nil {
 		return nil, errors.New("acme: cannot register a nil client or user")
 	}
 	logf("[INFO] acme: Registering account for %s", c.user.GetEmail())
 
 	regMsg := registrationMessage{
-		Resource: "new-reg",
+		Resource:               "new-reg",
+		ExternalAccountBinding: eab,
 	}
 	if c.user.GetEmail() != "" {
 		regMsg.Contact = []string{"mailto:" + c.user.GetEmail()}
@@ -196,12 +469,113 @@ func (c *Client) Register() (*RegistrationResource, error) {
 // AgreeToTOS updates the Client registration and sends the agreement to
 // the server.
 func (c *Client) AgreeToTOS() error {
+	if err := c.checkAccount(); err != nil {
+		return err
+	}
 	c.user.GetRegistration().Body.Agreement = c.user.GetRegistration().TosURL
 	c.user.GetRegistration().Body.Resource = "reg"
 	_, err := postJSON(c.jws, c.user.GetRegistration().URI, c.user.GetRegistration().Body, nil)
 	return err
 }
 
+// RolloverAccountKey replaces the key of the current account with newKey.
+// On success the client signs all further requests with newKey. The caller
+// is responsible for persisting newKey, as the User is not modified.
+// Only RSA keys are supported.
+func (c *Client) RolloverAccountKey(newKey crypto.Signer) error {
+	if c.directory.KeyChangeURL == "" {
+		return errors.New("acme: The server does not support account key rollover")
+	}
+	if err := c.checkAccount(); err != nil {
+		return err
+	}
+
+	rsaKey, ok := newKey.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("acme: Unsupported account key type %T", newKey)
+	}
+
+	reg := c.user.GetRegistration()
+	if reg == nil || reg.URI == "" {
+		return errors.New("acme: Cannot roll over the key of an unregistered account")
+	}
+
+	jwk := keyAsJWK(&rsaKey.PublicKey)
+	msg, err := json.Marshal(keyChangeMessage{Resource: "key-change", Account: reg.URI, NewKey: *jwk})
+	if err != nil {
+		return err
+	}
+
+	// The inner JWS proves possession of the new key, the outer JWS
+	// signed by the current key authorizes the change.
+	inner, err := signKeyChange(rsaKey, msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.jws.post(c.directory.KeyChangeURL, []byte(inner.FullSerialize()))
+	if err != nil {
+		return fmt.Errorf("acme: Key change request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		err := handleHTTPError(resp)
+		if resp.StatusCode == http.StatusConflict {
+			return fmt.Errorf("acme: The new account key is already in use: %v", err)
+		}
+		return err
+	}
+
+	c.jws.setKey(rsaKey)
+	logf("[INFO] acme: Rolled over account key for %s", reg.URI)
+	return nil
+}
+
+// ObtainOptions holds optional settings for ObtainCertificateWithOptions.
+type ObtainOptions struct {
+	// MustStaple requests the OCSP Must-Staple TLS feature (RFC 7633)
+	// in the certificate.
+	MustStaple bool
+
+	// NotBefore and NotAfter request a validity period for the certificate.
+	// They are only sent when set; many CAs, like Let's Encrypt, ignore or
+	// reject them.
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// PreferredChain selects, among the default chain and the alternate
+	// chains the server offers, the one whose top-most certificate is issued
+	// by the CA with this common name, e.g. "ISRG Root X1". The default chain
+	// is used if none matches.
+	PreferredChain string
+
+	// KeyType selects the type of private key generated for the
+	// certificate. When a private key is passed in, it must be of this type.
+	KeyType KeyType
+}
+
+// validate checks the options for consistency before any request is made.
+func (o ObtainOptions) validate() error {
+	if !o.NotBefore.IsZero() && !o.NotAfter.IsZero() && !o.NotBefore.Before(o.NotAfter) {
+		return fmt.Errorf("NotBefore (%s) must be before NotAfter (%s)", o.NotBefore.Format(time.RFC3339), o.NotAfter.Format(time.RFC3339))
+	}
+	if o.KeyType != "" {
+		if _, _, err := o.KeyType.params(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateKey checks that privKey, if given, is of the requested key type.
+func (o ObtainOptions) validateKey(privKey crypto.PrivateKey) error {
+	if o.KeyType == "" || privKey == nil {
+		return nil
+	}
+	return o.KeyType.matches(privKey)
+}
+
 // ObtainCertificate tries to obtain a single certificate using all domains passed into it.
 // The first domain in domains is used for the CommonName field of the certificate, all other
 // domains are added using the Subject Alternate Names extension. A new private key is generated
@@ -212,38 +586,252 @@ func (c *Client) AgreeToTOS() error {
 // This function will never return a partial certificate. If one domain in the list fails,
 // the whole certificate will fail.
 func (c *Client) ObtainCertificate(domains []string, bundle bool, privKey crypto.PrivateKey) (CertificateResource, map[string]error) {
+	return c.ObtainCertificateWithOptions(domains, bundle, privKey, ObtainOptions{})
+}
+
+// ObtainCertificateWithOptions is like ObtainCertificate, but applies the given options
+// to the certificate request.
+func (c *Client) ObtainCertificateWithOptions(domains []string, bundle bool, privKey crypto.PrivateKey, opts ObtainOptions) (CertificateResource, map[string]error) {
 	if bundle {
 		logf("[INFO][%s] acme: Obtaining bundled SAN certificate", strings.Join(domains, ", "))
 	} else {
 		logf("[INFO][%s] acme: Obtaining SAN certificate", strings.Join(domains, ", "))
 	}
 
+	err := opts.validate()
+	if err == nil {
+		err = opts.validateKey(privKey)
+	}
+	if err != nil {
+		failures := make(map[string]error)
+		for _, domain := range domains {
+			failures[domain] = err
+		}
+		return CertificateResource{}, failures
+	}
+
+	challenges, failures := c.authorize(domains)
+	if len(failures) > 0 {
+		return CertificateResource{}, failures
+	}
+
+	cert, err := c.requestCertificate(challenges, bundle, privKey, opts)
+	if err != nil {
+		for _, chln := range challenges {
+			failures[chln.Domain] = err
+		}
+	}
+
+	return cert, failures
+}
+
+// ObtainForCSR obtains a certificate for the domains in the CommonName,
+// DNSNames and IPAddresses of csr, which is sent to the server as is. This allows the private
+// key to be kept elsewhere, e.g. in an HSM; the returned resource has no
+// PrivateKey. Certificate holds the issued certificate bundled with its
+// issuer chain.
+func (c *Client) ObtainForCSR(csr *x509.CertificateRequest) (*CertificateResource, error) {
+	domains := csrDomains(csr)
+	if len(domains) == 0 {
+		return nil, errors.New("CSR does not contain any domain")
+	}
+
+	logf("[INFO][%s] acme: Obtaining bundled SAN certificate given a CSR", strings.Join(domains, ", "))
+
+	challenges, failures := c.authorize(domains)
+	if len(failures) > 0 {
+		return nil, obtainError(failures)
+	}
+
+	cert, err := c.requestCertificateForCsr(challenges, true, csr.Raw, nil, ObtainOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// authorize gets and solves the authorizations for domains. If any domain
+// fails, the failures are returned, so that no partial SAN certificate is
+// requested.
+func (c *Client) authorize(domains []string) ([]authorizationResource, map[string]error) {
+	if err := c.checkAccount(); err != nil {
+		failures := make(map[string]error)
+		for _, domain := range domains {
+			failures[domain] = err
+		}
+		return nil, failures
+	}
+
+	if !c.directory.supportsIdentifier("ip") {
+		failures := make(map[string]error)
+		for _, domain := range domains {
+			if net.ParseIP(domain) != nil {
+				failures[domain] = errIPIdentifierUnsupported
+			}
+		}
+		if len(failures) > 0 {
+			return nil, failures
+		}
+	}
+
+	if c.caaIdentity != "" {
+		failures := make(map[string]error)
+		for _, domain := range domains {
+			// CAA records only exist for domain names.
+			if net.ParseIP(domain) != nil {
+				continue
+			}
+			if err := CheckCAA(domain, c.caaIdentity); err != nil {
+				failures[domain] = err
+			}
+		}
+		if len(failures) > 0 {
+			return nil, failures
+		}
+	}
+
 	challenges, failures := c.getChallenges(domains)
 	// If any challenge fails - return. Do not generate partial SAN certificates.
 	if len(failures) > 0 {
-		return CertificateResource{}, failures
+		return nil, failures
 	}
 
 	errs := c.solveChallenges(challenges)
 	// If any challenge fails - return. Do not generate partial SAN certificates.
 	if len(errs) > 0 {
-		return CertificateResource{}, errs
+		return nil, errs
 	}
 
 	logf("[INFO][%s] acme: Validations succeeded; requesting certificates", strings.Join(domains, ", "))
 
-	cert, err := c.requestCertificate(challenges, bundle, privKey)
+	return challenges, failures
+}
+
+var errIPIdentifierUnsupported = errors.New("acme: The CA does not support IP address identifiers")
+
+// identifierFor returns the identifier of domain, which is an IP address
+// identifier if domain parses as one.
+func identifierFor(domain string) identifier {
+	if ip := net.ParseIP(domain); ip != nil {
+		return identifier{Type: "ip", Value: ip.String()}
+	}
+	return identifier{Type: "dns", Value: domain}
+}
+
+// csrDomains returns the CommonName of csr followed by its DNSNames and
+// IPAddresses, without duplicates.
+func csrDomains(csr *x509.CertificateRequest) []string {
+	names := append([]string{csr.Subject.CommonName}, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	var domains []string
+	seen := make(map[string]bool)
+	for _, domain := range names {
+		if domain == "" || seen[strings.ToLower(domain)] {
+			continue
+		}
+		seen[strings.ToLower(domain)] = true
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+// obtainError combines the per domain failures of an issuance into one error.
+func obtainError(failures map[string]error) error {
+	domains := make([]string, 0, len(failures))
+	for domain := range failures {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	msg := "Could not obtain certificate:"
+	for _, domain := range domains {
+		msg += fmt.Sprintf("\n[%s] %v", domain, failures[domain])
+	}
+	return errors.New(msg)
+}
+
+// accountDeactivated is the status of a deactivated account.
+const accountDeactivated = "deactivated"
+
+var errAccountDeactivated = errors.New("acme: The account is deactivated and can no longer be used")
+
+// DeactivateAccount deactivates the current account, so that the server
+// rejects all further requests signed with its key. This cannot be undone.
+// The status of the registration, which callers may persist, is set to
+// "deactivated" and the client refuses to use the account from then on.
+func (c *Client) DeactivateAccount() error {
+	reg := c.user.GetRegistration()
+	if reg == nil || reg.URI == "" {
+		return errors.New("acme: Cannot deactivate an unregistered account")
+	}
+	if reg.Body.Status == accountDeactivated {
+		return nil
+	}
+
+	var serverReg Registration
+	_, err := postJSON(c.jws, reg.URI, deactivationMessage{Resource: "reg", Status: accountDeactivated}, &serverReg)
 	if err != nil {
-		for _, chln := range challenges {
-			failures[chln.Domain] = err
+		// Servers reject any request for a deactivated account, including
+		// this one, if an earlier deactivation went through unnoticed.
+		remoteErr, ok := err.(RemoteError)
+		if !ok || remoteErr.StatusCode != http.StatusForbidden || !strings.Contains(remoteErr.Detail, accountDeactivated) {
+			return err
 		}
+		logf("[INFO] acme: Account %s was already deactivated", reg.URI)
+	} else if serverReg.Status != "" && serverReg.Status != accountDeactivated {
+		return fmt.Errorf("acme: The server did not deactivate the account, its status is %q", serverReg.Status)
 	}
 
-	return cert, failures
+	reg.Body.Status = accountDeactivated
+	logf("[INFO] acme: Deactivated account %s", reg.URI)
+	return nil
 }
 
+// checkAccount fails if the account has been deactivated.
+func (c *Client) checkAccount() error {
+	if c.user == nil {
+		return nil
+	}
+	if reg := c.user.GetRegistration(); reg != nil && reg.Body.Status == accountDeactivated {
+		return errAccountDeactivated
+	}
+	return nil
+}
+
+// Revocation reason codes as defined in RFC 5280, section 5.3.1.
+const (
+	RevocationUnspecified          = 0
+	RevocationKeyCompromise        = 1
+	RevocationCACompromise         = 2
+	RevocationAffiliationChanged   = 3
+	RevocationSuperseded           = 4
+	RevocationCessationOfOperation = 5
+	RevocationCertificateHold      = 6
+	RevocationRemoveFromCRL        = 8
+	RevocationPrivilegeWithdrawn   = 9
+	RevocationAACompromise         = 10
+)
+
 // RevokeCertificate takes a PEM encoded certificate or bundle and tries to revoke it at the CA.
 func (c *Client) RevokeCertificate(certificate []byte) error {
+	return c.RevokeCertificateWithReason(certificate, RevocationUnspecified)
+}
+
+// RevokeCertificateWithReason is like RevokeCertificate, but tells the CA why the
+// certificate is revoked. reason must be one of the RFC 5280 reason codes; code 7
+// is not assigned.
+func (c *Client) RevokeCertificateWithReason(certificate []byte, reason int) error {
+	if reason < RevocationUnspecified || reason > RevocationAACompromise || reason == 7 {
+		return fmt.Errorf("Invalid revocation reason code %d", reason)
+	}
+	if err := c.checkAccount(); err != nil {
+		return err
+	}
+
 	certificates, err := parsePEMBundle(certificate)
 	if err != nil {
 		return err
@@ -256,7 +844,7 @@ func (c *Client) RevokeCertificate(certificate []byte) error {
 
 	encodedCert := base64.URLEncoding.EncodeToString(x509Cert.Raw)
 
-	_, err = postJSON(c.jws, c.directory.RevokeCertURL, revokeCertMessage{Resource: "revoke-cert", Certificate: encodedCert}, nil)
+	_, err = postJSON(c.jws, c.directory.RevokeCertURL, revokeCertMessage{Resource: "revoke-cert", Certificate: encodedCert, Reason: reason}, nil)
 	return err
 }
 
@@ -269,6 +857,10 @@ func (c *Client) RevokeCertificate(certificate []byte) error {
 // your issued certificate as a bundle.
 // For private key reuse the PrivateKey property of the passed in CertificateResource should be non-nil.
 func (c *Client) RenewCertificate(cert CertificateResource, bundle bool) (CertificateResource, error) {
+	if err := c.checkAccount(); err != nil {
+		return CertificateResource{}, err
+	}
+
 	// Input certificate is PEM encoded. Decode it here as we may need the decoded
 	// cert later on in the renewal process. The input may be a bundle or a single certificate.
 	certificates, err := parsePEMBundle(cert.Certificate)
@@ -287,7 +879,7 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle bool) (Certif
 
 	// The first step of renewal is to check if we get a renewed cert
 	// directly from the cert URL.
-	resp, err := httpGet(cert.CertURL)
+	resp, err := c.jws.get(cert.CertURL)
 	if err != nil {
 		return CertificateResource{}, err
 	}
@@ -297,7 +889,12 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle bool) (Certif
 		return CertificateResource{}, err
 	}
 
-	serverCert, err := x509.ParseCertificate(serverCertBytes)
+	issuedCert, issuerCert, err := c.certificateChain(cert.Domain, serverCertBytes, resp.Header)
+	if err != nil {
+		return CertificateResource{}, err
+	}
+
+	serverCert, err := pemDecodeTox509(issuedCert)
 	if err != nil {
 		return CertificateResource{}, err
 	}
@@ -306,23 +903,10 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle bool) (Certif
 	// TODO: Further test if we can actually use the new certificate (Our private key works)
 	if !x509Cert.Equal(serverCert) {
 		logf("[INFO][%s] acme: Server responded with renewed certificate", cert.Domain)
-		issuedCert := pemEncode(derCertificateBytes(serverCertBytes))
+		cert.IssuerCertificate = issuerCert
 		// If bundle is true, we want to return a certificate bundle.
-		// To do this, we need the issuer certificate.
 		if bundle {
-			// The issuer certificate link is always supplied via an "up" link
-			// in the response headers of a new certificate.
-			links := parseLinks(resp.Header["Link"])
-			issuerCert, err := c.getIssuerCertificate(links["up"])
-			if err != nil {
-				// If we fail to aquire the issuer cert, return the issued certificate - do not fail.
-				logf("[ERROR][%s] acme: Could not bundle issuer certificate: %v", cert.Domain, err)
-			} else {
-				// Success - append the issuer cert to the issued cert.
-				issuerCert = pemEncode(derCertificateBytes(issuerCert))
-				issuedCert = append(issuedCert, issuerCert...)
-				cert.Certificate = issuedCert
-			}
+			issuedCert = append(issuedCert, issuerCert...)
 		}
 
 		cert.Certificate = issuedCert
@@ -341,48 +925,311 @@ func (c *Client) RenewCertificate(cert CertificateResource, bundle bool) (Certif
 	return newCert, failures[cert.Domain]
 }
 
+// RenewIfNeeded renews the certificate in cert using RenewCertificate if it
+// expires within window, which defaults to DefaultRenewalWindow if zero.
+// The returned bool reports whether a renewal took place. If the certificate
+// is still valid long enough, cert is returned unchanged.
+func (c *Client) RenewIfNeeded(cert CertificateResource, bundle bool, window time.Duration) (CertificateResource, bool, error) {
+	certificates, err := parsePEMBundle(cert.Certificate)
+	if err != nil {
+		return cert, false, err
+	}
+
+	if !NeedsRenewal(certificates[0], window) {
+		logf("[INFO][%s] acme: Certificate expires on %s; no renewal needed", cert.Domain, certificates[0].NotAfter.UTC().Format(time.RFC3339))
+		return cert, false, nil
+	}
+
+	newCert, err := c.RenewCertificate(cert, bundle)
+	if err != nil {
+		return cert, false, err
+	}
+	return newCert, true, nil
+}
+
 // Looks through the challenge combinations to find a solvable match.
-// Then solves the challenges in series and returns.
+// Then solves the challenges and returns. Authorizations which are solved
+// by dns-01 challenges only are worked on concurrently, all others in series.
 func (c *Client) solveChallenges(challenges []authorizationResource) map[string]error {
-	// loop through the resources, basically through the domains.
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, c.dnsSolveConcurrency())
+	)
+
 	failures := make(map[string]error)
+	fail := func(domain string, err error) {
+		mu.Lock()
+		failures[domain] = err
+		mu.Unlock()
+	}
+
+	// Authorizations sharing a challenge record, like example.com and
+	// *.example.com, are solved one after the other, so that providers
+	// replacing the record on Present do not clobber each other.
+	var groups [][]dnsAuthorization
+	groupIndex := make(map[string]int)
+
+	// loop through the resources, basically through the domains.
 	for _, authz := range challenges {
+		// The server may reuse an authorization we completed earlier.
+		if authz.Body.Status == "valid" {
+			logf("[INFO][%s] acme: Authorization already valid; skipping challenge", authz.Domain)
+			continue
+		}
+
+		solvers, err := c.chooseSolvers(authz.Body, authz.Domain)
+		if err != nil {
+			fail(authz.Domain, fmt.Errorf("[%s] acme: Could not select a challenge: %v", authz.Domain, err))
+			continue
+		}
 		// no solvers - no solving
-		if solvers := c.chooseSolvers(authz.Body, authz.Domain); solvers != nil {
-			for i, solver := range solvers {
-				// TODO: do not immediately fail if one domain fails to validate.
-				err := solver.Solve(authz.Body.Challenges[i], authz.Domain)
+		if solvers == nil {
+			fail(authz.Domain, fmt.Errorf("[%s] acme: Could not determine solvers for the offered challenges %v", authz.Domain, offeredChallenges(authz.Body)))
+			continue
+		}
+
+		if !dnsOnly(solvers) {
+			if err := solveAuthorization(c.jws, authz, solvers); err != nil {
+				fail(authz.Domain, err)
+			}
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.ToLower(authz.Domain), "*.")
+		i, ok := groupIndex[name]
+		if !ok {
+			i = len(groups)
+			groupIndex[name] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], dnsAuthorization{authz, solvers})
+	}
+
+	if provider, ok := c.batchDNSProvider(); ok {
+		c.solveDNSBatch(provider, groups, sem, fail)
+		return failures
+	}
+
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group []dnsAuthorization) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			for _, a := range group {
+				if err := solveAuthorization(c.jws, a.authz, a.solvers); err != nil {
+					fail(a.authz.Domain, err)
+				}
+			}
+		}(group)
+	}
+	wg.Wait()
+
+	return failures
+}
+
+// dnsSolveConcurrency returns how many dns-01 authorizations are solved in
+// parallel. The manual provider prompts on the terminal and waits for input
+// there, so its authorizations are solved one after another.
+func (c *Client) dnsSolveConcurrency() int {
+	if s, ok := c.solvers[DNS01].(*dnsChallenge); ok {
+		if _, manual := s.provider.(*DNSProviderManual); manual {
+			return 1
+		}
+	}
+	return c.dnsConcurrency
+}
+
+// batchDNSProvider returns the dns-01 provider if it is a BatchDNSProvider.
+func (c *Client) batchDNSProvider() (BatchDNSProvider, bool) {
+	s, ok := c.solvers[DNS01].(*dnsChallenge)
+	if !ok {
+		return nil, false
+	}
+	provider, ok := s.provider.(BatchDNSProvider)
+	return provider, ok
+}
+
+// solveDNSBatch solves the dns-01 authorizations in groups with a single
+// PresentBatch call for all their records. The authorizations are then
+// validated concurrently and finally all records are removed with a single
+// CleanUpBatch call.
+func (c *Client) solveDNSBatch(provider BatchDNSProvider, groups [][]dnsAuthorization, sem chan struct{}, fail func(domain string, err error)) {
+	var (
+		presented []dnsAuthorization
+		records   []DNSChallengeRecord
+	)
+	for _, group := range groups {
+	authorizations:
+		for _, a := range group {
+			solvers := make(map[int]solver)
+			for i, s := range a.solvers {
+				dns := s.(*dnsChallenge)
+				rec, err := dns.record(a.authz.Body.Challenges[i], a.authz.Domain)
 				if err != nil {
-					failures[authz.Domain] = err
+					fail(a.authz.Domain, err)
+					continue authorizations
 				}
+				solvers[i] = presentedDNSChallenge{challenge: dns, record: rec}
+				records = append(records, rec)
 			}
-		} else {
-			failures[authz.Domain] = fmt.Errorf("[%s] acme: Could not determine solvers", authz.Domain)
+			presented = append(presented, dnsAuthorization{a.authz, solvers})
 		}
 	}
+	if len(records) == 0 {
+		return
+	}
 
-	return failures
+	logf("[INFO] acme: Trying to solve DNS-01 for %d records in a batch", len(records))
+	if err := provider.PresentBatch(records); err != nil {
+		for _, a := range presented {
+			fail(a.authz.Domain, fmt.Errorf("Error presenting token %s", err))
+		}
+		return
+	}
+	defer func() {
+		if err := provider.CleanUpBatch(records); err != nil {
+			log.Printf("Error cleaning up %d records %v ", len(records), err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, a := range presented {
+		wg.Add(1)
+		go func(a dnsAuthorization) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := solveAuthorization(c.jws, a.authz, a.solvers); err != nil {
+				fail(a.authz.Domain, err)
+			}
+		}(a)
+	}
+	wg.Wait()
+}
+
+// dnsAuthorization is an authorization which is solved by dns-01 solvers only.
+type dnsAuthorization struct {
+	authz   authorizationResource
+	solvers map[int]solver
 }
 
-// Checks all combinations from the server and returns an array of
-// solvers which should get executed in series.
-func (c *Client) chooseSolvers(auth authorization, domain string) map[int]solver {
+// solveAuthorization runs all solvers of a single authorization in series
+// and then waits for the authorization itself to become valid.
+func solveAuthorization(j *jws, authz authorizationResource, solvers map[int]solver) error {
+	var lastErr error
+	for i, solver := range solvers {
+		// TODO: do not immediately fail if one domain fails to validate.
+		err := solver.Solve(authz.Body.Challenges[i], authz.Domain)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	if lastErr != nil || authz.AuthURL == "" {
+		return lastErr
+	}
+
+	_, err := pollAuthorization(j, authz.AuthURL, authorizationTimeout)
+	return err
+}
+
+// dnsOnly reports whether all solvers are dns-01 solvers which may run concurrently.
+func dnsOnly(solvers map[int]solver) bool {
+	for _, s := range solvers {
+		if _, ok := s.(*dnsChallenge); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// chooseSolvers asks the challenge selector to pick one of the offered
+// challenge types the client has a solver for and returns the solvers of the
+// first combination containing that type which can be solved as a whole.
+func (c *Client) chooseSolvers(auth authorization, domain string) (map[int]solver, error) {
+	var available []Challenge
+	for _, chlng := range offeredChallenges(auth) {
+		if _, ok := c.solvers[chlng]; ok {
+			available = append(available, chlng)
+		} else {
+			logf("[INFO][%s] acme: Could not find solver for: %s", domain, chlng)
+		}
+	}
+	if len(available) == 0 {
+		return nil, nil
+	}
+
+	selector := c.selector
+	if selector == nil {
+		selector = DefaultChallengeSelector{}
+	}
+	selected, err := selector.Select(domain, available)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prefer a combination with the selected type. If none of those can be
+	// solved, use the first combination there are solvers for.
+	var fallback map[int]solver
 	for _, combination := range auth.Combinations {
 		solvers := make(map[int]solver)
+		hasSelected := false
 		for _, idx := range combination {
+			if auth.Challenges[idx].Type == selected {
+				hasSelected = true
+			}
 			if solver, ok := c.solvers[auth.Challenges[idx].Type]; ok {
 				solvers[idx] = solver
-			} else {
-				logf("[INFO][%s] acme: Could not find solver for: %s", domain, auth.Challenges[idx].Type)
 			}
 		}
 
 		// If we can solve the whole combination, return the solvers
-		if len(solvers) == len(combination) {
-			return solvers
+		if len(solvers) != len(combination) {
+			continue
+		}
+		if hasSelected {
+			return solvers, nil
+		}
+		if fallback == nil {
+			fallback = solvers
 		}
 	}
-	return nil
+	if fallback != nil {
+		logf("[INFO][%s] acme: Could not solve a combination with %s; falling back to another one", domain, selected)
+	}
+	return fallback, nil
+}
+
+// SupportedChallenges requests an authorization for domain and returns the
+// types of challenges the ACME server offers to validate it. Callers can use
+// it to pick a matching provider before obtaining a certificate.
+func (c *Client) SupportedChallenges(domain string) ([]Challenge, error) {
+	challenges, failures := c.getChallenges([]string{domain})
+	if err := failures[domain]; err != nil {
+		return nil, err
+	}
+	if len(challenges) == 0 {
+		return nil, fmt.Errorf("[%s] acme: Server did not return an authorization", domain)
+	}
+
+	return offeredChallenges(challenges[0].Body), nil
+}
+
+// offeredChallenges returns the distinct challenge types of an authorization
+// in the order the server listed them.
+func offeredChallenges(auth authorization) []Challenge {
+	var types []Challenge
+	seen := make(map[Challenge]bool)
+	for _, chlng := range auth.Challenges {
+		if !seen[chlng.Type] {
+			seen[chlng.Type] = true
+			types = append(types, chlng.Type)
+		}
+	}
+	return types
 }
 
 // Get the challenges needed to proof our identifier to the ACME server.
@@ -391,7 +1238,7 @@ func (c *Client) getChallenges(domains []string) ([]authorizationResource, map[s
 
 	for _, domain := range domains {
 		go func(domain string) {
-			authMsg := authorization{Resource: "new-authz", Identifier: identifier{Type: "dns", Value: domain}}
+			authMsg := authorization{Resource: "new-authz", Identifier: identifierFor(domain)}
 			var authz authorization
 			hdr, err := postJSON(c.jws, c.user.GetRegistration().NewAuthzURL, authMsg, &authz)
 			if err != nil {
@@ -433,7 +1280,20 @@ func (c *Client) getChallenges(domains []string) ([]authorizationResource, map[s
 	return challenges, failures
 }
 
-func (c *Client) requestCertificate(authz []authorizationResource, bundle bool, privKey crypto.PrivateKey) (CertificateResource, error) {
+// newCsrMessage builds the new-cert request, including the requested
+// validity period if one is set in opts.
+func newCsrMessage(csr string, authURLs []string, opts ObtainOptions) csrMessage {
+	msg := csrMessage{Resource: "new-cert", Csr: csr, Authorizations: authURLs}
+	if !opts.NotBefore.IsZero() {
+		msg.NotBefore = opts.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if !opts.NotAfter.IsZero() {
+		msg.NotAfter = opts.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return msg
+}
+
+func (c *Client) requestCertificate(authz []authorizationResource, bundle bool, privKey crypto.PrivateKey, opts ObtainOptions) (CertificateResource, error) {
 	if len(authz) == 0 {
 		return CertificateResource{}, errors.New("Passed no authorizations to requestCertificate!")
 	}
@@ -441,27 +1301,47 @@ func (c *Client) requestCertificate(authz []authorizationResource, bundle bool,
 	commonName := authz[0]
 	var err error
 	if privKey == nil {
-		privKey, err = generatePrivateKey(rsakey, c.keyBits)
+		t, length := rsakey, c.keyBits
+		if opts.KeyType != "" {
+			if t, length, err = opts.KeyType.params(); err != nil {
+				return CertificateResource{}, err
+			}
+		}
+		privKey, err = generatePrivateKey(t, length)
 		if err != nil {
 			return CertificateResource{}, err
 		}
 	}
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return CertificateResource{}, fmt.Errorf("Unsupported private key type %T", privKey)
+	}
 
 	var san []string
-	var authURLs []string
 	for _, auth := range authz[1:] {
 		san = append(san, auth.Domain)
-		authURLs = append(authURLs, auth.AuthURL)
 	}
 
-	// TODO: should the CSR be customizable?
-	csr, err := generateCsr(privKey.(*rsa.PrivateKey), commonName.Domain, san)
+	csr, err := generateCsr(signer, commonName.Domain, san, opts.MustStaple)
 	if err != nil {
 		return CertificateResource{}, err
 	}
 
+	return c.requestCertificateForCsr(authz, bundle, csr, pemEncode(privKey), opts)
+}
+
+// requestCertificateForCsr sends the DER encoded csr to the server and waits
+// for the certificate. privateKeyPem is passed on to the returned resource.
+func (c *Client) requestCertificateForCsr(authz []authorizationResource, bundle bool, csr []byte, privateKeyPem []byte, opts ObtainOptions) (CertificateResource, error) {
+	commonName := authz[0]
+
+	var authURLs []string
+	for _, auth := range authz[1:] {
+		authURLs = append(authURLs, auth.AuthURL)
+	}
+
 	csrString := base64.URLEncoding.EncodeToString(csr)
-	jsonBytes, err := json.Marshal(csrMessage{Resource: "new-cert", Csr: csrString, Authorizations: authURLs})
+	jsonBytes, err := json.Marshal(newCsrMessage(csrString, authURLs, opts))
 	if err != nil {
 		return CertificateResource{}, err
 	}
@@ -471,15 +1351,23 @@ func (c *Client) requestCertificate(authz []authorizationResource, bundle bool,
 		return CertificateResource{}, err
 	}
 
-	privateKeyPem := pemEncode(privKey)
 	cerRes := CertificateResource{
 		Domain:     commonName.Domain,
 		CertURL:    resp.Header.Get("Location"),
 		PrivateKey: privateKeyPem}
 
+	pollInterval, timeout := c.orderPollInterval, c.orderTimeout
+	if pollInterval <= 0 {
+		pollInterval = defaultOrderPollInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultOrderTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
 	for {
 		switch resp.StatusCode {
-		case 201, 202:
+		case 200, 201, 202:
 			cert, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
 			resp.Body.Close()
 			if err != nil {
@@ -493,22 +1381,17 @@ func (c *Client) requestCertificate(authz []authorizationResource, bundle bool,
 
 				cerRes.CertStableURL = resp.Header.Get("Content-Location")
 
-				issuedCert := pemEncode(derCertificateBytes(cert))
+				issuedCert, issuerCert, err := c.certificateChain(commonName.Domain, cert, resp.Header)
+				if err != nil {
+					return CertificateResource{}, err
+				}
+				if opts.PreferredChain != "" {
+					issuedCert, issuerCert = c.preferredChain(commonName.Domain, opts.PreferredChain, issuedCert, issuerCert, resp.Header)
+				}
+				cerRes.IssuerCertificate = issuerCert
 				// If bundle is true, we want to return a certificate bundle.
-				// To do this, we need the issuer certificate.
 				if bundle {
-					// The issuer certificate link is always supplied via an "up" link
-					// in the response headers of a new certificate.
-					links := parseLinks(resp.Header["Link"])
-					issuerCert, err := c.getIssuerCertificate(links["up"])
-					if err != nil {
-						// If we fail to aquire the issuer cert, return the issued certificate - do not fail.
-						logf("[WARNING][%s] acme: Could not bundle issuer certificate: %v", commonName.Domain, err)
-					} else {
-						// Success - append the issuer cert to the issued cert.
-						issuerCert = pemEncode(derCertificateBytes(issuerCert))
-						issuedCert = append(issuedCert, issuerCert...)
-					}
+					issuedCert = append(issuedCert, issuerCert...)
 				}
 
 				cerRes.Certificate = issuedCert
@@ -518,36 +1401,114 @@ func (c *Client) requestCertificate(authz []authorizationResource, bundle bool,
 
 			// The certificate was granted but is not yet issued.
 			// Check retry-after and loop.
-			ra := resp.Header.Get("Retry-After")
-			retryAfter, err := strconv.Atoi(ra)
-			if err != nil {
-				return CertificateResource{}, err
+			wait := pollInterval
+			if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(retryAfter) * time.Second
+			}
+			if time.Now().Add(wait).After(deadline) {
+				return CertificateResource{}, fmt.Errorf("[%s] acme: Timed out waiting for the certificate to be issued", commonName.Domain)
 			}
 
-			logf("[INFO][%s] acme: Server responded with status 202; retrying after %ds", commonName.Domain, retryAfter)
-			time.Sleep(time.Duration(retryAfter) * time.Second)
+			logf("[INFO][%s] acme: Server responded with status %d; retrying after %s", commonName.Domain, resp.StatusCode, wait)
+			time.Sleep(wait)
 
 			break
 		default:
 			return CertificateResource{}, handleHTTPError(resp)
 		}
 
-		resp, err = httpGet(cerRes.CertURL)
+		resp, err = c.jws.get(cerRes.CertURL)
 		if err != nil {
 			return CertificateResource{}, err
 		}
 	}
 }
 
+// certificateChain returns the issued certificate and its issuer chain, both
+// PEM encoded, from a certificate response. The server either sends the whole
+// chain PEM encoded or only the DER encoded certificate, with the issuer
+// behind the "up" link. Failing to get the issuer is not an error, the
+// issuer chain is empty then.
+func (c *Client) certificateChain(domain string, body []byte, header http.Header) (cert, issuer []byte, err error) {
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("-----BEGIN")) {
+		return splitPEMChain(body)
+	}
+
+	cert = pemEncode(derCertificateBytes(body))
+
+	links := parseLinks(header["Link"])
+	if links["up"] == "" {
+		return cert, nil, nil
+	}
+
+	issuerCert, err := c.getIssuerCertificate(links["up"])
+	if err != nil {
+		// If we fail to aquire the issuer cert, return the issued certificate - do not fail.
+		logf("[WARNING][%s] acme: Could not get issuer certificate: %v", domain, err)
+		return cert, nil, nil
+	}
+
+	return cert, pemEncode(derCertificateBytes(issuerCert)), nil
+}
+
+// preferredChain returns the chain issued by the CA with the common name
+// name, looking at the default chain first and then at the chains behind the
+// "alternate" links. If no chain matches, the default chain is returned.
+func (c *Client) preferredChain(domain, name string, cert, issuer []byte, header http.Header) ([]byte, []byte) {
+	if chainIssuedBy(cert, issuer, name) {
+		return cert, issuer
+	}
+
+	for _, url := range parseAlternateLinks(header["Link"]) {
+		resp, err := c.jws.get(url)
+		if err != nil {
+			logf("[WARNING][%s] acme: Could not get alternate chain %s: %v", domain, url, err)
+			continue
+		}
+		body, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+		resp.Body.Close()
+		if err == nil && resp.StatusCode >= http.StatusBadRequest {
+			err = fmt.Errorf("HTTP status %d", resp.StatusCode)
+		}
+		if err != nil {
+			logf("[WARNING][%s] acme: Could not get alternate chain %s: %v", domain, url, err)
+			continue
+		}
+
+		altCert, altIssuer, err := c.certificateChain(domain, body, resp.Header)
+		if err != nil {
+			logf("[WARNING][%s] acme: Could not parse alternate chain %s: %v", domain, url, err)
+			continue
+		}
+		if chainIssuedBy(altCert, altIssuer, name) {
+			logf("[INFO][%s] acme: Using the alternate chain issued by %s", domain, name)
+			return altCert, altIssuer
+		}
+	}
+
+	logf("[INFO][%s] acme: No chain issued by %s offered; using the default chain", domain, name)
+	return cert, issuer
+}
+
+// chainIssuedBy reports whether the top-most certificate of the chain formed
+// by cert and issuer is issued by the CA with the common name name.
+func chainIssuedBy(cert, issuer []byte, name string) bool {
+	certificates, err := parsePEMBundle(append(append([]byte{}, cert...), issuer...))
+	if err != nil {
+		return false
+	}
+	return certificates[len(certificates)-1].Issuer.CommonName == name
+}
+
 // getIssuerCertificate requests the issuer certificate and caches it for
-// subsequent requests.
+// subsequent requests to the same url.
 func (c *Client) getIssuerCertificate(url string) ([]byte, error) {
 	logf("[INFO] acme: Requesting issuer cert from %s", url)
-	if c.issuerCert != nil {
+	if c.issuerCert != nil && c.issuerCertURL == url {
 		return c.issuerCert, nil
 	}
 
-	resp, err := httpGet(url)
+	resp, err := c.jws.get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -564,6 +1525,7 @@ func (c *Client) getIssuerCertificate(url string) ([]byte, error) {
 	}
 
 	c.issuerCert = issuerBytes
+	c.issuerCertURL = url
 	return issuerBytes, err
 }
 
@@ -586,6 +1548,78 @@ func parseLinks(links []string) map[string]string {
 	return linkMap
 }
 
+// parseAlternateLinks returns the URLs of all links with the relation
+// "alternate", which parseLinks would collapse into one.
+func parseAlternateLinks(links []string) []string {
+	aBrkt := regexp.MustCompile("[<>]")
+	slver := regexp.MustCompile("(.+) *= *\"(.+)\"")
+
+	var urls []string
+	for _, link := range links {
+		link = aBrkt.ReplaceAllString(link, "")
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+
+		matches := slver.FindStringSubmatch(parts[1])
+		if len(matches) > 0 && matches[2] == "alternate" {
+			urls = append(urls, strings.TrimSpace(parts[0]))
+		}
+	}
+
+	return urls
+}
+
+// pollAuthorization polls the authorization at uri until it is no longer pending
+// and returns its final status. The server's Retry-After header is honored;
+// without one, the wait between polls doubles from pollInitialInterval up to
+// pollMaxInterval. An invalid authorization is returned as an error carrying
+// the detail of the failed challenge.
+func pollAuthorization(j *jws, uri string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	interval := pollInitialInterval
+
+	for {
+		var authz authorization
+		hdr, err := fetchJSON(j, uri, &authz)
+		if err != nil {
+			return "", err
+		}
+
+		switch authz.Status {
+		case "valid":
+			return authz.Status, nil
+		case "pending", "processing":
+			break
+		case "invalid":
+			for _, chlng := range authz.Challenges {
+				if chlng.Status == "invalid" {
+					return authz.Status, handleChallengeError(chlng)
+				}
+			}
+			return authz.Status, fmt.Errorf("acme: Authorization %s is invalid", uri)
+		default:
+			return authz.Status, fmt.Errorf("acme: Unexpected authorization status %q", authz.Status)
+		}
+
+		wait := interval
+		if ra, err := strconv.Atoi(hdr.Get("Retry-After")); err == nil {
+			wait = time.Duration(ra) * time.Second
+		} else {
+			interval *= 2
+			if interval > pollMaxInterval {
+				interval = pollMaxInterval
+			}
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			return authz.Status, fmt.Errorf("acme: Timed out waiting for authorization %s, status is %s", uri, authz.Status)
+		}
+		time.Sleep(wait)
+	}
+}
+
 // validate makes the ACME server start validating a
 // challenge response, only returning once it is done.
 func validate(j *jws, domain, uri string, chlng challenge) error {
@@ -619,7 +1653,7 @@ func validate(j *jws, domain, uri string, chlng challenge) error {
 		}
 		time.Sleep(time.Duration(ra) * time.Second)
 
-		hdr, err = getJSON(uri, &challengeResponse)
+		hdr, err = fetchJSON(j, uri, &challengeResponse)
 		if err != nil {
 			return err
 		}
@@ -1,14 +1,31 @@
 package acme
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/square/go-jose"
 )
 
 func TestNewClient(t *testing.T) {
@@ -49,6 +66,98 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+// newAccountServer starts an ACME server with the single account /reg/1,
+// which belongs to key. If checkKey is false the server does not check the
+// key requests are signed with, leaving that to the client.
+func newAccountServer(t *testing.T, key *rsa.PrivateKey, checkKey bool) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewAuthzURL:   ts.URL + "/new-authz",
+				NewCertURL:    ts.URL + "/new-cert",
+				NewRegURL:     ts.URL + "/new-reg",
+				RevokeCertURL: ts.URL + "/revoke-cert",
+			})
+		case r.Method == "POST" && r.URL.Path == "/reg/1":
+			body, _ := ioutil.ReadAll(r.Body)
+			signed, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Fatalf("Could not parse JWS: %v", err)
+			}
+			if checkKey {
+				if _, err := signed.Verify(&key.PublicKey); err != nil {
+					w.WriteHeader(http.StatusForbidden)
+					writeJSONResponse(w, RemoteError{Type: "urn:acme:error:unauthorized", Detail: "Request signing key did not match registration key"})
+					return
+				}
+			}
+
+			reg := Registration{Resource: "reg", ID: 1, Contact: []string{"mailto:test@test.com"}, Status: "valid"}
+			reg.Key.Kty = "RSA"
+			reg.Key.N = base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes())
+			reg.Key.E = "AQAB"
+			w.Header().Add("Link", "<"+ts.URL+"/new-authz>;rel=\"next\"")
+			w.Header().Add("Link", "<"+ts.URL+"/terms>;rel=\"terms-of-service\"")
+			writeJSONResponse(w, reg)
+		case r.Method == "POST":
+			w.WriteHeader(http.StatusNotFound)
+			writeJSONResponse(w, RemoteError{Type: "urn:acme:error:malformed", Detail: "No registration exists matching provided key"})
+		}
+	}))
+	return ts
+}
+
+func TestNewClientWithAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	ts := newAccountServer(t, key, true)
+	defer ts.Close()
+
+	client, err := NewClientWithAccount(ts.URL+"/directory", key, ts.URL+"/reg/1", 512)
+	if err != nil {
+		t.Fatalf("NewClientWithAccount error: got %v, want nil", err)
+	}
+
+	user := client.user
+	if user.GetEmail() != "test@test.com" || user.GetPrivateKey() != key {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	reg := user.GetRegistration()
+	if reg.URI != ts.URL+"/reg/1" || reg.NewAuthzURL != ts.URL+"/new-authz" || reg.TosURL != ts.URL+"/terms" || reg.Body.ID != 1 {
+		t.Errorf("Unexpected registration %+v", reg)
+	}
+
+	if _, err := NewClientWithAccount(ts.URL+"/directory", key, ts.URL+"/reg/2", 512); err == nil {
+		t.Error("Expected an error for an unknown account")
+	}
+}
+
+func TestNewClientWithAccountWrongKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	for _, checkKey := range []bool{true, false} {
+		ts := newAccountServer(t, key, checkKey)
+
+		_, err := NewClientWithAccount(ts.URL+"/directory", otherKey, ts.URL+"/reg/1", 512)
+		if err == nil || !strings.Contains(err.Error(), "The key does not belong to the account "+ts.URL+"/reg/1") {
+			t.Errorf("server checks key %t: got error %v, want a key mismatch", checkKey, err)
+		}
+		ts.Close()
+	}
+}
+
 func TestClientOptPort(t *testing.T) {
 	keyBits := 32 // small value keeps test fast
 	key, err := rsa.GenerateKey(rand.Reader, keyBits)
@@ -72,6 +181,7 @@ func TestClientOptPort(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Could not create client: %v", err)
 	}
+	client.SetChallengeProvider(TLSALPN01, &TLSALPNProviderServer{})
 	client.SetHTTPAddress(net.JoinHostPort(optHost, optPort))
 	client.SetTLSAddress(net.JoinHostPort(optHost, optPort))
 
@@ -82,10 +192,10 @@ func TestClientOptPort(t *testing.T) {
 	if httpSolver.jws != client.jws {
 		t.Error("Expected http-01 to have same jws as client")
 	}
-	if got := httpSolver.provider.(*httpChallengeServer).port; got != optPort {
+	if got := httpSolver.provider.(*HTTPProviderServer).port; got != optPort {
 		t.Errorf("Expected http-01 to have port %s but was %s", optPort, got)
 	}
-	if got := httpSolver.provider.(*httpChallengeServer).iface; got != optHost {
+	if got := httpSolver.provider.(*HTTPProviderServer).iface; got != optHost {
 		t.Errorf("Expected http-01 to have iface %s but was %s", optHost, got)
 	}
 
@@ -103,12 +213,20 @@ func TestClientOptPort(t *testing.T) {
 		t.Errorf("Expected tls-sni-01 to have port %s but was %s", optHost, got)
 	}
 
+	alpnSolver, ok := client.solvers[TLSALPN01].(*tlsALPNChallenge)
+	if !ok {
+		t.Fatal("Expected tls-alpn-01 solver to be tlsALPNChallenge type")
+	}
+	if got := alpnSolver.provider.(*TLSALPNProviderServer).port; got != optPort {
+		t.Errorf("Expected tls-alpn-01 to have port %s but was %s", optPort, got)
+	}
+
 	// test setting different host
 	optHost = "127.0.0.1"
 	client.SetHTTPAddress(net.JoinHostPort(optHost, optPort))
 	client.SetTLSAddress(net.JoinHostPort(optHost, optPort))
 
-	if got := httpSolver.provider.(*httpChallengeServer).iface; got != optHost {
+	if got := httpSolver.provider.(*HTTPProviderServer).iface; got != optHost {
 		t.Errorf("Expected http-01 to have iface %s but was %s", optHost, got)
 	}
 	if got := httpsSolver.provider.(*tlsSNIChallengeServer).port; got != optPort {
@@ -180,11 +298,549 @@ func writeJSONResponse(w http.ResponseWriter, body interface{}) {
 	}
 }
 
+func TestSolveChallengesConcurrentDNS(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	provider := &slowDNSProvider{delay: 100 * time.Millisecond, fail: "fail.example.com"}
+	client := &Client{
+		solvers:        map[Challenge]solver{DNS01: &dnsChallenge{jws: &jws{privKey: key}, validate: stubValidate, provider: provider}},
+		dnsConcurrency: 4,
+	}
+
+	domains := []string{"fail.example.com"}
+	for i := 0; i < 11; i++ {
+		domains = append(domains, fmt.Sprintf("%d.example.com", i))
+	}
+
+	var authz []authorizationResource
+	for _, domain := range domains {
+		authz = append(authz, authorizationResource{
+			Domain: domain,
+			Body: authorization{
+				Challenges:   []challenge{{Type: DNS01, Token: "token"}},
+				Combinations: [][]int{{0}},
+			},
+		})
+	}
+
+	start := time.Now()
+	failures := client.solveChallenges(authz)
+	elapsed := time.Since(start)
+
+	if len(failures) != 1 || failures["fail.example.com"] == nil {
+		t.Errorf("Expected only fail.example.com to fail but got %v", failures)
+	}
+	if provider.maxActive != 4 {
+		t.Errorf("Expected 4 challenges to be presented concurrently but got %d", provider.maxActive)
+	}
+	if elapsed >= time.Duration(len(domains))*provider.delay {
+		t.Errorf("Expected concurrent solving to be faster than %v but took %v", time.Duration(len(domains))*provider.delay, elapsed)
+	}
+	if provider.cleanedUp != len(domains)-1 {
+		t.Errorf("Expected %d records to be cleaned up but got %d", len(domains)-1, provider.cleanedUp)
+	}
+}
+
+// promptReader confirms every prompt of the manual provider after a delay
+// and records how many prompts wait for input at once.
+type promptReader struct {
+	mu        sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (r *promptReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	r.active++
+	if r.active > r.maxActive {
+		r.maxActive = r.active
+	}
+	r.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	r.mu.Lock()
+	r.active--
+	r.mu.Unlock()
+	return copy(p, "\n"), nil
+}
+
+func TestSolveChallengesManualDNSSerially(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	in := &promptReader{}
+	provider, _ := NewDNSProviderManualIO(in, ioutil.Discard)
+	client := &Client{
+		solvers:        map[Challenge]solver{DNS01: &dnsChallenge{jws: &jws{privKey: key}, validate: stubValidate, provider: provider}},
+		dnsConcurrency: 4,
+	}
+
+	var authz []authorizationResource
+	for i := 0; i < 4; i++ {
+		authz = append(authz, authorizationResource{
+			Domain: fmt.Sprintf("%d.example.com", i),
+			Body: authorization{
+				Challenges:   []challenge{{Type: DNS01, Token: "token"}},
+				Combinations: [][]int{{0}},
+			},
+		})
+	}
+
+	if failures := client.solveChallenges(authz); len(failures) != 0 {
+		t.Errorf("Expected no failures but got %v", failures)
+	}
+	if in.maxActive != 1 {
+		t.Errorf("Expected manual prompts one after another but %d waited at once", in.maxActive)
+	}
+}
+
+func TestPollAuthorization(t *testing.T) {
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "pending"
+		if polls == 3 {
+			status = "valid"
+		}
+		w.Header().Set("Retry-After", "0")
+		writeJSONResponse(w, authorization{Status: status})
+	}))
+	defer ts.Close()
+
+	status, err := pollAuthorization(&jws{}, ts.URL, time.Second)
+	if err != nil {
+		t.Fatalf("pollAuthorization error: got %v, want nil", err)
+	}
+	if status != "valid" || polls != 3 {
+		t.Errorf("pollAuthorization: got status %q after %d polls, want \"valid\" after 3", status, polls)
+	}
+}
+
+func TestPollAuthorizationBackoff(t *testing.T) {
+	defer func(initial, max time.Duration) {
+		pollInitialInterval, pollMaxInterval = initial, max
+	}(pollInitialInterval, pollMaxInterval)
+	pollInitialInterval, pollMaxInterval = 10*time.Millisecond, 40*time.Millisecond
+	defer SetRateLimiter(currentRateLimiter())
+	SetRateLimiter(nil)
+
+	var times []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		writeJSONResponse(w, authorization{Status: "pending"})
+	}))
+	defer ts.Close()
+
+	_, err := pollAuthorization(&jws{}, ts.URL, 150*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Fatalf("pollAuthorization error: got %v, want timeout", err)
+	}
+	// Waits of 10ms, 20ms, 40ms and 40ms fit into the timeout.
+	if len(times) != 5 {
+		t.Fatalf("pollAuthorization: got %d polls, want 5", len(times))
+	}
+	if gap := times[2].Sub(times[1]); gap < 20*time.Millisecond {
+		t.Errorf("Expected the wait to double but the second wait was %v", gap)
+	}
+}
+
+func TestPollAuthorizationInvalid(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, authorization{Status: "invalid", Challenges: []challenge{
+			{Type: HTTP01, Status: "valid"},
+			{Type: DNS01, Status: "invalid", Error: RemoteError{Type: "urn:acme:error:unauthorized", Detail: "Incorrect TXT record"}},
+		}})
+	}))
+	defer ts.Close()
+
+	status, err := pollAuthorization(&jws{}, ts.URL, time.Second)
+	if status != "invalid" {
+		t.Errorf("pollAuthorization: got status %q, want \"invalid\"", status)
+	}
+	if err == nil || !strings.Contains(err.Error(), "Incorrect TXT record") {
+		t.Errorf("pollAuthorization error: got %v, want challenge error detail", err)
+	}
+}
+
+func TestRolloverAccountKey(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var keyInUse bool
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		switch r.Method {
+		case "HEAD":
+		case "GET":
+			writeJSONResponse(w, directory{NewAuthzURL: ts.URL, NewCertURL: ts.URL, NewRegURL: ts.URL, RevokeCertURL: ts.URL, KeyChangeURL: ts.URL + "/key-change"})
+		case "POST":
+			body, _ := ioutil.ReadAll(r.Body)
+			outer, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Fatalf("Could not parse outer JWS: %v", err)
+			}
+			innerBody, err := outer.Verify(&oldKey.PublicKey)
+			if err != nil {
+				t.Fatalf("Outer JWS is not signed by the old key: %v", err)
+			}
+
+			inner, err := jose.ParseSigned(string(innerBody))
+			if err != nil {
+				t.Fatalf("Could not parse inner JWS: %v", err)
+			}
+			payload, err := inner.Verify(&newKey.PublicKey)
+			if err != nil {
+				t.Fatalf("Inner JWS is not signed by the new key: %v", err)
+			}
+
+			var msg keyChangeMessage
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				t.Fatalf("Could not decode key change message: %v", err)
+			}
+			if msg.Resource != "key-change" || msg.Account != "http://example.com/reg/1" {
+				t.Errorf("Unexpected key change message: %+v", msg)
+			}
+			if pub, ok := msg.NewKey.Key.(*rsa.PublicKey); !ok || pub.N.Cmp(newKey.N) != 0 {
+				t.Errorf("Expected newKey to be the new public key but was %v", msg.NewKey.Key)
+			}
+
+			if keyInUse {
+				w.WriteHeader(http.StatusConflict)
+				writeJSONResponse(w, RemoteError{Type: "urn:acme:error:malformed", Detail: "New key is already in use for a different account"})
+			}
+		}
+	}))
+	defer ts.Close()
+
+	user := mockUser{regres: &RegistrationResource{URI: "http://example.com/reg/1"}, privatekey: oldKey}
+	client, err := NewClient(ts.URL, user, 512)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	if err := client.RolloverAccountKey(newKey); err != nil {
+		t.Fatalf("RolloverAccountKey error: got %v, want nil", err)
+	}
+	if client.jws.key() != newKey {
+		t.Errorf("Expected the client to sign with the new key after rollover")
+	}
+
+	// Roll back to the old key, which the server now claims is in use.
+	oldKey, newKey = newKey, oldKey
+	keyInUse = true
+	err = client.RolloverAccountKey(newKey)
+	if err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("RolloverAccountKey error: got %v, want key in use error", err)
+	}
+	if client.jws.key() != oldKey {
+		t.Errorf("Expected the client to keep its key when the rollover fails")
+	}
+}
+
+func TestRevokeCertificateWithReason(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	der, err := generateDerCert(key, time.Now().Add(time.Hour), "example.com")
+	if err != nil {
+		t.Fatal("Could not generate test cert:", err)
+	}
+	certPEM := pemEncode(derCertificateBytes(der))
+
+	var received []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, _ := signed.Verify(&key.PublicKey)
+		var msg map[string]interface{}
+		json.Unmarshal(payload, &msg)
+		received = append(received, msg)
+	}))
+	defer ts.Close()
+
+	client := &Client{directory: directory{RevokeCertURL: ts.URL}, jws: &jws{privKey: key, directoryURL: ts.URL}}
+
+	if err := client.RevokeCertificateWithReason(certPEM, RevocationKeyCompromise); err != nil {
+		t.Fatalf("RevokeCertificateWithReason error: got %v, want nil", err)
+	}
+	if err := client.RevokeCertificate(certPEM); err != nil {
+		t.Fatalf("RevokeCertificate error: got %v, want nil", err)
+	}
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 revocation requests but got %d", len(received))
+	}
+	if reason, ok := received[0]["reason"].(float64); !ok || reason != RevocationKeyCompromise {
+		t.Errorf("Expected reason %d but got %v", RevocationKeyCompromise, received[0]["reason"])
+	}
+	if _, ok := received[1]["reason"]; ok {
+		t.Errorf("Expected no reason for an unspecified revocation but got %v", received[1]["reason"])
+	}
+
+	for _, reason := range []int{-1, 7, 11} {
+		if err := client.RevokeCertificateWithReason(certPEM, reason); err == nil {
+			t.Errorf("Expected reason %d to be rejected", reason)
+		}
+	}
+	if len(received) != 2 {
+		t.Errorf("Expected invalid reasons to be rejected before contacting the CA")
+	}
+}
+
+func TestRegisterWithEAB(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+
+	var reject bool
+	var eab *externalAccountBinding
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, _ := signed.Verify(&key.PublicKey)
+		var msg registrationMessage
+		json.Unmarshal(payload, &msg)
+		eab = msg.ExternalAccountBinding
+
+		if reject {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSONResponse(w, RemoteError{Type: "urn:ietf:params:acme:error:externalAccountRequired", Detail: "Unknown EAB key"})
+			return
+		}
+		w.Header().Add("Link", `<http://example.com/new-authz>;rel="next"`)
+		w.Header().Set("Location", "http://example.com/reg/1")
+		w.WriteHeader(http.StatusCreated)
+		writeJSONResponse(w, Registration{ID: 1})
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		directory: directory{NewRegURL: ts.URL},
+		user:      mockUser{email: "test@test.com", privatekey: key},
+		jws:       &jws{privKey: key, directoryURL: ts.URL},
+	}
+
+	reg, err := client.RegisterWithEAB("kid-1", base64.RawURLEncoding.EncodeToString(hmacKey))
+	if err != nil {
+		t.Fatalf("RegisterWithEAB error: got %v, want nil", err)
+	}
+	if reg.URI != "http://example.com/reg/1" {
+		t.Errorf("Expected registration URI http://example.com/reg/1 but got %s", reg.URI)
+	}
+	if eab == nil {
+		t.Fatal("Expected the registration to contain an external account binding")
+	}
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write([]byte(eab.Protected + "." + eab.Payload))
+	if expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil)); eab.Signature != expected {
+		t.Errorf("Expected EAB signature %s but got %s", expected, eab.Signature)
+	}
+
+	protected, _ := base64.RawURLEncoding.DecodeString(eab.Protected)
+	var hdr map[string]string
+	json.Unmarshal(protected, &hdr)
+	if hdr["alg"] != "HS256" || hdr["kid"] != "kid-1" || hdr["url"] != ts.URL {
+		t.Errorf("Unexpected EAB protected header %v", hdr)
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(eab.Payload)
+	var jwk jose.JsonWebKey
+	if err := json.Unmarshal(payload, &jwk); err != nil {
+		t.Fatalf("Could not decode EAB payload: %v", err)
+	}
+	if pub, ok := jwk.Key.(*rsa.PublicKey); !ok || pub.N.Cmp(key.N) != 0 {
+		t.Errorf("Expected the EAB payload to be the account key but was %v", jwk.Key)
+	}
+
+	reject = true
+	_, err = client.RegisterWithEAB("kid-1", base64.RawURLEncoding.EncodeToString(hmacKey))
+	if err == nil || !strings.Contains(err.Error(), "rejected the external account binding") {
+		t.Errorf("RegisterWithEAB error: got %v, want EAB rejection", err)
+	}
+
+	if _, err := client.RegisterWithEAB("kid-1", "not base64!"); err == nil {
+		t.Errorf("Expected an invalid HMAC key to be rejected")
+	}
+}
+
+// slowDNSProvider simulates a DNS API with a per-request latency and
+// records how many calls to Present were in flight at the same time.
+type slowDNSProvider struct {
+	delay time.Duration
+	fail  string
+
+	mu        sync.Mutex
+	active    int
+	maxActive int
+	cleanedUp int
+}
+
+func (p *slowDNSProvider) Present(domain, token, keyAuth string) error {
+	p.mu.Lock()
+	p.active++
+	if p.active > p.maxActive {
+		p.maxActive = p.active
+	}
+	p.mu.Unlock()
+
+	time.Sleep(p.delay)
+
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+
+	if domain == p.fail {
+		return errors.New("Record could not be created")
+	}
+	return nil
+}
+
+func (p *slowDNSProvider) CleanUp(domain, token, keyAuth string) error {
+	p.mu.Lock()
+	p.cleanedUp++
+	p.mu.Unlock()
+	return nil
+}
+
 // stubValidate is like validate, except it does nothing.
 func stubValidate(j *jws, domain, uri string, chlng challenge) error {
 	return nil
 }
 
+// newTLSDirectoryServer serves a directory and nonces over HTTPS with a
+// certificate of its own CA.
+func newTLSDirectoryServer() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		writeJSONResponse(w, directory{
+			NewAuthzURL:   "https://test/new-authz",
+			NewCertURL:    "https://test/new-cert",
+			NewRegURL:     "https://test/new-reg",
+			RevokeCertURL: "https://test/revoke-cert",
+		})
+	}))
+}
+
+func TestClientCACertificates(t *testing.T) {
+	ts := newTLSDirectoryServer()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{privatekey: key}
+
+	if _, err := NewClient(ts.URL, user, 2048); err == nil {
+		t.Fatal("Expected the certificate of the test server to be untrusted")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	client, err := NewClient(ts.URL, user, 2048, WithCACertificates(pool))
+	if err != nil {
+		t.Fatalf("NewClient error with the test server's certificate trusted: got %v, want nil", err)
+	}
+	if client.directory.NewRegURL != "https://test/new-reg" {
+		t.Errorf("Unexpected directory %+v", client.directory)
+	}
+
+	// The pool belongs to that client only.
+	if _, err := NewClient(ts.URL, user, 2048); err == nil {
+		t.Error("Expected the CA certificates to apply to one client only")
+	}
+	if _, err := httpGetWith(providerHTTPClient, ts.URL); err == nil {
+		t.Error("Expected the CA certificates to apply to ACME requests only")
+	}
+
+	client.SetCACertificates(nil)
+	if _, err := client.jws.getNonce(); err == nil {
+		t.Error("Expected the system roots to be restored")
+	}
+}
+
+func TestClientInsecureSkipVerify(t *testing.T) {
+	ts := newTLSDirectoryServer()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	client, err := NewClient(ts.URL, mockUser{privatekey: key}, 2048, WithInsecureSkipVerify(true))
+	if err != nil {
+		t.Fatalf("NewClient error with verification disabled: got %v, want nil", err)
+	}
+	nonce, err := client.jws.getNonce()
+	if err != nil {
+		t.Fatalf("getNonce error with verification disabled: got %v, want nil", err)
+	}
+	if nonce != "12345" {
+		t.Errorf("Expected nonce 12345 but got %q", nonce)
+	}
+
+	client.SetInsecureSkipVerify(false)
+	if _, err := client.jws.getNonce(); err == nil {
+		t.Error("Expected verification to be enabled again")
+	}
+}
+
+func TestClientWithHTTPClient(t *testing.T) {
+	ts := newTLSDirectoryServer()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	client, err := NewClient(ts.URL, mockUser{privatekey: key}, 2048, WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatalf("NewClient error with the test server's client: got %v, want nil", err)
+	}
+	if client.jws.httpClient() != ts.Client() {
+		t.Error("Expected the client to be used for the ACME server")
+	}
+}
+
 type mockUser struct {
 	email      string
 	regres     *RegistrationResource
@@ -194,3 +850,1180 @@ type mockUser struct {
 func (u mockUser) GetEmail() string                       { return u.email }
 func (u mockUser) GetRegistration() *RegistrationResource { return u.regres }
 func (u mockUser) GetPrivateKey() *rsa.PrivateKey         { return u.privatekey }
+
+func TestCsrMessageValidityPeriod(t *testing.T) {
+	data, err := json.Marshal(newCsrMessage("csr", nil, ObtainOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "notBefore") || strings.Contains(string(data), "notAfter") {
+		t.Errorf("Expected no validity period by default, got %s", data)
+	}
+
+	notBefore := time.Date(2016, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	notAfter := notBefore.Add(7 * 24 * time.Hour)
+	data, err = json.Marshal(newCsrMessage("csr", nil, ObtainOptions{NotBefore: notBefore, NotAfter: notAfter}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"notBefore":"2016-05-01T10:00:00Z","notAfter":"2016-05-08T10:00:00Z"`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("Expected %s in the request, got %s", want, data)
+	}
+}
+
+func TestObtainOptionsValidate(t *testing.T) {
+	now := time.Now()
+	if err := (ObtainOptions{NotBefore: now, NotAfter: now.Add(time.Hour)}).validate(); err != nil {
+		t.Errorf("Expected a valid period, got %v", err)
+	}
+	if err := (ObtainOptions{NotBefore: now}).validate(); err != nil {
+		t.Errorf("Expected NotBefore alone to be valid, got %v", err)
+	}
+	if err := (ObtainOptions{NotBefore: now, NotAfter: now.Add(-time.Hour)}).validate(); err == nil {
+		t.Error("Expected an error for NotAfter before NotBefore")
+	}
+
+	client := &Client{}
+	_, failures := client.ObtainCertificateWithOptions([]string{"example.com"}, false, nil, ObtainOptions{NotBefore: now, NotAfter: now})
+	if failures["example.com"] == nil {
+		t.Error("Expected ObtainCertificateWithOptions to reject the validity period before contacting the CA")
+	}
+}
+
+func TestSolveChallengesWildcardAndApex(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, authorization{Status: "valid"})
+	}))
+	defer ts.Close()
+
+	provider := NewMockDNSProvider()
+	client := &Client{
+		solvers:        map[Challenge]solver{DNS01: &dnsChallenge{jws: &jws{privKey: key}, validate: stubValidate, provider: provider}},
+		dnsConcurrency: 4,
+	}
+
+	var authz []authorizationResource
+	for _, domain := range []string{"example.com", "*.example.com"} {
+		authz = append(authz, authorizationResource{
+			Domain:  domain,
+			AuthURL: ts.URL + "/" + domain,
+			Body: authorization{
+				Identifier:   identifier{Type: "dns", Value: domain},
+				Challenges:   []challenge{{Type: DNS01, Token: "token-" + domain}},
+				Combinations: [][]int{{0}},
+			},
+		})
+	}
+
+	if failures := client.solveChallenges(authz); len(failures) > 0 {
+		t.Fatalf("Expected no failures but got %v", failures)
+	}
+
+	calls := provider.Calls()
+	var ops []string
+	values := make(map[string]bool)
+	for _, call := range calls {
+		ops = append(ops, call.Op)
+		if call.Fqdn != "_acme-challenge.example.com." {
+			t.Errorf("Expected both domains to use _acme-challenge.example.com. but got %s", call.Fqdn)
+		}
+		values[call.Value] = true
+	}
+	if strings.Join(ops, ",") != "present,cleanup,present,cleanup" {
+		t.Errorf("Expected the apex and wildcard to be solved one after the other, got %v", ops)
+	}
+	if len(values) != 2 {
+		t.Errorf("Expected two distinct TXT values but got %d", len(values))
+	}
+}
+
+func TestSolveChallengesSkipsValidAuthorizations(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			writeJSONResponse(w, authorization{Status: "valid"})
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, _ := signed.Verify(&key.PublicKey)
+		var msg authorization
+		json.Unmarshal(payload, &msg)
+
+		// valid.example.com was authorized before, the server reuses it.
+		status := "pending"
+		if msg.Identifier.Value == "valid.example.com" {
+			status = "valid"
+		}
+		w.Header().Set("Link", "<"+ts.URL+"/new-cert>;rel=\"next\"")
+		w.Header().Set("Location", ts.URL+"/authz/"+msg.Identifier.Value)
+		writeJSONResponse(w, authorization{
+			Identifier:   msg.Identifier,
+			Status:       status,
+			Challenges:   []challenge{{Type: DNS01, Token: "token-" + msg.Identifier.Value}},
+			Combinations: [][]int{{0}},
+		})
+	}))
+	defer ts.Close()
+
+	provider := NewMockDNSProvider()
+	j := &jws{privKey: key, directoryURL: ts.URL}
+	client := &Client{
+		user:           mockUser{regres: &RegistrationResource{NewAuthzURL: ts.URL}, privatekey: key},
+		jws:            j,
+		solvers:        map[Challenge]solver{DNS01: &dnsChallenge{jws: j, validate: stubValidate, provider: provider}},
+		dnsConcurrency: 4,
+	}
+
+	authz, failures := client.getChallenges([]string{"valid.example.com", "pending.example.com"})
+	if len(failures) > 0 {
+		t.Fatalf("Expected no failures but got %v", failures)
+	}
+	if failures := client.solveChallenges(authz); len(failures) > 0 {
+		t.Fatalf("Expected no failures but got %v", failures)
+	}
+
+	for _, call := range provider.Calls() {
+		if call.Fqdn != "_acme-challenge.pending.example.com." {
+			t.Errorf("Expected only the pending authorization to be solved but got a %s for %s", call.Op, call.Fqdn)
+		}
+	}
+	if len(provider.Calls()) != 2 {
+		t.Errorf("Expected one Present and one CleanUp but got %d calls", len(provider.Calls()))
+	}
+}
+
+func TestSupportedChallenges(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	offers := map[string][]challenge{
+		"all.example.com": {{Type: HTTP01}, {Type: TLSSNI01}, {Type: DNS01}},
+		"dns.example.com": {{Type: DNS01}},
+		"dup.example.com": {{Type: HTTP01}, {Type: HTTP01}},
+		"new.example.com": {{Type: TLSALPN01}},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, _ := signed.Verify(&key.PublicKey)
+		var msg authorization
+		json.Unmarshal(payload, &msg)
+
+		chlngs, ok := offers[msg.Identifier.Value]
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSONResponse(w, RemoteError{Type: "urn:acme:error:unauthorized", Detail: "Policy forbids issuing for name"})
+			return
+		}
+		w.Header().Add("Link", `<http://example.com/new-cert>;rel="next"`)
+		w.Header().Set("Location", "http://example.com/authz/1")
+		w.WriteHeader(http.StatusCreated)
+		writeJSONResponse(w, authorization{Status: "pending", Identifier: msg.Identifier, Challenges: chlngs})
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		user: mockUser{email: "test@test.com", privatekey: key, regres: &RegistrationResource{NewAuthzURL: ts.URL}},
+		jws:  &jws{privKey: key, directoryURL: ts.URL},
+	}
+
+	tests := map[string]string{
+		"all.example.com": "[http-01 tls-sni-01 dns-01]",
+		"dns.example.com": "[dns-01]",
+		"dup.example.com": "[http-01]",
+		"new.example.com": "[tls-alpn-01]",
+	}
+	for domain, want := range tests {
+		types, err := client.SupportedChallenges(domain)
+		if err != nil {
+			t.Errorf("SupportedChallenges(%q) returned error: %v", domain, err)
+			continue
+		}
+		if got := fmt.Sprint(types); got != want {
+			t.Errorf("SupportedChallenges(%q): got %s, want %s", domain, got, want)
+		}
+	}
+
+	if _, err := client.SupportedChallenges("forbidden.example.com"); err == nil || !strings.Contains(err.Error(), "Policy forbids") {
+		t.Errorf("Expected the server error for a forbidden name, got %v", err)
+	}
+}
+
+func TestSetPostAsGet(t *testing.T) {
+	keyBits := 32 // small value keeps test fast
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	user := mockUser{
+		email:      "test@test.com",
+		regres:     new(RegistrationResource),
+		privatekey: key,
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(directory{NewAuthzURL: "http://test", NewCertURL: "http://test", NewRegURL: "http://test", RevokeCertURL: "http://test", NewNonceURL: "http://test/new-nonce"})
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(ts.URL, user, keyBits)
+	if err != nil {
+		t.Fatalf("Could not create client: %v", err)
+	}
+
+	if client.jws.usePostAsGet() {
+		t.Errorf("Expected plain GETs until the server refuses one")
+	}
+	client.SetPostAsGet(true)
+	if !client.jws.usePostAsGet() {
+		t.Errorf("Expected SetPostAsGet to enable POST-as-GET")
+	}
+}
+
+func TestPollAuthorizationPostAsGet(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	// The server only hands out resources for POST-as-GET requests.
+	var gets int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		switch r.Method {
+		case "HEAD":
+			return
+		case "POST":
+		default:
+			gets++
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			writeJSONResponse(w, RemoteError{Type: "urn:ietf:params:acme:error:malformed", Detail: "Method not allowed"})
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, err := signed.Verify(&key.PublicKey)
+		if err != nil {
+			t.Fatalf("Could not verify JWS: %v", err)
+		}
+		if len(payload) != 0 {
+			t.Errorf("Expected an empty POST-as-GET payload but got %q", payload)
+		}
+		writeJSONResponse(w, authorization{Status: "valid"})
+	}))
+	defer ts.Close()
+
+	// The refused plain GET is retried as POST-as-GET, which is then used
+	// for all later requests.
+	j := &jws{privKey: key, directoryURL: ts.URL}
+	for i := 0; i < 2; i++ {
+		status, err := pollAuthorization(j, ts.URL, time.Second)
+		if err != nil {
+			t.Fatalf("pollAuthorization error: got %v, want nil", err)
+		}
+		if status != "valid" {
+			t.Errorf("pollAuthorization: got status %q, want \"valid\"", status)
+		}
+	}
+	if gets != 1 {
+		t.Errorf("Expected one plain GET before switching to POST-as-GET, got %d", gets)
+	}
+	if !j.usePostAsGet() {
+		t.Errorf("Expected the client to switch to POST-as-GET")
+	}
+
+	gets = 0
+	if _, err := pollAuthorization(&jws{privKey: key, directoryURL: ts.URL, postAsGet: true}, ts.URL, time.Second); err != nil {
+		t.Fatalf("pollAuthorization error: got %v, want nil", err)
+	}
+	if gets != 0 {
+		t.Errorf("Expected no plain GET with POST-as-GET enabled, got %d", gets)
+	}
+}
+
+func TestRequestCertificatePreferredChain(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	pemCert := func(cn string) []byte {
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal("Could not generate test certificate:", err)
+		}
+		return pemEncode(derCertificateBytes(der))
+	}
+	leaf := pemCert("www.example.com")
+	defaultRoot := pemCert("Default Root")
+	alternateRoot := pemCert("ISRG Root X1")
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/new-cert":
+			w.Header().Set("Location", ts.URL+"/cert/1")
+			w.Header().Add("Link", "<"+ts.URL+"/cert/1/gone>;rel=\"alternate\"")
+			w.Header().Add("Link", "<"+ts.URL+"/cert/1/alt>;rel=\"alternate\"")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(append(append([]byte{}, leaf...), defaultRoot...))
+		case r.URL.Path == "/cert/1/alt":
+			w.Write(append(append([]byte{}, leaf...), alternateRoot...))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{jws: &jws{privKey: key, directoryURL: ts.URL}}
+	authz := []authorizationResource{{Domain: "www.example.com", NewCertURL: ts.URL + "/new-cert"}}
+
+	tests := []struct {
+		preferred string
+		issuer    []byte
+	}{
+		{"", defaultRoot},
+		{"Default Root", defaultRoot},
+		{"ISRG Root X1", alternateRoot},
+		{"Unknown Root", defaultRoot},
+	}
+	for _, tt := range tests {
+		cert, err := client.requestCertificate(authz, true, key, ObtainOptions{PreferredChain: tt.preferred})
+		if err != nil {
+			t.Fatalf("requestCertificate error: got %v, want nil", err)
+		}
+		if !bytes.Equal(cert.IssuerCertificate, tt.issuer) {
+			t.Errorf("PreferredChain %q: got issuer chain %q", tt.preferred, cert.IssuerCertificate)
+		}
+		if expected := append(append([]byte{}, leaf...), tt.issuer...); !bytes.Equal(cert.Certificate, expected) {
+			t.Errorf("PreferredChain %q: expected the bundle to hold the leaf and the selected chain", tt.preferred)
+		}
+	}
+}
+
+func TestRequestCertificateKeyType(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	certDER, err := generateDerCert(key, time.Now().Add(time.Hour), "example.com")
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+
+	var sentCsr []byte
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" || r.URL.Path != "/new-cert" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, _ := signed.Verify(&key.PublicKey)
+		var msg csrMessage
+		json.Unmarshal(payload, &msg)
+		sentCsr, _ = base64.URLEncoding.DecodeString(msg.Csr)
+
+		w.Header().Set("Location", ts.URL+"/cert/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(pemEncode(derCertificateBytes(certDER)))
+	}))
+	defer ts.Close()
+
+	client := &Client{jws: &jws{privKey: key, directoryURL: ts.URL}, keyBits: 1024}
+	authz := []authorizationResource{{Domain: "example.com", NewCertURL: ts.URL + "/new-cert"}}
+
+	tests := []struct {
+		keyType KeyType
+		algo    x509.PublicKeyAlgorithm
+		size    int
+	}{
+		{"", x509.RSA, 1024},
+		{RSA2048, x509.RSA, 2048},
+		{RSA4096, x509.RSA, 4096},
+		{EC256, x509.ECDSA, 256},
+		{EC384, x509.ECDSA, 384},
+	}
+	for _, tt := range tests {
+		cert, err := client.requestCertificate(authz, false, nil, ObtainOptions{KeyType: tt.keyType})
+		if err != nil {
+			t.Fatalf("KeyType %q: requestCertificate error: got %v, want nil", tt.keyType, err)
+		}
+
+		csr, err := x509.ParseCertificateRequest(sentCsr)
+		if err != nil {
+			t.Fatalf("KeyType %q: could not parse the sent CSR: %v", tt.keyType, err)
+		}
+		if err := csr.CheckSignature(); err != nil {
+			t.Errorf("KeyType %q: invalid CSR signature: %v", tt.keyType, err)
+		}
+		if csr.PublicKeyAlgorithm != tt.algo {
+			t.Errorf("KeyType %q: got CSR key algorithm %v, want %v", tt.keyType, csr.PublicKeyAlgorithm, tt.algo)
+		}
+
+		privKey, err := parsePEMPrivateKey(cert.PrivateKey)
+		if err != nil {
+			t.Fatalf("KeyType %q: could not parse the private key: %v", tt.keyType, err)
+		}
+		var size int
+		switch privKey := privKey.(type) {
+		case *rsa.PrivateKey:
+			size = privKey.N.BitLen()
+		case *ecdsa.PrivateKey:
+			size = privKey.Curve.Params().BitSize
+		}
+		if size != tt.size {
+			t.Errorf("KeyType %q: got a %T of %d bits, want %d bits", tt.keyType, privKey, size, tt.size)
+		}
+	}
+}
+
+func TestObtainOptionsKeyTypeValidate(t *testing.T) {
+	if err := (ObtainOptions{KeyType: EC256}).validate(); err != nil {
+		t.Errorf("Expected EC256 to be valid, got %v", err)
+	}
+	if err := (ObtainOptions{KeyType: "dsa1024"}).validate(); err == nil {
+		t.Error("Expected an error for an unsupported key type")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	client := &Client{}
+	_, failures := client.ObtainCertificateWithOptions([]string{"example.com"}, false, key, ObtainOptions{KeyType: EC384})
+	if failures["example.com"] == nil {
+		t.Error("Expected ObtainCertificateWithOptions to reject a private key of another type before contacting the CA")
+	}
+}
+
+func TestRequestCertificateBundle(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	leafDER, err := generateDerCert(key, time.Now().Add(time.Hour), "www.example.com")
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	issuerDER, err := generateDerCert(key, time.Now().Add(time.Hour), "Test Issuer")
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	leaf := pemEncode(derCertificateBytes(leafDER))
+	issuer := pemEncode(derCertificateBytes(issuerDER))
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method == "POST" && r.URL.Path == "/new-cert" {
+			w.Header().Set("Location", ts.URL+"/cert/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(append(append([]byte{}, leaf...), issuer...))
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{jws: &jws{privKey: key, directoryURL: ts.URL}}
+	authz := []authorizationResource{{Domain: "www.example.com", NewCertURL: ts.URL + "/new-cert"}}
+
+	for _, bundle := range []bool{true, false} {
+		cert, err := client.requestCertificate(authz, bundle, key, ObtainOptions{})
+		if err != nil {
+			t.Fatalf("requestCertificate error: got %v, want nil", err)
+		}
+
+		expected := leaf
+		if bundle {
+			expected = append(append([]byte{}, leaf...), issuer...)
+		}
+		if !bytes.Equal(cert.Certificate, expected) {
+			t.Errorf("bundle %t: got certificate %q, want %q", bundle, cert.Certificate, expected)
+		}
+		if !bytes.Equal(cert.IssuerCertificate, issuer) {
+			t.Errorf("bundle %t: got issuer certificate %q, want %q", bundle, cert.IssuerCertificate, issuer)
+		}
+	}
+}
+
+func TestObtainForCSR(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	csrDER, err := generateCsr(key, "example.com", []string{"example.com", "www.example.com", "mail.example.com"}, false)
+	if err != nil {
+		t.Fatal("Could not generate test CSR:", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatal("Could not parse test CSR:", err)
+	}
+
+	certDER, err := generateDerCert(key, time.Now().Add(time.Hour), "example.com")
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	issuedCert := pemEncode(derCertificateBytes(certDER))
+
+	var mu sync.Mutex
+	var authorized []string
+	var sentCsr []byte
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, _ := signed.Verify(&key.PublicKey)
+
+		switch r.URL.Path {
+		case "/new-authz":
+			var msg authorization
+			json.Unmarshal(payload, &msg)
+			mu.Lock()
+			authorized = append(authorized, msg.Identifier.Value)
+			mu.Unlock()
+
+			w.Header().Set("Link", "<"+ts.URL+"/new-cert>;rel=\"next\"")
+			w.Header().Set("Location", ts.URL+"/authz/"+msg.Identifier.Value)
+			writeJSONResponse(w, authorization{Identifier: msg.Identifier, Status: "valid"})
+		case "/new-cert":
+			var msg csrMessage
+			json.Unmarshal(payload, &msg)
+			sentCsr, _ = base64.URLEncoding.DecodeString(msg.Csr)
+
+			w.Header().Set("Location", ts.URL+"/cert/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(issuedCert)
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		user: mockUser{regres: &RegistrationResource{NewAuthzURL: ts.URL + "/new-authz"}, privatekey: key},
+		jws:  &jws{privKey: key, directoryURL: ts.URL},
+	}
+
+	cert, err := client.ObtainForCSR(csr)
+	if err != nil {
+		t.Fatalf("ObtainForCSR error: got %v, want nil", err)
+	}
+
+	sort.Strings(authorized)
+	if expected := []string{"example.com", "mail.example.com", "www.example.com"}; strings.Join(authorized, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected authorizations for %v but got %v", expected, authorized)
+	}
+	if !bytes.Equal(sentCsr, csrDER) {
+		t.Errorf("Expected the CSR to be sent as is")
+	}
+	if cert.Domain != "example.com" || !bytes.Equal(cert.Certificate, issuedCert) || cert.PrivateKey != nil {
+		t.Errorf("Unexpected certificate resource %+v", cert)
+	}
+
+	if _, err := client.ObtainForCSR(&x509.CertificateRequest{}); err == nil {
+		t.Errorf("Expected an error for a CSR without domains")
+	}
+}
+
+func TestObtainCertificateIPAddresses(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	certDER, err := generateDerCert(key, time.Now().Add(time.Hour), "example.com")
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	issuedCert := pemEncode(derCertificateBytes(certDER))
+
+	var mu sync.Mutex
+	identifiers := make(map[string]string)
+	var sentCsr []byte
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, _ := signed.Verify(&key.PublicKey)
+
+		switch r.URL.Path {
+		case "/new-authz":
+			var msg authorization
+			json.Unmarshal(payload, &msg)
+			mu.Lock()
+			identifiers[msg.Identifier.Value] = msg.Identifier.Type
+			mu.Unlock()
+
+			w.Header().Set("Link", "<"+ts.URL+"/new-cert>;rel=\"next\"")
+			w.Header().Set("Location", ts.URL+"/authz/1")
+			writeJSONResponse(w, authorization{Identifier: msg.Identifier, Status: "valid"})
+		case "/new-cert":
+			var msg csrMessage
+			json.Unmarshal(payload, &msg)
+			sentCsr, _ = base64.URLEncoding.DecodeString(msg.Csr)
+
+			w.Header().Set("Location", ts.URL+"/cert/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(issuedCert)
+		}
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		directory: directory{Meta: directoryMeta{IdentifierTypes: []string{"dns", "ip"}}},
+		user:      mockUser{regres: &RegistrationResource{NewAuthzURL: ts.URL + "/new-authz"}, privatekey: key},
+		jws:       &jws{privKey: key, directoryURL: ts.URL},
+		keyBits:   512,
+	}
+
+	_, failures := client.ObtainCertificate([]string{"192.0.2.1", "example.com", "2001:db8::1"}, false, nil)
+	if len(failures) > 0 {
+		t.Fatalf("ObtainCertificate failures: got %v, want none", failures)
+	}
+
+	expected := map[string]string{"192.0.2.1": "ip", "example.com": "dns", "2001:db8::1": "ip"}
+	if len(identifiers) != len(expected) {
+		t.Errorf("Expected identifiers %v but got %v", expected, identifiers)
+	}
+	for value, typ := range expected {
+		if identifiers[value] != typ {
+			t.Errorf("Expected identifier %s to be of type %q but got %q", value, typ, identifiers[value])
+		}
+	}
+
+	csr, err := x509.ParseCertificateRequest(sentCsr)
+	if err != nil {
+		t.Fatalf("Could not parse the sent CSR: %v", err)
+	}
+	if csr.Subject.CommonName != "" {
+		t.Errorf("Expected no CommonName for an IP address but got %q", csr.Subject.CommonName)
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "example.com" {
+		t.Errorf("Expected the DNS SANs [example.com] but got %v", csr.DNSNames)
+	}
+	if len(csr.IPAddresses) != 2 || !csr.IPAddresses[0].Equal(net.ParseIP("192.0.2.1")) || !csr.IPAddresses[1].Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("Expected the IP SANs [192.0.2.1 2001:db8::1] but got %v", csr.IPAddresses)
+	}
+	if domains := csrDomains(csr); strings.Join(domains, ",") != "example.com,192.0.2.1,2001:db8::1" {
+		t.Errorf("Expected the CSR domains example.com,192.0.2.1,2001:db8::1 but got %v", domains)
+	}
+}
+
+func TestObtainCertificateIPAddressesUnsupported(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request to %s", r.URL.Path)
+	}))
+	defer ts.Close()
+
+	client := &Client{
+		user: mockUser{regres: &RegistrationResource{NewAuthzURL: ts.URL + "/new-authz"}, privatekey: key},
+		jws:  &jws{privKey: key, directoryURL: ts.URL},
+	}
+
+	_, failures := client.ObtainCertificate([]string{"example.com", "192.0.2.1", "2001:db8::1"}, false, nil)
+	if len(failures) != 2 {
+		t.Fatalf("Expected failures for both IP addresses but got %v", failures)
+	}
+	for _, ip := range []string{"192.0.2.1", "2001:db8::1"} {
+		if failures[ip] != errIPIdentifierUnsupported {
+			t.Errorf("Expected %v for %s but got %v", errIPIdentifierUnsupported, ip, failures[ip])
+		}
+	}
+}
+
+type stubSelector struct {
+	chlng Challenge
+	err   error
+}
+
+func (s stubSelector) Select(domain string, available []Challenge) (Challenge, error) {
+	return s.chlng, s.err
+}
+
+type stubSolver struct{}
+
+func (stubSolver) Solve(chlng challenge, domain string) error { return nil }
+
+func TestDefaultChallengeSelector(t *testing.T) {
+	available := []Challenge{TLSSNI01, HTTP01, DNS01}
+	cases := []struct {
+		domain    string
+		available []Challenge
+		want      Challenge
+	}{
+		{"example.com", available, HTTP01},
+		{"*.example.com", available, DNS01},
+		{"example.com", []Challenge{TLSSNI01, DNS01}, TLSSNI01},
+	}
+	for _, c := range cases {
+		got, err := DefaultChallengeSelector{}.Select(c.domain, c.available)
+		if err != nil {
+			t.Errorf("Select(%q, %v): unexpected error %v", c.domain, c.available, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Select(%q, %v) = %s, want %s", c.domain, c.available, got, c.want)
+		}
+	}
+
+	if _, err := (DefaultChallengeSelector{}).Select("example.com", nil); err == nil {
+		t.Error("Expected an error when no challenge types are available")
+	}
+}
+
+func TestChooseSolversCustomSelector(t *testing.T) {
+	auth := authorization{
+		Challenges:   []challenge{{Type: HTTP01}, {Type: TLSALPN01}},
+		Combinations: [][]int{{0}, {1}},
+	}
+	client := &Client{solvers: map[Challenge]solver{HTTP01: &httpChallenge{}, TLSALPN01: stubSolver{}}}
+
+	solvers, err := client.chooseSolvers(auth, "example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := solvers[0]; !ok || len(solvers) != 1 {
+		t.Errorf("Expected the default selector to pick http-01, got %v", solvers)
+	}
+
+	client.SetChallengeSelector(stubSelector{chlng: TLSALPN01})
+	solvers, err = client.chooseSolvers(auth, "example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := solvers[1]; !ok || len(solvers) != 1 {
+		t.Errorf("Expected the custom selector to pick tls-alpn-01, got %v", solvers)
+	}
+}
+
+func TestChooseSolversFallsBack(t *testing.T) {
+	// http-01 is only offered together with dns-01, which has no solver.
+	auth := authorization{
+		Challenges:   []challenge{{Type: HTTP01}, {Type: DNS01}, {Type: TLSALPN01}},
+		Combinations: [][]int{{0, 1}, {2}},
+	}
+	client := &Client{
+		solvers:  map[Challenge]solver{HTTP01: &httpChallenge{}, TLSALPN01: stubSolver{}},
+		selector: stubSelector{chlng: HTTP01},
+	}
+
+	solvers, err := client.chooseSolvers(auth, "example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := solvers[2]; !ok || len(solvers) != 1 {
+		t.Errorf("Expected to fall back to tls-alpn-01, got %v", solvers)
+	}
+}
+
+func TestSolveChallengesSelectorError(t *testing.T) {
+	client := &Client{
+		solvers:  map[Challenge]solver{HTTP01: &httpChallenge{}},
+		selector: stubSelector{err: errors.New("no acceptable challenge")},
+	}
+	authz := []authorizationResource{{
+		Domain: "example.com",
+		Body: authorization{
+			Challenges:   []challenge{{Type: HTTP01}},
+			Combinations: [][]int{{0}},
+		},
+	}}
+
+	failures := client.solveChallenges(authz)
+	err := failures["example.com"]
+	if err == nil || !strings.Contains(err.Error(), "no acceptable challenge") {
+		t.Errorf("Expected the selector error to be reported, got %v", err)
+	}
+}
+
+// batchMockDNSProvider adds batch calls to MockDNSProvider.
+type batchMockDNSProvider struct {
+	*MockDNSProvider
+
+	mu      sync.Mutex
+	ops     []string
+	batches [][]DNSChallengeRecord
+}
+
+func (b *batchMockDNSProvider) PresentBatch(records []DNSChallengeRecord) error {
+	b.recordBatch("present", records)
+	return nil
+}
+
+func (b *batchMockDNSProvider) CleanUpBatch(records []DNSChallengeRecord) error {
+	b.recordBatch("cleanup", records)
+	return nil
+}
+
+func (b *batchMockDNSProvider) recordBatch(op string, records []DNSChallengeRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ops = append(b.ops, op)
+	b.batches = append(b.batches, records)
+}
+
+func dnsTestAuthorizations(domains ...string) []authorizationResource {
+	var authz []authorizationResource
+	for _, domain := range domains {
+		authz = append(authz, authorizationResource{
+			Domain: domain,
+			Body: authorization{
+				Challenges:   []challenge{{Type: DNS01, Token: "token-" + domain}},
+				Combinations: [][]int{{0}},
+			},
+		})
+	}
+	return authz
+}
+
+func TestSolveChallengesBatchDNSProvider(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	provider := &batchMockDNSProvider{MockDNSProvider: NewMockDNSProvider()}
+	var validated []string
+	validate := func(j *jws, domain, uri string, chlng challenge) error {
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		if len(provider.ops) != 1 {
+			t.Errorf("Expected %s to be validated after the records were presented, got %v", domain, provider.ops)
+		}
+		validated = append(validated, domain)
+		return nil
+	}
+
+	j := &jws{privKey: key}
+	client := &Client{
+		jws:            j,
+		solvers:        map[Challenge]solver{DNS01: &dnsChallenge{jws: j, validate: validate, provider: provider}},
+		dnsConcurrency: 4,
+	}
+
+	domains := []string{"example.com", "*.example.com", "www.example.com"}
+	if failures := client.solveChallenges(dnsTestAuthorizations(domains...)); len(failures) > 0 {
+		t.Fatalf("Expected no failures but got %v", failures)
+	}
+
+	if calls := provider.Calls(); len(calls) > 0 {
+		t.Errorf("Expected no single record calls but got %v", calls)
+	}
+	if strings.Join(provider.ops, ",") != "present,cleanup" {
+		t.Fatalf("Expected one present and one cleanup batch but got %v", provider.ops)
+	}
+	for i, batch := range provider.batches {
+		var got []string
+		for _, rec := range batch {
+			got = append(got, rec.Domain)
+			if rec.Token != "token-"+rec.Domain || rec.KeyAuth == "" {
+				t.Errorf("Unexpected record %+v", rec)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(domains, ",") {
+			t.Errorf("Expected %s batch for %v but got %v", provider.ops[i], domains, got)
+		}
+	}
+
+	sort.Strings(validated)
+	if expected := []string{"*.example.com", "example.com", "www.example.com"}; strings.Join(validated, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v to be validated but got %v", expected, validated)
+	}
+}
+
+func TestSolveChallengesDNSProviderWithoutBatch(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	provider := NewMockDNSProvider()
+	j := &jws{privKey: key}
+	client := &Client{
+		jws:            j,
+		solvers:        map[Challenge]solver{DNS01: &dnsChallenge{jws: j, validate: stubValidate, provider: provider}},
+		dnsConcurrency: 4,
+	}
+
+	if failures := client.solveChallenges(dnsTestAuthorizations("example.com", "www.example.com")); len(failures) > 0 {
+		t.Fatalf("Expected no failures but got %v", failures)
+	}
+
+	counts := make(map[string]int)
+	for _, call := range provider.Calls() {
+		counts[call.Op+" "+call.Domain]++
+	}
+	expected := map[string]int{
+		"present example.com": 1, "cleanup example.com": 1,
+		"present www.example.com": 1, "cleanup www.example.com": 1,
+	}
+	if fmt.Sprint(counts) != fmt.Sprint(expected) {
+		t.Errorf("Expected one Present and CleanUp call per record, got %v", counts)
+	}
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var posts int
+	var msg map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+		posts++
+		if r.URL.Path != "/reg/1" {
+			t.Errorf("Expected a request to the account URL but got %s", r.URL.Path)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		payload, err := signed.Verify(&key.PublicKey)
+		if err != nil {
+			t.Fatalf("JWS is not signed by the account key: %v", err)
+		}
+		json.Unmarshal(payload, &msg)
+		writeJSONResponse(w, Registration{ID: 1, Status: "deactivated"})
+	}))
+	defer ts.Close()
+
+	reg := &RegistrationResource{URI: ts.URL + "/reg/1", NewAuthzURL: ts.URL + "/new-authz"}
+	client := &Client{
+		user: mockUser{regres: reg, privatekey: key},
+		jws:  &jws{privKey: key, directoryURL: ts.URL},
+	}
+
+	if err := client.DeactivateAccount(); err != nil {
+		t.Fatalf("DeactivateAccount error: got %v, want nil", err)
+	}
+	if msg["status"] != "deactivated" || msg["resource"] != "reg" {
+		t.Errorf("Unexpected deactivation payload %v", msg)
+	}
+	if reg.Body.Status != "deactivated" {
+		t.Errorf("Expected the registration to be marked deactivated, got %q", reg.Body.Status)
+	}
+
+	// The account is not used any more, not even to deactivate it again.
+	if err := client.DeactivateAccount(); err != nil {
+		t.Errorf("Expected deactivating twice to succeed, got %v", err)
+	}
+	if _, failures := client.ObtainCertificate([]string{"example.com"}, false, nil); failures["example.com"] != errAccountDeactivated {
+		t.Errorf("Expected ObtainCertificate to fail with %v, got %v", errAccountDeactivated, failures)
+	}
+	if err := client.AgreeToTOS(); err != errAccountDeactivated {
+		t.Errorf("Expected AgreeToTOS to fail with %v, got %v", errAccountDeactivated, err)
+	}
+	if posts != 1 {
+		t.Errorf("Expected a single request to the server but got %d", posts)
+	}
+}
+
+func TestDeactivateAccountAlreadyDeactivated(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	status := http.StatusForbidden
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		if r.Method != "POST" {
+			return
+		}
+		w.WriteHeader(status)
+		writeJSONResponse(w, RemoteError{Type: "urn:acme:error:unauthorized", Detail: "Registration is not valid, has status 'deactivated'"})
+	}))
+	defer ts.Close()
+
+	reg := &RegistrationResource{URI: ts.URL + "/reg/1"}
+	client := &Client{
+		user: mockUser{regres: reg, privatekey: key},
+		jws:  &jws{privKey: key, directoryURL: ts.URL},
+	}
+
+	if err := client.DeactivateAccount(); err != nil {
+		t.Fatalf("DeactivateAccount error: got %v, want nil", err)
+	}
+	if reg.Body.Status != "deactivated" {
+		t.Errorf("Expected the registration to be marked deactivated, got %q", reg.Body.Status)
+	}
+
+	// Any other error is returned.
+	reg.Body.Status = ""
+	status = http.StatusInternalServerError
+	if err := client.DeactivateAccount(); err == nil {
+		t.Error("Expected an error for a failed deactivation")
+	}
+	if reg.Body.Status != "" {
+		t.Errorf("Expected the registration to be unchanged, got %q", reg.Body.Status)
+	}
+
+	client.user = mockUser{regres: &RegistrationResource{}, privatekey: key}
+	if err := client.DeactivateAccount(); err == nil {
+		t.Error("Expected an error for an unregistered account")
+	}
+}
+
+// newProcessingCertServer serves a certificate request which is only issued
+// after the certificate URL has been polled pending times. Retry-After is
+// sent with every pending response if set.
+func newProcessingCertServer(cert []byte, pending int, retryAfter string) (*httptest.Server, *int32) {
+	var polls int32
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/new-cert":
+			w.Header().Set("Location", ts.URL+"/cert/1")
+		case r.Method == "GET" && r.URL.Path == "/cert/1":
+			if int(atomic.AddInt32(&polls, 1)) > pending {
+				w.Write(cert)
+				return
+			}
+		default:
+			return
+		}
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return ts, &polls
+}
+
+func TestRequestCertificatePolling(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	certDER, err := generateDerCert(key, time.Now().Add(time.Hour), "example.com")
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	issuedCert := pemEncode(derCertificateBytes(certDER))
+
+	request := func(ts *httptest.Server, client *Client) (CertificateResource, error) {
+		authz := []authorizationResource{{Domain: "example.com", NewCertURL: ts.URL + "/new-cert"}}
+		return client.requestCertificateForCsr(authz, false, []byte("csr"), nil, ObtainOptions{})
+	}
+
+	// The certificate is issued after three polls.
+	ts, polls := newProcessingCertServer(issuedCert, 3, "")
+	defer ts.Close()
+	client := &Client{jws: &jws{privKey: key, directoryURL: ts.URL}}
+	client.SetOrderPollInterval(10 * time.Millisecond)
+
+	start := time.Now()
+	cert, err := request(ts, client)
+	if err != nil {
+		t.Fatalf("requestCertificateForCsr error: got %v, want nil", err)
+	}
+	if !bytes.Equal(cert.Certificate, issuedCert) {
+		t.Errorf("Expected the issued certificate but got %q", cert.Certificate)
+	}
+	if got := atomic.LoadInt32(polls); got != 4 {
+		t.Errorf("Expected 4 polls but got %d", got)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected the client to wait between polls, took %s", elapsed)
+	}
+
+	// Retry-After takes precedence over the poll interval.
+	ts2, _ := newProcessingCertServer(issuedCert, 2, "0")
+	defer ts2.Close()
+	client = &Client{jws: &jws{privKey: key, directoryURL: ts2.URL}}
+	client.SetOrderPollInterval(time.Hour)
+	if _, err := request(ts2, client); err != nil {
+		t.Fatalf("requestCertificateForCsr error: got %v, want nil", err)
+	}
+
+	// The client gives up after the order timeout.
+	ts3, _ := newProcessingCertServer(issuedCert, 1000, "")
+	defer ts3.Close()
+	client = &Client{jws: &jws{privKey: key, directoryURL: ts3.URL}}
+	client.SetOrderPollInterval(10 * time.Millisecond)
+	client.SetOrderTimeout(50 * time.Millisecond)
+	if _, err := request(ts3, client); err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
-//	"crypto/elliptic"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/pem"
@@ -17,6 +18,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math/big"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -201,6 +203,34 @@ func parsePEMBundle(bundle []byte) ([]*x509.Certificate, error) {
 	return certificates, nil
 }
 
+// splitPEMChain splits a PEM encoded certificate chain into the first
+// certificate, which is the issued one, and the remaining issuer chain.
+// Both are returned PEM encoded.
+func splitPEMChain(chain []byte) (cert, issuer []byte, err error) {
+	var block *pem.Block
+	for {
+		block, chain = pem.Decode(chain)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		if cert == nil {
+			cert = pem.EncodeToMemory(block)
+		} else {
+			issuer = append(issuer, pem.EncodeToMemory(block)...)
+		}
+	}
+
+	if cert == nil {
+		return nil, nil, errors.New("No certificates were found while parsing the chain.")
+	}
+
+	return cert, issuer, nil
+}
+
 func parsePEMPrivateKey(key []byte) (crypto.PrivateKey, error) {
 	keyBlock, _ := pem.Decode(key)
 
@@ -214,10 +244,64 @@ func parsePEMPrivateKey(key []byte) (crypto.PrivateKey, error) {
 	}
 }
 
+// KeyType selects the algorithm and size of the private key generated for a
+// certificate.
+type KeyType string
+
+// The supported certificate key types. The zero KeyType generates an RSA key
+// of the size the Client was created with.
+const (
+	RSA2048 KeyType = "rsa2048"
+	RSA4096 KeyType = "rsa4096"
+	EC256   KeyType = "ec256"
+	EC384   KeyType = "ec384"
+)
+
+// params returns the keyType and length generatePrivateKey takes for k.
+func (k KeyType) params() (keyType, int, error) {
+	switch k {
+	case RSA2048:
+		return rsakey, 2048, nil
+	case RSA4096:
+		return rsakey, 4096, nil
+	case EC256:
+		return eckey, 256, nil
+	case EC384:
+		return eckey, 384, nil
+	}
+	return 0, 0, fmt.Errorf("Unsupported key type %q", string(k))
+}
+
+// matches reports an error unless key is a private key of type k.
+func (k KeyType) matches(key crypto.PrivateKey) error {
+	t, length, err := k.params()
+	if err != nil {
+		return err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if t == rsakey && key.N.BitLen() == length {
+			return nil
+		}
+	case *ecdsa.PrivateKey:
+		if t == eckey && key.Curve.Params().BitSize == length {
+			return nil
+		}
+	}
+	return fmt.Errorf("The private key does not match the requested key type %q", string(k))
+}
+
 func generatePrivateKey(t keyType, keyLength int) (crypto.PrivateKey, error) {
 	switch t {
-//	case eckey:
-//		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case eckey:
+		switch keyLength {
+		case 256:
+			return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		case 384:
+			return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		}
+		return nil, fmt.Errorf("Invalid EC key length: %d", keyLength)
 	case rsakey:
 		return rsa.GenerateKey(rand.Reader, keyLength)
 	}
@@ -225,26 +309,63 @@ func generatePrivateKey(t keyType, keyLength int) (crypto.PrivateKey, error) {
 	return nil, fmt.Errorf("Invalid keytype: %d", t)
 }
 
-func generateCsr(privateKey *rsa.PrivateKey, domain string, san []string) ([]byte, error) {
-	template := x509.CertificateRequest{
-		Subject: pkix.Name{
-			CommonName: domain,
-		},
+// tlsFeatureExtensionOID is the OID of the TLS Feature extension (RFC 7633).
+var tlsFeatureExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// ocspMustStapleFeature is the DER encoded TLS Feature sequence containing
+// only the status_request feature, i.e. OCSP Must-Staple.
+var ocspMustStapleFeature = []byte{0x30, 0x03, 0x02, 0x01, 0x05}
+
+func generateCsr(privateKey crypto.Signer, domain string, san []string, mustStaple bool) ([]byte, error) {
+	template := x509.CertificateRequest{}
+
+	// IP addresses are only allowed in iPAddress SANs, never in the
+	// CommonName or in dNSName SANs.
+	if ip := net.ParseIP(domain); ip != nil {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else {
+		template.Subject.CommonName = domain
 	}
 
-	if len(san) > 0 {
-		template.DNSNames = san
+	for _, name := range san {
+		ip := net.ParseIP(name)
+		switch {
+		case ip == nil:
+			template.DNSNames = append(template.DNSNames, name)
+		case !containsIP(template.IPAddresses, ip):
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
+
+	if mustStaple {
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:    tlsFeatureExtensionOID,
+			Value: ocspMustStapleFeature,
+		})
 	}
 
 	return x509.CreateCertificateRequest(rand.Reader, &template, privateKey)
 }
 
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 func pemEncode(data interface{}) []byte {
 	var pemBlock *pem.Block
 	switch key := data.(type) {
 	case *rsa.PrivateKey:
 		pemBlock = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
 		break
+	case *ecdsa.PrivateKey:
+		// Marshalling only fails for curves generatePrivateKey never uses.
+		der, _ := x509.MarshalECPrivateKey(key)
+		pemBlock = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
 	case derCertificateBytes:
 		pemBlock = &pem.Block{Type: "CERTIFICATE", Bytes: []byte(data.(derCertificateBytes))}
 	}
@@ -281,6 +402,21 @@ func GetPEMCertExpiration(cert []byte) (time.Time, error) {
 	return getCertExpiration(pemBlock.Bytes)
 }
 
+// DefaultRenewalWindow is the time before expiry at which certificates are renewed.
+const DefaultRenewalWindow = 30 * 24 * time.Hour
+
+// timeNow is the clock used for renewal decisions. Tests replace it.
+var timeNow = time.Now
+
+// NeedsRenewal reports whether cert expires within window, or already has.
+// A window of zero or less uses DefaultRenewalWindow.
+func NeedsRenewal(cert *x509.Certificate, window time.Duration) bool {
+	if window <= 0 {
+		window = DefaultRenewalWindow
+	}
+	return !timeNow().Add(window).Before(cert.NotAfter)
+}
+
 // getCertExpiration returns the "NotAfter" date of a DER encoded certificate.
 func getCertExpiration(cert []byte) (time.Time, error) {
 	pCert, err := x509.ParseCertificate(cert)
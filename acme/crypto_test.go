@@ -2,7 +2,11 @@ package acme
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/x509"
+	"net/http"
 	"testing"
 	"time"
 )
@@ -23,7 +27,7 @@ func TestGenerateCSR(t *testing.T) {
 		t.Fatal("Error generating private key:", err)
 	}
 
-	csr, err := generateCsr(key.(*rsa.PrivateKey), "fizz.buzz", nil)
+	csr, err := generateCsr(key.(*rsa.PrivateKey), "fizz.buzz", nil, false)
 	if err != nil {
 		t.Error("Error generating CSR:", err)
 	}
@@ -32,6 +36,37 @@ func TestGenerateCSR(t *testing.T) {
 	}
 }
 
+func TestGenerateCSRMustStaple(t *testing.T) {
+	key, err := generatePrivateKey(rsakey, 512)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	for _, mustStaple := range []bool{false, true} {
+		der, err := generateCsr(key.(*rsa.PrivateKey), "fizz.buzz", nil, mustStaple)
+		if err != nil {
+			t.Fatal("Error generating CSR:", err)
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil {
+			t.Fatal("Error parsing CSR:", err)
+		}
+
+		var found bool
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(tlsFeatureExtensionOID) {
+				found = true
+				if !bytes.Equal(ext.Value, ocspMustStapleFeature) {
+					t.Errorf("Expected TLS feature value %x but got %x", ocspMustStapleFeature, ext.Value)
+				}
+			}
+		}
+		if found != mustStaple {
+			t.Errorf("mustStaple=%v: Expected TLS feature extension present=%v but was %v", mustStaple, mustStaple, found)
+		}
+	}
+}
+
 func TestPEMEncode(t *testing.T) {
 	buf := bytes.NewBufferString("TestingRSAIsSoMuchFun")
 
@@ -83,6 +118,54 @@ func TestPEMCertExpiration(t *testing.T) {
 	}
 }
 
+func TestNeedsRenewal(t *testing.T) {
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		window   time.Duration
+		expected bool
+	}{
+		{"fresh", now.Add(60 * 24 * time.Hour), 0, false},
+		{"near expiry", now.Add(10 * 24 * time.Hour), 0, true},
+		{"expired", now.Add(-time.Hour), 0, true},
+		{"custom window", now.Add(10 * 24 * time.Hour), 7 * 24 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		cert := &x509.Certificate{NotAfter: tt.notAfter}
+		if actual := NeedsRenewal(cert, tt.window); actual != tt.expected {
+			t.Errorf("%s: Expected NeedsRenewal to return %v but returned %v", tt.name, tt.expected, actual)
+		}
+	}
+}
+
+func TestRenewIfNeededFreshCertificate(t *testing.T) {
+	privKey, err := generatePrivateKey(rsakey, 512)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	certBytes, err := generateDerCert(privKey.(*rsa.PrivateKey), time.Now().Add(90*24*time.Hour), "test.com")
+	if err != nil {
+		t.Fatal("Error generating cert:", err)
+	}
+
+	// A fresh certificate must be returned without contacting the CA.
+	client := &Client{}
+	cert := CertificateResource{Domain: "test.com", CertURL: "http://127.0.0.1:1/cert", Certificate: pemEncode(derCertificateBytes(certBytes))}
+	renewed, ok, err := client.RenewIfNeeded(cert, false, 0)
+	if err != nil || ok {
+		t.Errorf("Expected RenewIfNeeded to skip renewal but got renewed=%v, error %v", ok, err)
+	}
+	if !bytes.Equal(renewed.Certificate, cert.Certificate) {
+		t.Errorf("Expected RenewIfNeeded to return the certificate unchanged")
+	}
+}
+
 type MockRandReader struct {
 	b *bytes.Buffer
 }
@@ -90,3 +173,86 @@ type MockRandReader struct {
 func (r MockRandReader) Read(p []byte) (int, error) {
 	return r.b.Read(p)
 }
+
+func TestSplitPEMChain(t *testing.T) {
+	privKey, _ := generatePrivateKey(rsakey, 512)
+
+	var certs [][]byte
+	for _, domain := range []string{"leaf.test.com", "intermediate.test.com", "root.test.com"} {
+		der, err := generateDerCert(privKey.(*rsa.PrivateKey), time.Now().Add(time.Hour), domain)
+		if err != nil {
+			t.Fatal("Error generating certificate:", err)
+		}
+		certs = append(certs, pemEncode(derCertificateBytes(der)))
+	}
+
+	chain := bytes.Join(certs, nil)
+	cert, issuer, err := splitPEMChain(chain)
+	if err != nil {
+		t.Fatalf("splitPEMChain error: got %v, want nil", err)
+	}
+	if !bytes.Equal(cert, certs[0]) {
+		t.Errorf("Expected the first certificate to be the issued certificate")
+	}
+	if !bytes.Equal(issuer, bytes.Join(certs[1:], nil)) {
+		t.Errorf("Expected the issuer chain to hold the remaining two certificates")
+	}
+
+	client := &Client{}
+	cert, issuer, err = client.certificateChain("leaf.test.com", chain, http.Header{})
+	if err != nil {
+		t.Fatalf("certificateChain error: got %v, want nil", err)
+	}
+	if !bytes.Equal(cert, certs[0]) || !bytes.Equal(issuer, bytes.Join(certs[1:], nil)) {
+		t.Errorf("Expected certificateChain to split a PEM response like splitPEMChain")
+	}
+
+	if _, _, err := splitPEMChain([]byte("not a certificate")); err == nil {
+		t.Errorf("Expected an error for input without certificates")
+	}
+}
+
+func TestKeyTypeMatches(t *testing.T) {
+	rsaKey, err := generatePrivateKey(rsakey, 2048)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+	ecKey, err := generatePrivateKey(eckey, 256)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	tests := []struct {
+		keyType KeyType
+		key     crypto.PrivateKey
+		match   bool
+	}{
+		{RSA2048, rsaKey, true},
+		{RSA4096, rsaKey, false},
+		{EC256, rsaKey, false},
+		{EC256, ecKey, true},
+		{EC384, ecKey, false},
+		{RSA2048, ecKey, false},
+		{KeyType("ed25519"), rsaKey, false},
+	}
+	for _, tt := range tests {
+		if err := tt.keyType.matches(tt.key); (err == nil) != tt.match {
+			t.Errorf("%s matches %T: got %v, want match %t", tt.keyType, tt.key, err, tt.match)
+		}
+	}
+}
+
+func TestPEMEncodeECKey(t *testing.T) {
+	key, err := generatePrivateKey(eckey, 384)
+	if err != nil {
+		t.Fatal("Error generating private key:", err)
+	}
+
+	parsed, err := parsePEMPrivateKey(pemEncode(key))
+	if err != nil {
+		t.Fatal("Error parsing PEM encoded key:", err)
+	}
+	if ecKey, ok := parsed.(*ecdsa.PrivateKey); !ok || ecKey.D.Cmp(key.(*ecdsa.PrivateKey).D) != 0 {
+		t.Errorf("Expected the EC key to survive the round trip, got %v", parsed)
+	}
+}
@@ -6,29 +6,144 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+	"golang.org/x/net/idna"
 )
 
-type preCheckDNSFunc func(domain, fqdn string) bool
+type preCheckDNSFunc func(fqdn, value string) (bool, error)
 
-var preCheckDNS preCheckDNSFunc = checkDNS
+var preCheckDNS preCheckDNSFunc = checkDNSPropagation
 
-var preCheckDNSFallbackCount = 5
+// defaultNameservers are the public resolvers used when no custom
+// resolvers have been set with SetDNSResolvers.
+var defaultNameservers = []string{
+	"8.8.8.8:53",
+	"8.8.4.4:53",
+	"1.1.1.1:53",
+}
+
+// RecursiveNameservers are used to look up the zone and the authoritative
+// nameservers of a challenge record.
+var RecursiveNameservers = defaultNameservers
+
+// SetDNSResolvers overrides the recursive nameservers used for zone lookups
+// and propagation checks. Addresses without a port use port 53. Passing an
+// empty list restores the default public resolvers.
+func SetDNSResolvers(addrs []string) {
+	if len(addrs) == 0 {
+		RecursiveNameservers = defaultNameservers
+		return
+	}
+
+	nameservers := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		nameservers = append(nameservers, addr)
+	}
+	RecursiveNameservers = nameservers
+}
+
+// FollowCNAME enables following CNAME records at the challenge fqdn. When set,
+// DNS01Record returns the final target of the CNAME chain, so that the TXT
+// record is created in the zone the challenge has been delegated to.
+var FollowCNAME = false
+
+// DisablePropagationCheck skips waiting for the TXT record to show up on the
+// authoritative nameservers before the ACME server is asked to validate it.
+// This is only safe for providers which are consistent once their write
+// returns, e.g. RFC2136 updates sent to the only authoritative server.
+// Eventually consistent DNS APIs will cause validations to fail.
+var DisablePropagationCheck = false
+
+// RequireAllResolvers makes the propagation check also query every resolver
+// in RecursiveNameservers, in addition to the authoritative nameservers. The
+// check only succeeds once all of them return the expected TXT record, which
+// catches resolvers that still serve a cached NXDOMAIN or an old value.
+var RequireAllResolvers = false
+
+// maxCNAMEChain limits the number of CNAME records followed for a single fqdn.
+const maxCNAMEChain = 8
 
-// DNS01Record returns a DNS record which will fulfill the `dns-01` challenge
+// dnsTimeout is used to override the default DNS timeout of 10 seconds.
+var dnsTimeout = 10 * time.Second
+
+const (
+	// propagationTimeout is how long Solve waits for the TXT record to appear.
+	propagationTimeout = 60 * time.Second
+	// propagationInterval is how often the authoritative nameservers are queried.
+	propagationInterval = 2 * time.Second
+)
+
+// DNS01Record returns a DNS record which will fulfill the `dns-01` challenge.
+// Internationalized domain names are converted to their A-label (punycode)
+// form, which is what the ACME server queries. A wildcard domain shares the
+// record name of the domain it covers.
 func DNS01Record(domain, keyAuth string) (fqdn string, value string, ttl int) {
+	domain = strings.TrimPrefix(domain, "*.")
+	if ascii, err := toASCIIFqdn(domain); err == nil {
+		domain = ascii
+	}
+
 	keyAuthShaBytes := sha256.Sum256([]byte(keyAuth))
 	// base64URL encoding without padding
 	keyAuthSha := base64.URLEncoding.EncodeToString(keyAuthShaBytes[:sha256.Size])
 	value = strings.TrimRight(keyAuthSha, "=")
 	ttl = 120
 	fqdn = fmt.Sprintf("_acme-challenge.%s.", domain)
+	if FollowCNAME {
+		fqdn = followCNAMEs(fqdn)
+	}
 	return
 }
 
+// toASCIIFqdn converts a domain name to its A-label (punycode) form. Names
+// that are already ASCII are returned unchanged.
+func toASCIIFqdn(fqdn string) (string, error) {
+	ascii, err := idna.ToASCII(fqdn)
+	if err != nil {
+		return "", fmt.Errorf("Invalid internationalized domain name %q: %v", fqdn, err)
+	}
+	if _, ok := dns.IsDomainName(ascii); !ok {
+		return "", fmt.Errorf("Invalid domain name %q", fqdn)
+	}
+	return ascii, nil
+}
+
+// followCNAMEs resolves fqdn and returns the last name of its CNAME chain.
+// If fqdn has no CNAME record or the lookup fails, fqdn is returned unchanged.
+func followCNAMEs(fqdn string) string {
+	for i := 0; i < maxCNAMEChain; i++ {
+		r, err := dnsQuery(fqdn, dns.TypeCNAME, RecursiveNameservers, true)
+		if err != nil || r.Rcode != dns.RcodeSuccess {
+			return fqdn
+		}
+
+		var target string
+		for _, rr := range r.Answer {
+			if cn, ok := rr.(*dns.CNAME); ok && cn.Hdr.Name == fqdn {
+				target = cn.Target
+				break
+			}
+		}
+		if target == "" {
+			return fqdn
+		}
+
+		logf("[INFO] acme: Following CNAME %s -> %s", fqdn, target)
+		fqdn = target
+	}
+
+	return fqdn
+}
+
 // dnsChallenge implements the dns-01 challenge according to ACME 7.5
 type dnsChallenge struct {
 	jws      *jws
@@ -44,65 +159,476 @@ func (s *dnsChallenge) Solve(chlng challenge, domain string) error {
 		return errors.New("No DNS Provider configured")
 	}
 
-	// Generate the Key Authorization for the challenge
-	keyAuth, err := getKeyAuthorization(chlng.Token, &s.jws.privKey.PublicKey)
+	rec, err := s.record(chlng, domain)
 	if err != nil {
 		return err
 	}
 
-	err = s.provider.Present(domain, chlng.Token, keyAuth)
+	err = s.provider.Present(rec.Domain, rec.Token, rec.KeyAuth)
 	if err != nil {
 		return fmt.Errorf("Error presenting token %s", err)
 	}
 	defer func() {
-		err := s.provider.CleanUp(domain, chlng.Token, keyAuth)
+		err := s.provider.CleanUp(rec.Domain, rec.Token, rec.KeyAuth)
 		if err != nil {
-			log.Printf("Error cleaning up %s %v ", domain, err)
+			log.Printf("Error cleaning up %s %v ", rec.Domain, err)
 		}
 	}()
 
-	fqdn, _, _ := DNS01Record(domain, keyAuth)
+	return s.complete(chlng, rec)
+}
 
-	preCheckDNS(domain, fqdn)
+// record returns the record the provider has to present to solve chlng.
+func (s *dnsChallenge) record(chlng challenge, domain string) (DNSChallengeRecord, error) {
+	// Providers build record names and API requests from domain, so hand
+	// them the A-label form the ACME server will query.
+	domain, err := toASCIIFqdn(domain)
+	if err != nil {
+		return DNSChallengeRecord{}, err
+	}
+
+	// Generate the Key Authorization for the challenge
+	keyAuth, err := getKeyAuthorization(chlng.Token, &s.jws.key().PublicKey)
+	if err != nil {
+		return DNSChallengeRecord{}, err
+	}
+
+	return DNSChallengeRecord{Domain: domain, Token: chlng.Token, KeyAuth: keyAuth}, nil
+}
+
+// complete waits for the presented record rec to propagate and then has the
+// server validate chlng.
+func (s *dnsChallenge) complete(chlng challenge, rec DNSChallengeRecord) error {
+	domain, keyAuth := rec.Domain, rec.KeyAuth
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+
+	if !DisablePropagationCheck {
+		logf("[INFO] acme: Checking DNS record propagation...")
+
+		err := WaitForPropagation(fqdn, value, propagationTimeout, propagationInterval)
+		if err != nil {
+			return err
+		}
+	}
 
 	return s.validate(s.jws, domain, chlng.URI, challenge{Resource: "challenge", Type: chlng.Type, Token: chlng.Token, KeyAuthorization: keyAuth})
 }
 
-func checkDNS(domain, fqdn string) bool {
-	// check if the expected DNS entry was created. If not wait for some time and try again.
-	m := new(dns.Msg)
-	m.SetQuestion(domain+".", dns.TypeSOA)
-	c := new(dns.Client)
-	in, _, err := c.Exchange(m, "8.8.8.8:53")
+// presentedDNSChallenge solves a dns-01 challenge whose record has already
+// been presented by a BatchDNSProvider.
+type presentedDNSChallenge struct {
+	challenge *dnsChallenge
+	record    DNSChallengeRecord
+}
+
+func (p presentedDNSChallenge) Solve(chlng challenge, domain string) error {
+	return p.challenge.complete(chlng, p.record)
+}
+
+// WaitForPropagation blocks until the TXT record fqdn with the given value is
+// served by all authoritative nameservers of its zone and, if
+// RequireAllResolvers is set, by all recursive resolvers. It polls once every
+// 'interval' and gives up with an error after 'timeout'.
+func WaitForPropagation(fqdn, value string, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	lastErr, err := waitForPropagation(ctx, fqdn, value, interval)
+	if err == context.DeadlineExceeded {
+		return fmt.Errorf("Time limit exceeded. Last error: %s", lastErr)
+	}
+	return err
+}
+
+// WaitForPropagationContext is like WaitForPropagation, but polls until ctx
+// is cancelled or its deadline passes, in which case it returns ctx.Err().
+func WaitForPropagationContext(ctx context.Context, fqdn, value string) error {
+	_, err := waitForPropagation(ctx, fqdn, value, propagationInterval)
+	return err
+}
+
+// waitForPropagation polls preCheckDNS once every 'interval' until it
+// succeeds or ctx is done. In the latter case the last error reported by
+// the check is returned along with ctx.Err().
+func waitForPropagation(ctx context.Context, fqdn, value string, interval time.Duration) (string, error) {
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return lastErr, ctx.Err()
+		default:
+		}
+
+		ok, err := preCheckDNS(fqdn, value)
+		if ok {
+			return "", nil
+		}
+		if err != nil {
+			lastErr = err.Error()
+		}
+
+		select {
+		case <-ctx.Done():
+			return lastErr, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// checkDNSPropagation checks if the expected TXT record has been propagated
+// to all authoritative nameservers and, if RequireAllResolvers is set, to all
+// recursive resolvers.
+func checkDNSPropagation(fqdn, value string) (bool, error) {
+	nameservers, err := lookupNameservers(fqdn)
 	if err != nil {
-		return false
+		return false, err
 	}
 
-	var authorativeNS string
-	for _, answ := range in.Answer {
-		soa := answ.(*dns.SOA)
-		authorativeNS = soa.Ns
+	found, err := checkAuthoritativeNss(fqdn, value, nameservers)
+	if !found || !RequireAllResolvers {
+		return found, err
 	}
 
-	fallbackCnt := 0
-	for fallbackCnt < preCheckDNSFallbackCount {
-		m.SetQuestion(fqdn, dns.TypeTXT)
-		in, _, err = c.Exchange(m, authorativeNS+":53")
+	return checkRecursiveNss(fqdn, value, RecursiveNameservers)
+}
+
+// checkAuthoritativeNss queries each of the given nameservers for the expected TXT record.
+func checkAuthoritativeNss(fqdn, value string, nameservers []string) (bool, error) {
+	return checkNameservers(fqdn, value, nameservers, false)
+}
+
+// checkRecursiveNss queries each of the given resolvers for the expected TXT record.
+func checkRecursiveNss(fqdn, value string, resolvers []string) (bool, error) {
+	return checkNameservers(fqdn, value, resolvers, true)
+}
+
+func checkNameservers(fqdn, value string, nameservers []string, recursive bool) (bool, error) {
+	for _, ns := range nameservers {
+		r, err := dnsQuery(fqdn, dns.TypeTXT, []string{ns}, recursive)
 		if err != nil {
-			return false
+			return false, err
 		}
 
-		if len(in.Answer) > 0 {
-			return true
+		if r.Rcode != dns.RcodeSuccess {
+			return false, fmt.Errorf("NS %s returned %s for %s", ns, dns.RcodeToString[r.Rcode], fqdn)
 		}
 
-		fallbackCnt++
-		if fallbackCnt >= preCheckDNSFallbackCount {
-			return false
+		var found bool
+		for _, rr := range r.Answer {
+			if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false, fmt.Errorf("NS %s did not return the expected TXT record", ns)
+		}
+	}
+
+	return true, nil
+}
+
+// lookupNameservers returns the authoritative nameservers for the zone of
+// the given fqdn in the form "host:port".
+func lookupNameservers(fqdn string) ([]string, error) {
+	zone, err := findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := dnsQuery(zone, dns.TypeNS, RecursiveNameservers, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var authoritativeNss []string
+	for _, rr := range r.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			authoritativeNss = append(authoritativeNss, net.JoinHostPort(strings.ToLower(ns.Ns), "53"))
 		}
+	}
 
-		time.Sleep(time.Second * time.Duration(fallbackCnt))
+	if len(authoritativeNss) == 0 {
+		return nil, fmt.Errorf("Could not determine authoritative nameservers for %s", zone)
 	}
 
-	return false
+	return authoritativeNss, nil
+}
+
+// maxTXTStringLength is the maximum length of a single character string in
+// a TXT record (RFC 1035, section 3.3).
+const maxTXTStringLength = 255
+
+// splitTXTValue splits value into strings of at most 255 octets, which form a
+// single TXT record. Resolvers return them as one value when joined.
+func splitTXTValue(value string) []string {
+	var chunks []string
+	for len(value) > maxTXTStringLength {
+		chunks = append(chunks, value[:maxTXTStringLength])
+		value = value[maxTXTStringLength:]
+	}
+	return append(chunks, value)
+}
+
+// isChallengeRecordName reports whether name, relative to its zone, is the
+// record name of a dns-01 challenge.
+func isChallengeRecordName(name string) bool {
+	name = strings.ToLower(name)
+	return name == "_acme-challenge" || strings.HasPrefix(name, "_acme-challenge.")
+}
+
+// clampTTL raises ttl to the minimum accepted by a DNS provider API instead
+// of letting the API call fail.
+func clampTTL(ttl, minTTL int, provider string) int {
+	if ttl < minTTL {
+		logf("[INFO] acme: %s does not accept a TTL of %d, using %d instead", provider, ttl, minTTL)
+		return minTTL
+	}
+	return ttl
+}
+
+// deleteWithRelist deletes a TXT record of a provider which remembers the
+// ids of the records it creates. storedID is the remembered id, if ok.
+// Without one, as for a record created by another instance, the record is
+// looked up with find. If deleting the stored id fails, the record may have
+// been deleted and recreated under a new id, so it is looked up again and
+// deleted by the id found. The error of the first delete is returned when
+// no other record is found.
+func deleteWithRelist(find func() (string, error), del func(id string) error, storedID string, ok bool) error {
+	if !ok {
+		id, err := find()
+		if err != nil {
+			return err
+		}
+		return del(id)
+	}
+
+	err := del(storedID)
+	if err == nil {
+		return nil
+	}
+
+	id, findErr := find()
+	if findErr != nil || id == storedID {
+		return err
+	}
+	return del(id)
+}
+
+// findZoneByFqdn determines the zone apex of the given fqdn by walking up its
+// labels and querying the given nameservers for a SOA record at each level.
+//
+// While a CachingDNSProvider is presenting or cleaning up a record, the
+// answers are kept in its cache, so that issuing a certificate for many
+// names in the same zone queries each name only once.
+func findZoneByFqdn(fqdn string, nameservers []string) (string, error) {
+	caches := activeZoneCaches.list()
+
+	fqdn = dns.Fqdn(fqdn)
+	for _, index := range dns.Split(fqdn) {
+		domain := fqdn[index:]
+
+		apex, ok := false, false
+		for _, cache := range caches {
+			if apex, ok = cache.get(domain, nameservers); ok {
+				break
+			}
+		}
+		if !ok {
+			var ttl uint32
+			var err error
+			if apex, ttl, err = lookupApex(domain, nameservers); err != nil {
+				return "", err
+			}
+			for _, cache := range caches {
+				cache.set(domain, nameservers, apex, ttl)
+			}
+		}
+		if apex {
+			return domain, nil
+		}
+	}
+
+	return "", fmt.Errorf("Could not find the start of authority for %s", fqdn)
+}
+
+// lookupApex queries the SOA record of domain and reports whether domain is
+// the apex of a zone, along with how long the answer may be cached.
+func lookupApex(domain string, nameservers []string) (apex bool, ttl uint32, err error) {
+	in, err := dnsQuery(domain, dns.TypeSOA, nameservers, true)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// Any response code other than NOERROR and NXDOMAIN is treated as error
+	if in.Rcode != dns.RcodeNameError && in.Rcode != dns.RcodeSuccess {
+		return false, 0, fmt.Errorf("Unexpected response code '%s' for %s", dns.RcodeToString[in.Rcode], domain)
+	}
+
+	// Only a SOA in the answer section marks the apex; the authority
+	// section of a NODATA/NXDOMAIN reply points to an enclosing zone.
+	for _, ans := range in.Answer {
+		if soa, ok := ans.(*dns.SOA); ok && soa.Hdr.Name == domain {
+			return true, soa.Hdr.Ttl, nil
+		}
+	}
+
+	// Negative answers may be cached as long as the SOA of the enclosing
+	// zone says, see RFC 2308.
+	for _, rr := range in.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl = soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			break
+		}
+	}
+	return false, ttl, nil
+}
+
+// maxZoneCacheEntries is how many names an apexCache holds at most.
+const maxZoneCacheEntries = 4096
+
+// apexCache remembers for names whether they are the apex of a zone,
+// separately for each set of nameservers.
+type apexCache struct {
+	mu      sync.Mutex
+	entries map[string]apexCacheEntry
+}
+
+type apexCacheEntry struct {
+	apex    bool
+	expires time.Time
+}
+
+func newApexCache() *apexCache {
+	return &apexCache{entries: map[string]apexCacheEntry{}}
+}
+
+func (c *apexCache) key(domain string, nameservers []string) string {
+	return strings.Join(nameservers, ",") + "|" + strings.ToLower(domain)
+}
+
+func (c *apexCache) get(domain string, nameservers []string) (apex, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[c.key(domain, nameservers)]
+	if !ok || !timeNow().Before(entry.expires) {
+		return false, false
+	}
+	return entry.apex, true
+}
+
+func (c *apexCache) set(domain string, nameservers []string, apex bool, ttl uint32) {
+	if ttl == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := timeNow()
+	if len(c.entries) >= maxZoneCacheEntries {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		// Start over rather than grow if nothing has expired.
+		if len(c.entries) >= maxZoneCacheEntries {
+			c.entries = map[string]apexCacheEntry{}
+		}
+	}
+	c.entries[c.key(domain, nameservers)] = apexCacheEntry{apex: apex, expires: now.Add(time.Duration(ttl) * time.Second)}
+}
+
+// activeZoneCaches holds the caches of the CachingDNSProvider calls in
+// progress. Providers look up their zones themselves through findZoneByFqdn,
+// which cannot tell which wrapper it is called for, so it uses the caches
+// of all of them. Without a CachingDNSProvider nothing is cached.
+var activeZoneCaches = &zoneCacheSet{caches: map[*apexCache]int{}}
+
+type zoneCacheSet struct {
+	mu     sync.Mutex
+	caches map[*apexCache]int
+}
+
+// add makes cache active until the returned func is called.
+func (s *zoneCacheSet) add(cache *apexCache) func() {
+	s.mu.Lock()
+	s.caches[cache]++
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.caches[cache]--; s.caches[cache] == 0 {
+			delete(s.caches, cache)
+		}
+	}
+}
+
+func (s *zoneCacheSet) list() []*apexCache {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	caches := make([]*apexCache, 0, len(s.caches))
+	for cache := range s.caches {
+		caches = append(caches, cache)
+	}
+	return caches
+}
+
+// dnsQuery sends a DNS query for the given fqdn and record type to the given
+// nameservers, trying each of them in turn until one of them answers.
+func dnsQuery(fqdn string, rtype uint16, nameservers []string, recursive bool) (in *dns.Msg, err error) {
+	if len(nameservers) == 0 {
+		return nil, errors.New("No nameservers to query")
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(fqdn, rtype)
+	m.SetEdns0(4096, false)
+	m.RecursionDesired = recursive
+
+	for _, ns := range nameservers {
+		udp := &dns.Client{Net: "udp", Timeout: dnsTimeout}
+		in, _, err = udp.Exchange(m, ns)
+
+		// Retry over TCP if the answer did not fit into a UDP packet
+		if in != nil && in.Truncated {
+			tcp := &dns.Client{Net: "tcp", Timeout: dnsTimeout}
+			in, _, err = tcp.Exchange(m, ns)
+		}
+
+		if err == nil {
+			return in, nil
+		}
+	}
+
+	return nil, err
+}
+
+// waitFor polls the given function 'f', once every 'interval', up to 'timeout'.
+func waitFor(timeout, interval time.Duration, f func() (bool, error)) error {
+	var lastErr string
+	timeup := time.After(timeout)
+	for {
+		select {
+		case <-timeup:
+			return fmt.Errorf("Time limit exceeded. Last error: %s", lastErr)
+		default:
+		}
+
+		stop, err := f()
+		if stop {
+			return nil
+		}
+		if err != nil {
+			lastErr = err.Error()
+		}
+
+		time.Sleep(interval)
+	}
 }
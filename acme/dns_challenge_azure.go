@@ -0,0 +1,201 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureADURL         = "https://login.microsoftonline.com"
+	azureManagementURL = "https://management.azure.com"
+	azureAPIVersion    = "2016-04-01"
+)
+
+// DNSProviderAzure is an implementation of the ChallengeProvider interface
+// that uses the Azure DNS REST API to manage TXT records.
+type DNSProviderAzure struct {
+	clientID       string
+	clientSecret   string
+	subscriptionID string
+	tenantID       string
+	resourceGroup  string
+
+	adURL   string
+	baseURL string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewDNSProviderAzure returns a DNSProviderAzure instance configured for the
+// given service principal, subscription and resource group. Authentication is
+// either done using the passed credentials or - when empty - using the
+// environment variables AZURE_CLIENT_ID, AZURE_CLIENT_SECRET,
+// AZURE_SUBSCRIPTION_ID, AZURE_TENANT_ID and AZURE_RESOURCE_GROUP.
+func NewDNSProviderAzure(clientID, clientSecret, subscriptionID, tenantID, resourceGroup string) (*DNSProviderAzure, error) {
+	if clientID == "" || clientSecret == "" || subscriptionID == "" || tenantID == "" || resourceGroup == "" {
+		clientID = os.Getenv("AZURE_CLIENT_ID")
+		clientSecret = os.Getenv("AZURE_CLIENT_SECRET")
+		subscriptionID = os.Getenv("AZURE_SUBSCRIPTION_ID")
+		tenantID = os.Getenv("AZURE_TENANT_ID")
+		resourceGroup = os.Getenv("AZURE_RESOURCE_GROUP")
+		if clientID == "" || clientSecret == "" || subscriptionID == "" || tenantID == "" || resourceGroup == "" {
+			return nil, fmt.Errorf("Azure credentials missing")
+		}
+	}
+
+	return &DNSProviderAzure{
+		clientID:       clientID,
+		clientSecret:   clientSecret,
+		subscriptionID: subscriptionID,
+		tenantID:       tenantID,
+		resourceGroup:  resourceGroup,
+		adURL:          azureADURL,
+		baseURL:        azureManagementURL,
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (a *DNSProviderAzure) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, name, err := a.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	rec := azureRecordSet{}
+	rec.Properties.TTL = ttl
+	rec.Properties.TXTRecords = []azureTXTRecord{{Value: []string{value}}}
+
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return a.doRequest("PUT", a.recordSetURL(zone, name), bytes.NewReader(body))
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (a *DNSProviderAzure) CleanUp(domain, token, keyAuth string) error {
+	fqdn, _, _ := DNS01Record(domain, keyAuth)
+	zone, name, err := a.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	return a.doRequest("DELETE", a.recordSetURL(zone, name), nil)
+}
+
+// splitFqdn returns the zone of fqdn and the record name relative to that zone.
+func (a *DNSProviderAzure) splitFqdn(fqdn string) (zone, name string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = "@"
+	}
+
+	return unFqdn(zone), name, nil
+}
+
+func (a *DNSProviderAzure) recordSetURL(zone, name string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/TXT/%s?api-version=%s",
+		a.baseURL, a.subscriptionID, a.resourceGroup, zone, name, azureAPIVersion)
+}
+
+func (a *DNSProviderAzure) doRequest(method, uri string, body io.Reader) error {
+	token, err := a.getToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("Azure API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+		return fmt.Errorf("Azure API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// getToken returns an OAuth access token for the Azure management API.
+// Tokens are cached until shortly before they expire.
+func (a *DNSProviderAzure) getToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Now().Before(a.tokenExpiry) {
+		return a.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {a.clientID},
+		"client_secret": {a.clientSecret},
+		"resource":      {azureManagementURL + "/"},
+	}
+
+	resp, err := httpPostWith(providerHTTPClient, fmt.Sprintf("%s/%s/oauth2/token", a.adURL, a.tenantID), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("Azure AD token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Azure AD token request failed with HTTP status %d", resp.StatusCode)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("Azure AD token response could not be decoded: %v", err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("Azure AD token response did not contain an access token")
+	}
+
+	expiresIn, _ := strconv.Atoi(tok.ExpiresIn)
+	a.token = tok.AccessToken
+	a.tokenExpiry = time.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute)
+
+	return a.token, nil
+}
+
+type azureRecordSet struct {
+	Properties struct {
+		TTL        int              `json:"TTL"`
+		TXTRecords []azureTXTRecord `json:"TXTRecords"`
+	} `json:"properties"`
+}
+
+type azureTXTRecord struct {
+	Value []string `json:"value"`
+}
@@ -0,0 +1,105 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var azureEnv = []string{"AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET", "AZURE_SUBSCRIPTION_ID", "AZURE_TENANT_ID", "AZURE_RESOURCE_GROUP"}
+
+var azureEnvValues = map[string]string{}
+
+func init() {
+	for _, key := range azureEnv {
+		azureEnvValues[key] = os.Getenv(key)
+	}
+}
+
+func restoreAzureEnv() {
+	for key, value := range azureEnvValues {
+		os.Setenv(key, value)
+	}
+}
+
+func TestNewDNSProviderAzureMissingCredErr(t *testing.T) {
+	for _, key := range azureEnv {
+		os.Setenv(key, "")
+	}
+	_, err := NewDNSProviderAzure("", "", "", "", "")
+	assert.EqualError(t, err, "Azure credentials missing")
+	restoreAzureEnv()
+}
+
+func TestNewDNSProviderAzureValidEnv(t *testing.T) {
+	for _, key := range azureEnv {
+		os.Setenv(key, "123")
+	}
+	_, err := NewDNSProviderAzure("", "", "", "", "")
+	assert.NoError(t, err)
+	restoreAzureEnv()
+}
+
+func TestAzurePresentAndCleanUp(t *testing.T) {
+	recordPath := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/dnsZones/example.com/TXT/_acme-challenge.www"
+	var tokenRequests int
+	var methods []string
+	var rec azureRecordSet
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/tenant/oauth2/token":
+			tokenRequests++
+			assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+			assert.Equal(t, "id", r.FormValue("client_id"))
+			assert.Equal(t, "secret", r.FormValue("client_secret"))
+			writeJSONResponse(w, map[string]string{"access_token": "123", "expires_in": "3600"})
+		case r.Header.Get("Authorization") != "Bearer 123":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.URL.Path == recordPath && r.Method == "PUT":
+			methods = append(methods, r.Method)
+			assert.Equal(t, azureAPIVersion, r.URL.Query().Get("api-version"))
+			json.NewDecoder(r.Body).Decode(&rec)
+			writeJSONResponse(w, rec)
+		case r.URL.Path == recordPath && r.Method == "DELETE":
+			methods = append(methods, r.Method)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderAzure("id", "secret", "sub", "tenant", "rg")
+	assert.NoError(t, err)
+	provider.adURL = apiURL
+	provider.baseURL = apiURL
+
+	_, value, ttl := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, ttl, rec.Properties.TTL)
+	if assert.Len(t, rec.Properties.TXTRecords, 1) {
+		assert.Equal(t, []string{value}, rec.Properties.TXTRecords[0].Value)
+	}
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"PUT", "DELETE"}, methods)
+	assert.Equal(t, 1, tokenRequests, "Expected the access token to be reused")
+}
+
+func TestAzureTokenError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	provider, err := NewDNSProviderAzure("id", "secret", "sub", "tenant", "rg")
+	assert.NoError(t, err)
+	provider.adURL = ts.URL
+
+	_, err = provider.getToken()
+	assert.EqualError(t, err, "Azure AD token request failed with HTTP status 401")
+}
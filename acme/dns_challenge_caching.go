@@ -0,0 +1,31 @@
+package acme
+
+// CachingDNSProvider wraps a ChallengeProvider and caches the zone lookups
+// the provider makes while presenting and cleaning up records. Issuing a
+// certificate for many names in one zone then queries each name only once.
+//
+// The cached answers expire with the TTL of their SOA record, but are not
+// shared with other CachingDNSProviders created later, so a new one should be
+// used for each issuance. It is safe for concurrent use.
+type CachingDNSProvider struct {
+	provider ChallengeProvider
+	zones    *apexCache
+}
+
+// NewCachingDNSProvider returns a CachingDNSProvider that presents and cleans
+// up records with provider.
+func NewCachingDNSProvider(provider ChallengeProvider) *CachingDNSProvider {
+	return &CachingDNSProvider{provider: provider, zones: newApexCache()}
+}
+
+// Present creates the record with the wrapped provider.
+func (c *CachingDNSProvider) Present(domain, token, keyAuth string) error {
+	defer activeZoneCaches.add(c.zones)()
+	return c.provider.Present(domain, token, keyAuth)
+}
+
+// CleanUp removes the record with the wrapped provider.
+func (c *CachingDNSProvider) CleanUp(domain, token, keyAuth string) error {
+	defer activeZoneCaches.add(c.zones)()
+	return c.provider.CleanUp(domain, token, keyAuth)
+}
@@ -0,0 +1,116 @@
+package acme
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// zoneLookupProvider looks up the zone of every record, like the DNS
+// provider APIs do.
+type zoneLookupProvider struct {
+	t           *testing.T
+	nameservers []string
+}
+
+func (p *zoneLookupProvider) Present(domain, token, keyAuth string) error {
+	return p.lookup(domain, keyAuth)
+}
+
+func (p *zoneLookupProvider) CleanUp(domain, token, keyAuth string) error {
+	return p.lookup(domain, keyAuth)
+}
+
+func (p *zoneLookupProvider) lookup(domain, keyAuth string) error {
+	fqdn, _, _ := DNS01Record(domain, keyAuth)
+	zone, err := findZoneByFqdn(fqdn, p.nameservers)
+	if err != nil || zone != "example.com." {
+		p.t.Errorf("findZoneByFqdn(%q): got %q, %v; want example.com.", fqdn, zone, err)
+	}
+	return err
+}
+
+func TestCachingDNSProvider(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+
+	var mu sync.Mutex
+	queries := make(map[string]int)
+	dns.HandleFunc("example.com.", func(w dns.ResponseWriter, req *dns.Msg) {
+		mu.Lock()
+		queries[req.Question[0].Name]++
+		mu.Unlock()
+		serverHandlerSOA(w, req)
+	})
+	defer dns.HandleRemove("example.com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	// counts returns a copy of the query counts.
+	counts := func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		c := make(map[string]int)
+		for name, n := range queries {
+			c[name] = n
+		}
+		return c
+	}
+
+	provider := NewCachingDNSProvider(&zoneLookupProvider{t: t, nameservers: []string{addrstr}})
+
+	solve := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				domain := fmt.Sprintf("www%d.example.com", i)
+				provider.Present(domain, "", "123d==")
+				provider.CleanUp(domain, "", "123d==")
+			}(i)
+			// Let the first lookup populate the cache before the others start.
+			if i == 0 {
+				wg.Wait()
+			}
+		}
+		wg.Wait()
+	}
+
+	solve()
+	first := counts()
+	if n := first["example.com."]; n != 1 {
+		t.Errorf("Expected the zone apex to be queried once, got %d queries", n)
+	}
+	for name, n := range first {
+		if n != 1 {
+			t.Errorf("Expected %s to be queried once, got %d queries", name, n)
+		}
+	}
+	if n := len(first); n != 21 {
+		t.Errorf("Expected 21 names to be queried, got %d", n)
+	}
+
+	// Lookups outside of the wrapper are not cached.
+	if _, err := findZoneByFqdn("_acme-challenge.www0.example.com.", []string{addrstr}); err != nil {
+		t.Fatalf("findZoneByFqdn error: got %v, want nil", err)
+	}
+	if n := counts()["example.com."]; n != 2 {
+		t.Errorf("Expected the zone apex to be queried without the cache, got %d queries", n)
+	}
+
+	// The answers expire with the TTL of the SOA record.
+	now = now.Add(5 * time.Minute)
+	solve()
+	if n := counts()["example.com."]; n != 3 {
+		t.Errorf("Expected the zone apex to be queried again after the TTL, got %d queries", n)
+	}
+}
@@ -0,0 +1,187 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const cloudflareAPIURL = "https://api.cloudflare.com/client/v4"
+
+// DNSProviderCloudflareToken is an implementation of the ChallengeProvider
+// interface that authenticates to the Cloudflare v4 API with a scoped API
+// token, which unlike the global API key used by DNSProviderCloudFlare can be
+// limited to editing the DNS records of single zones.
+type DNSProviderCloudflareToken struct {
+	token   string
+	baseURL string
+}
+
+// NewDNSProviderCloudflareToken returns a DNSProviderCloudflareToken instance with a configured
+// Cloudflare client. Authentication is either done using the passed API token or - when empty -
+// using the environment variable CLOUDFLARE_DNS_API_TOKEN. The token needs the Zone:Read and
+// DNS:Edit permissions.
+func NewDNSProviderCloudflareToken(token string) (*DNSProviderCloudflareToken, error) {
+	if token == "" {
+		token = os.Getenv("CLOUDFLARE_DNS_API_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("CloudFlare API token missing")
+		}
+	}
+
+	return &DNSProviderCloudflareToken{token: token, baseURL: cloudflareAPIURL}, nil
+}
+
+// newDNSProviderCloudflareFromEnv returns the Cloudflare provider matching
+// the credentials found in the environment. A scoped API token is preferred
+// over the global API key.
+func newDNSProviderCloudflareFromEnv() (ChallengeProvider, error) {
+	if os.Getenv("CLOUDFLARE_DNS_API_TOKEN") != "" {
+		p, err := NewDNSProviderCloudflareToken("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	p, err := NewDNSProviderCloudFlare("", "")
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (c *DNSProviderCloudflareToken) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zoneID, err := c.getZoneID(fqdn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(cloudflareRecord{Type: "TXT", Name: unFqdn(fqdn), Content: value, TTL: sanitizeTTL(ttl)})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.doRequest("POST", fmt.Sprintf("%s/zones/%s/dns_records", c.baseURL, zoneID), bytes.NewReader(body))
+	return err
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (c *DNSProviderCloudflareToken) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zoneID, err := c.getZoneID(fqdn)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"type": {"TXT"}, "name": {unFqdn(fqdn)}}
+	result, err := c.doRequest("GET", fmt.Sprintf("%s/zones/%s/dns_records?%s", c.baseURL, zoneID, query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+
+	var records []cloudflareRecord
+	if err := json.Unmarshal(result, &records); err != nil {
+		return fmt.Errorf("CloudFlare API response could not be decoded: %v", err)
+	}
+
+	for _, rec := range records {
+		if rec.Content != value {
+			continue
+		}
+		if _, err := c.doRequest("DELETE", fmt.Sprintf("%s/zones/%s/dns_records/%s", c.baseURL, zoneID, rec.ID), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getZoneID returns the Cloudflare ID of the zone of fqdn.
+func (c *DNSProviderCloudflareToken) getZoneID(fqdn string) (string, error) {
+	zone, err := findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", err
+	}
+	zone = unFqdn(zone)
+
+	result, err := c.doRequest("GET", c.baseURL+"/zones?"+url.Values{"name": {zone}}.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var zones []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(result, &zones); err != nil {
+		return "", fmt.Errorf("CloudFlare API response could not be decoded: %v", err)
+	}
+
+	for _, z := range zones {
+		if strings.EqualFold(z.Name, zone) {
+			return z.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("No matching CloudFlare zone found for domain %s", fqdn)
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+}
+
+// doRequest sends a request to the Cloudflare API and returns the result
+// field of the response envelope.
+func (c *DNSProviderCloudflareToken) doRequest(method, uri string, body io.Reader) (json.RawMessage, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("CloudFlare API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("CloudFlare API call failed: %v", err)
+	}
+
+	var r struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(msg, &r); err != nil {
+		return nil, fmt.Errorf("CloudFlare API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if !r.Success || resp.StatusCode >= http.StatusBadRequest {
+		if len(r.Errors) > 0 {
+			return nil, fmt.Errorf("CloudFlare API call failed with HTTP status %d: [%d] %s", resp.StatusCode, r.Errors[0].Code, r.Errors[0].Message)
+		}
+		return nil, fmt.Errorf("CloudFlare API call failed with HTTP status %d", resp.StatusCode)
+	}
+
+	return r.Result, nil
+}
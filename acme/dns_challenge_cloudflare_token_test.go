@@ -0,0 +1,98 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var cflareTokenEnv = os.Getenv("CLOUDFLARE_DNS_API_TOKEN")
+
+func restoreCloudflareTokenEnv() {
+	os.Setenv("CLOUDFLARE_DNS_API_TOKEN", cflareTokenEnv)
+	restoreCloudFlareEnv()
+}
+
+func TestNewDNSProviderCloudflareTokenMissingCredErr(t *testing.T) {
+	os.Setenv("CLOUDFLARE_DNS_API_TOKEN", "")
+	_, err := NewDNSProviderCloudflareToken("")
+	assert.EqualError(t, err, "CloudFlare API token missing")
+	restoreCloudflareTokenEnv()
+}
+
+func TestNewDNSProviderCloudflareFromEnv(t *testing.T) {
+	defer restoreCloudflareTokenEnv()
+
+	os.Setenv("CLOUDFLARE_DNS_API_TOKEN", "")
+	os.Setenv("CLOUDFLARE_EMAIL", "test@example.com")
+	os.Setenv("CLOUDFLARE_API_KEY", "123")
+	p, err := NewDNSProviderByName("cloudflare")
+	assert.NoError(t, err)
+	assert.IsType(t, &DNSProviderCloudFlare{}, p)
+
+	// A scoped token is preferred over the global API key.
+	os.Setenv("CLOUDFLARE_DNS_API_TOKEN", "456")
+	p, err = NewDNSProviderByName("cloudflare")
+	assert.NoError(t, err)
+	if assert.IsType(t, &DNSProviderCloudflareToken{}, p) {
+		assert.Equal(t, "456", p.(*DNSProviderCloudflareToken).token)
+	}
+
+	os.Setenv("CLOUDFLARE_DNS_API_TOKEN", "")
+	os.Setenv("CLOUDFLARE_EMAIL", "")
+	p, err = NewDNSProviderByName("cloudflare")
+	assert.EqualError(t, err, "CloudFlare credentials missing")
+	assert.Nil(t, p)
+}
+
+func TestCloudflareTokenPresentAndCleanUp(t *testing.T) {
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	var created cloudflareRecord
+	var deleted []string
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer 123" || r.Header.Get("X-Auth-Key") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSONResponse(w, map[string]interface{}{"success": false, "errors": []map[string]interface{}{{"code": 9109, "message": "Invalid access token"}}})
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/zones":
+			assert.Equal(t, "example.com", r.URL.Query().Get("name"))
+			writeJSONResponse(w, map[string]interface{}{"success": true, "result": []map[string]string{{"id": "zone1", "name": "example.com"}}})
+		case r.Method == "POST" && r.URL.Path == "/zones/zone1/dns_records":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			writeJSONResponse(w, map[string]interface{}{"success": true, "result": created})
+		case r.Method == "GET" && r.URL.Path == "/zones/zone1/dns_records":
+			assert.Equal(t, "_acme-challenge.www.example.com", r.URL.Query().Get("name"))
+			writeJSONResponse(w, map[string]interface{}{"success": true, "result": []cloudflareRecord{
+				{ID: "rec1", Type: "TXT", Name: "_acme-challenge.www.example.com", Content: "other"},
+				{ID: "rec2", Type: "TXT", Name: "_acme-challenge.www.example.com", Content: value},
+			}})
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+			writeJSONResponse(w, map[string]interface{}{"success": true, "result": map[string]string{"id": "rec2"}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderCloudflareToken("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, cloudflareRecord{Type: "TXT", Name: "_acme-challenge.www.example.com", Content: value, TTL: 120}, created)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"/zones/zone1/dns_records/rec2"}, deleted)
+
+	provider.token = "bad"
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "CloudFlare API call failed with HTTP status 403: [9109] Invalid access token")
+}
@@ -0,0 +1,230 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const cloudnsAPIURL = "https://api.cloudns.net"
+
+// cloudnsTTLs are the only TTLs ClouDNS accepts, in ascending order.
+var cloudnsTTLs = []int{60, 300, 900, 1800, 3600, 21600, 43200, 86400, 172800, 259200, 604800, 1209600, 2592000}
+
+// DNSProviderClouDNS is an implementation of the ChallengeProvider interface
+// that uses the ClouDNS API to manage TXT records.
+type DNSProviderClouDNS struct {
+	// authParam is auth-id, or sub-auth-id for a sub user.
+	authParam    string
+	authID       string
+	authPassword string
+	baseURL      string
+
+	mu        sync.Mutex
+	recordIDs map[string]string
+}
+
+// NewDNSProviderClouDNS returns a DNSProviderClouDNS instance with a configured ClouDNS client.
+// Authentication is either done using the passed API user id and password or - when empty - using
+// the environment variables CLOUDNS_AUTH_ID and CLOUDNS_AUTH_PASSWORD. When CLOUDNS_AUTH_ID is not
+// set, the id of a sub user is read from CLOUDNS_SUB_AUTH_ID instead.
+func NewDNSProviderClouDNS(authID, authPassword string) (*DNSProviderClouDNS, error) {
+	if authID == "" || authPassword == "" {
+		authPassword = os.Getenv("CLOUDNS_AUTH_PASSWORD")
+		if authID = os.Getenv("CLOUDNS_AUTH_ID"); authID == "" {
+			if subAuthID := os.Getenv("CLOUDNS_SUB_AUTH_ID"); subAuthID != "" && authPassword != "" {
+				return NewDNSProviderClouDNSSubUser(subAuthID, authPassword)
+			}
+		}
+		if authID == "" || authPassword == "" {
+			return nil, fmt.Errorf("ClouDNS credentials missing")
+		}
+	}
+
+	return newDNSProviderClouDNS("auth-id", authID, authPassword), nil
+}
+
+// NewDNSProviderClouDNSSubUser is like NewDNSProviderClouDNS, but
+// authenticates as the API sub user with the id subAuthID.
+func NewDNSProviderClouDNSSubUser(subAuthID, authPassword string) (*DNSProviderClouDNS, error) {
+	if subAuthID == "" || authPassword == "" {
+		return nil, fmt.Errorf("ClouDNS credentials missing")
+	}
+
+	return newDNSProviderClouDNS("sub-auth-id", subAuthID, authPassword), nil
+}
+
+func newDNSProviderClouDNS(authParam, authID, authPassword string) *DNSProviderClouDNS {
+	return &DNSProviderClouDNS{
+		authParam:    authParam,
+		authID:       authID,
+		authPassword: authPassword,
+		baseURL:      cloudnsAPIURL,
+		recordIDs:    make(map[string]string),
+	}
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (c *DNSProviderClouDNS) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, host, err := c.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Data struct {
+			ID json.Number `json:"id"`
+		} `json:"data"`
+	}
+	err = c.doRequest("/dns/add-record.json", url.Values{
+		"domain-name": {zone},
+		"record-type": {"TXT"},
+		"host":        {host},
+		"record":      {value},
+		"ttl":         {strconv.Itoa(cloudnsTTL(ttl))},
+	}, &resp)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.recordIDs[fqdn+value] = resp.Data.ID.String()
+	c.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (c *DNSProviderClouDNS) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, host, err := c.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	id, ok := c.recordIDs[fqdn+value]
+	c.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		return c.findRecordID(zone, host, value)
+	}, func(id string) error {
+		return c.doRequest("/dns/delete-record.json", url.Values{"domain-name": {zone}, "record-id": {id}}, nil)
+	}, id, ok)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	delete(c.recordIDs, fqdn+value)
+	c.mu.Unlock()
+
+	return nil
+}
+
+// findRecordID returns the id of the TXT record host with the given value.
+func (c *DNSProviderClouDNS) findRecordID(zone, host, value string) (string, error) {
+	var records map[string]struct {
+		ID     string `json:"id"`
+		Host   string `json:"host"`
+		Record string `json:"record"`
+	}
+	err := c.doRequest("/dns/records.json", url.Values{"domain-name": {zone}, "host": {host}, "type": {"TXT"}}, &records)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rec := range records {
+		if rec.Host == host && rec.Record == value {
+			return rec.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("ClouDNS TXT record %s.%s not found", host, zone)
+}
+
+// splitFqdn returns the zone of fqdn and the host relative to that zone,
+// which is empty for the zone apex.
+func (c *DNSProviderClouDNS) splitFqdn(fqdn string) (zone, host string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	host = strings.TrimSuffix(fqdn, "."+zone)
+	if host == fqdn {
+		host = ""
+	}
+
+	return unFqdn(zone), host, nil
+}
+
+// cloudnsTTL returns the lowest TTL ClouDNS accepts that is at least ttl.
+func cloudnsTTL(ttl int) int {
+	for _, t := range cloudnsTTLs {
+		if t >= ttl {
+			if t != ttl {
+				logf("[INFO] acme: ClouDNS does not accept a TTL of %d, using %d instead", ttl, t)
+			}
+			return t
+		}
+	}
+	return cloudnsTTLs[len(cloudnsTTLs)-1]
+}
+
+// doRequest calls the API endpoint path with params and the credentials in
+// the query and decodes the response into result if it is not nil.
+func (c *DNSProviderClouDNS) doRequest(path string, params url.Values, result interface{}) error {
+	params.Set(c.authParam, c.authID)
+	params.Set("auth-password", c.authPassword)
+
+	req, err := http.NewRequest("GET", c.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("ClouDNS API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return fmt.Errorf("ClouDNS API call failed: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("ClouDNS API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	// ClouDNS reports failures with HTTP status 200 and a status of
+	// Failed. Listings have no status and are empty arrays if there is
+	// nothing to list.
+	msg = bytes.TrimSpace(msg)
+	if string(msg) == "[]" {
+		return nil
+	}
+	var status struct {
+		Status            string `json:"status"`
+		StatusDescription string `json:"statusDescription"`
+	}
+	if json.Unmarshal(msg, &status) == nil && status.Status == "Failed" {
+		return fmt.Errorf("ClouDNS API call failed: %s", status.StatusDescription)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(msg, result); err != nil {
+			return fmt.Errorf("ClouDNS API response could not be decoded: %v", err)
+		}
+	}
+	return nil
+}
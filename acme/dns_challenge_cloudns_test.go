@@ -0,0 +1,184 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	cloudnsAuthIDEnv       = os.Getenv("CLOUDNS_AUTH_ID")
+	cloudnsSubAuthIDEnv    = os.Getenv("CLOUDNS_SUB_AUTH_ID")
+	cloudnsAuthPasswordEnv = os.Getenv("CLOUDNS_AUTH_PASSWORD")
+)
+
+func restoreClouDNSEnv() {
+	os.Setenv("CLOUDNS_AUTH_ID", cloudnsAuthIDEnv)
+	os.Setenv("CLOUDNS_SUB_AUTH_ID", cloudnsSubAuthIDEnv)
+	os.Setenv("CLOUDNS_AUTH_PASSWORD", cloudnsAuthPasswordEnv)
+}
+
+func TestNewDNSProviderClouDNSMissingCredErr(t *testing.T) {
+	os.Setenv("CLOUDNS_AUTH_ID", "")
+	os.Setenv("CLOUDNS_SUB_AUTH_ID", "")
+	os.Setenv("CLOUDNS_AUTH_PASSWORD", "")
+	_, err := NewDNSProviderClouDNS("", "")
+	assert.EqualError(t, err, "ClouDNS credentials missing")
+	_, err = NewDNSProviderClouDNSSubUser("", "secret")
+	assert.EqualError(t, err, "ClouDNS credentials missing")
+	restoreClouDNSEnv()
+}
+
+func TestNewDNSProviderClouDNSValidEnv(t *testing.T) {
+	os.Setenv("CLOUDNS_AUTH_ID", "123")
+	os.Setenv("CLOUDNS_SUB_AUTH_ID", "")
+	os.Setenv("CLOUDNS_AUTH_PASSWORD", "secret")
+	provider, err := NewDNSProviderClouDNS("", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "auth-id", provider.authParam)
+	}
+
+	os.Setenv("CLOUDNS_AUTH_ID", "")
+	os.Setenv("CLOUDNS_SUB_AUTH_ID", "456")
+	provider, err = NewDNSProviderClouDNS("", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sub-auth-id", provider.authParam)
+		assert.Equal(t, "456", provider.authID)
+	}
+	restoreClouDNSEnv()
+}
+
+type cloudnsTestRecord struct {
+	ID     string `json:"id"`
+	Host   string `json:"host"`
+	Record string `json:"record"`
+	TTL    string `json:"ttl"`
+}
+
+// fakeClouDNS holds the TXT records of example.com. Like ClouDNS, it
+// reports failures with HTTP status 200.
+type fakeClouDNS struct {
+	authParam string
+	records   []cloudnsTestRecord
+	deleted   []string
+}
+
+func (f *fakeClouDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get(f.authParam) != "123" || query.Get("auth-password") != "secret" {
+		writeJSONResponse(w, map[string]string{"status": "Failed", "statusDescription": "Invalid authentication, incorrect auth-id or auth-password."})
+		return
+	}
+	if query.Get("domain-name") != "example.com" {
+		writeJSONResponse(w, map[string]string{"status": "Failed", "statusDescription": "Missing domain-name"})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/dns/add-record.json":
+		id := fmt.Sprintf("%d", 100+len(f.records))
+		f.records = append(f.records, cloudnsTestRecord{ID: id, Host: query.Get("host"), Record: query.Get("record"), TTL: query.Get("ttl")})
+		writeJSONResponse(w, map[string]interface{}{"status": "Success", "statusDescription": "The record was added successfully.", "data": map[string]int{"id": 100 + len(f.records) - 1}})
+	case "/dns/delete-record.json":
+		for i, rec := range f.records {
+			if rec.ID == query.Get("record-id") {
+				f.records = append(f.records[:i], f.records[i+1:]...)
+				f.deleted = append(f.deleted, rec.ID)
+				writeJSONResponse(w, map[string]string{"status": "Success", "statusDescription": "The record was deleted successfully."})
+				return
+			}
+		}
+		writeJSONResponse(w, map[string]string{"status": "Failed", "statusDescription": "Invalid record-id param."})
+	case "/dns/records.json":
+		records := make(map[string]cloudnsTestRecord)
+		for _, rec := range f.records {
+			if rec.Host == query.Get("host") {
+				records[rec.ID] = rec
+			}
+		}
+		if len(records) == 0 {
+			w.Write([]byte("[]"))
+			return
+		}
+		writeJSONResponse(w, records)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startClouDNSTest(t *testing.T, provider *DNSProviderClouDNS) (*fakeClouDNS, func()) {
+	fake := &fakeClouDNS{authParam: provider.authParam}
+	apiURL, done := startDNSProviderTest(t, fake)
+	provider.baseURL = apiURL
+
+	return fake, done
+}
+
+func TestClouDNSPresentAndCleanUp(t *testing.T) {
+	provider, err := NewDNSProviderClouDNS("123", "secret")
+	assert.NoError(t, err)
+	fake, done := startClouDNSTest(t, provider)
+	defer done()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, []cloudnsTestRecord{{ID: "100", Host: "_acme-challenge.www", Record: value, TTL: "300"}}, fake.records)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"100"}, fake.deleted)
+}
+
+func TestClouDNSSubUser(t *testing.T) {
+	provider, err := NewDNSProviderClouDNSSubUser("123", "secret")
+	assert.NoError(t, err)
+	fake, done := startClouDNSTest(t, provider)
+	defer done()
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Len(t, fake.records, 1)
+}
+
+func TestClouDNSCleanUpLooksUpRecord(t *testing.T) {
+	provider, err := NewDNSProviderClouDNS("123", "secret")
+	assert.NoError(t, err)
+	fake, done := startClouDNSTest(t, provider)
+	defer done()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+	fake.records = []cloudnsTestRecord{
+		{ID: "7", Host: "_acme-challenge.www", Record: "other"},
+		{ID: "8", Host: "_acme-challenge.www", Record: value},
+	}
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"8"}, fake.deleted)
+
+	err = provider.CleanUp("other.example.com", "", "123d==")
+	assert.EqualError(t, err, "ClouDNS TXT record _acme-challenge.other.example.com not found")
+}
+
+func TestClouDNSFailedStatus(t *testing.T) {
+	provider, err := NewDNSProviderClouDNS("123", "wrong")
+	assert.NoError(t, err)
+	_, done := startClouDNSTest(t, provider)
+	defer done()
+
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "ClouDNS API call failed: Invalid authentication, incorrect auth-id or auth-password.")
+
+	provider.authPassword = "secret"
+	err = provider.doRequest("/dns/delete-record.json", url.Values{"domain-name": {"example.com"}, "record-id": {"404"}}, nil)
+	assert.EqualError(t, err, "ClouDNS API call failed: Invalid record-id param.")
+}
+
+func TestClouDNSTTL(t *testing.T) {
+	assert.Equal(t, 60, cloudnsTTL(30))
+	assert.Equal(t, 60, cloudnsTTL(60))
+	assert.Equal(t, 300, cloudnsTTL(120))
+	assert.Equal(t, 2592000, cloudnsTTL(1<<30))
+}
@@ -0,0 +1,196 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const desecAPIURL = "https://desec.io/api/v1"
+
+// desecMinTTL is the lowest TTL deSEC accepts for an rrset.
+const desecMinTTL = 3600
+
+// DNSProviderDesec is an implementation of the ChallengeProvider interface
+// that uses deSEC's API to manage TXT records.
+//
+// deSEC only replaces whole rrsets, so the values of a domain and its
+// wildcard are added to and removed from the same rrset.
+type DNSProviderDesec struct {
+	token   string
+	baseURL string
+
+	// mu serializes the read-modify-write cycles on rrsets.
+	mu sync.Mutex
+}
+
+// NewDNSProviderDesec returns a DNSProviderDesec instance with a configured deSEC client.
+// Authentication is either done using the passed token or - when empty - using the environment
+// variable DESEC_TOKEN.
+func NewDNSProviderDesec(token string) (*DNSProviderDesec, error) {
+	if token == "" {
+		token = os.Getenv("DESEC_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("deSEC credentials missing")
+		}
+	}
+
+	return &DNSProviderDesec{
+		token:   token,
+		baseURL: desecAPIURL,
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (d *DNSProviderDesec) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	uri, err := d.rrsetURL(fqdn)
+	if err != nil {
+		return err
+	}
+	record := desecQuote(value)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records, err := d.getRecords(uri)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r == record {
+			return nil
+		}
+	}
+
+	return d.putRecords(uri, append(records, record), clampTTL(ttl, desecMinTTL, "deSEC"))
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProviderDesec) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	uri, err := d.rrsetURL(fqdn)
+	if err != nil {
+		return err
+	}
+	record := desecQuote(value)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records, err := d.getRecords(uri)
+	if err != nil {
+		return err
+	}
+
+	keep := []string{}
+	for _, r := range records {
+		if r != record {
+			keep = append(keep, r)
+		}
+	}
+	if len(keep) == len(records) {
+		return nil
+	}
+
+	// An rrset without records is deleted.
+	return d.putRecords(uri, keep, clampTTL(ttl, desecMinTTL, "deSEC"))
+}
+
+// rrsetURL returns the URL of the TXT rrset of fqdn. The zone apex is
+// addressed with the subname "@".
+func (d *DNSProviderDesec) rrsetURL(fqdn string) (string, error) {
+	zone, err := findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", err
+	}
+
+	subname := strings.TrimSuffix(fqdn, "."+zone)
+	if subname == fqdn {
+		subname = "@"
+	}
+
+	return fmt.Sprintf("%s/domains/%s/rrsets/%s/TXT/", d.baseURL, unFqdn(zone), subname), nil
+}
+
+// desecQuote returns value as the quoted character-string deSEC expects for
+// TXT records.
+func desecQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+type desecRRSet struct {
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+// getRecords returns the records of the rrset at uri, none if it does not
+// exist.
+func (d *DNSProviderDesec) getRecords(uri string) ([]string, error) {
+	resp, err := d.doRequest("GET", uri, nil)
+	if err == errDesecNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rrset desecRRSet
+	if err := json.Unmarshal(resp, &rrset); err != nil {
+		return nil, fmt.Errorf("deSEC API response could not be decoded: %v", err)
+	}
+	return rrset.Records, nil
+}
+
+func (d *DNSProviderDesec) putRecords(uri string, records []string, ttl int) error {
+	body, err := json.Marshal(desecRRSet{TTL: ttl, Records: records})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.doRequest("PUT", uri, bytes.NewReader(body))
+	return err
+}
+
+var errDesecNotFound = fmt.Errorf("deSEC API call failed with HTTP status %d", http.StatusNotFound)
+
+func (d *DNSProviderDesec) doRequest(method, uri string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token "+d.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("deSEC API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("deSEC API call failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errDesecNotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Detail != "" {
+			return nil, fmt.Errorf("deSEC API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Detail)
+		}
+		return nil, fmt.Errorf("deSEC API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
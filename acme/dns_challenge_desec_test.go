@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var desecTokenEnv = os.Getenv("DESEC_TOKEN")
+
+func restoreDesecEnv() {
+	os.Setenv("DESEC_TOKEN", desecTokenEnv)
+}
+
+func TestNewDNSProviderDesecMissingCredErr(t *testing.T) {
+	os.Setenv("DESEC_TOKEN", "")
+	_, err := NewDNSProviderDesec("")
+	assert.EqualError(t, err, "deSEC credentials missing")
+	restoreDesecEnv()
+}
+
+func TestNewDNSProviderDesecValidEnv(t *testing.T) {
+	os.Setenv("DESEC_TOKEN", "123")
+	_, err := NewDNSProviderDesec("")
+	assert.NoError(t, err)
+	restoreDesecEnv()
+}
+
+// fakeDesec holds the TXT rrsets of the domain example.com by URL path.
+type fakeDesec struct {
+	t      *testing.T
+	rrsets map[string]desecRRSet
+}
+
+func (f *fakeDesec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Token 123" {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSONResponse(w, map[string]string{"detail": "Invalid token."})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		rrset, ok := f.rrsets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSONResponse(w, map[string]string{"detail": "Not found."})
+			return
+		}
+		writeJSONResponse(w, rrset)
+	case "PUT":
+		var rrset desecRRSet
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&rrset))
+		if rrset.TTL < desecMinTTL {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSONResponse(w, map[string][]string{"ttl": {"Ensure this value is greater than or equal to 3600."}})
+			return
+		}
+		if len(rrset.Records) == 0 {
+			delete(f.rrsets, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		f.rrsets[r.URL.Path] = rrset
+		writeJSONResponse(w, rrset)
+	}
+}
+
+func startDesecTest(t *testing.T) (*DNSProviderDesec, *fakeDesec, func()) {
+	fake := &fakeDesec{t: t, rrsets: make(map[string]desecRRSet)}
+	apiURL, done := startDNSProviderTest(t, fake)
+
+	provider, err := NewDNSProviderDesec("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	return provider, fake, done
+}
+
+func TestDesecPresentAndCleanUp(t *testing.T) {
+	provider, fake, done := startDesecTest(t)
+	defer done()
+
+	const path = "/domains/example.com/rrsets/_acme-challenge.www/TXT/"
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, desecRRSet{TTL: 3600, Records: []string{`"` + value + `"`}}, fake.rrsets[path])
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Empty(t, fake.rrsets)
+}
+
+func TestDesecDomainAndWildcard(t *testing.T) {
+	provider, fake, done := startDesecTest(t)
+	defer done()
+
+	const path = "/domains/example.com/rrsets/_acme-challenge/TXT/"
+	_, first, _ := DNS01Record("example.com", "123d==")
+	_, second, _ := DNS01Record("*.example.com", "456e==")
+
+	assert.NoError(t, provider.Present("example.com", "", "123d=="))
+	assert.NoError(t, provider.Present("*.example.com", "", "456e=="))
+	assert.Equal(t, []string{`"` + first + `"`, `"` + second + `"`}, fake.rrsets[path].Records)
+
+	assert.NoError(t, provider.CleanUp("example.com", "", "123d=="))
+	assert.Equal(t, []string{`"` + second + `"`}, fake.rrsets[path].Records)
+
+	assert.NoError(t, provider.CleanUp("*.example.com", "", "456e=="))
+	assert.Empty(t, fake.rrsets)
+}
+
+func TestDesecQuote(t *testing.T) {
+	assert.Equal(t, `"abc"`, desecQuote("abc"))
+	assert.Equal(t, `"a\"b\\c"`, desecQuote(`a"b\c`))
+}
+
+func TestDesecAPIError(t *testing.T) {
+	provider, _, done := startDesecTest(t)
+	defer done()
+
+	provider.token = "wrong"
+	err := provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "deSEC API call failed with HTTP status 401: Invalid token.")
+}
@@ -0,0 +1,231 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const dnsimpleAPIURL = "https://api.dnsimple.com/v2"
+
+// DNSProviderDNSimple is an implementation of the ChallengeProvider interface
+// that uses DNSimple's v2 API to manage TXT records.
+type DNSProviderDNSimple struct {
+	accessToken string
+	baseURL     string
+
+	mu        sync.Mutex
+	accountID string
+	recordIDs map[string]int
+}
+
+// NewDNSProviderDNSimple returns a DNSProviderDNSimple instance with a configured DNSimple client.
+// Authentication is either done using the passed OAuth access token or - when empty - using the
+// environment variable DNSIMPLE_OAUTH_TOKEN.
+func NewDNSProviderDNSimple(accessToken string) (*DNSProviderDNSimple, error) {
+	if accessToken == "" {
+		accessToken = os.Getenv("DNSIMPLE_OAUTH_TOKEN")
+		if accessToken == "" {
+			return nil, fmt.Errorf("DNSimple credentials missing")
+		}
+	}
+
+	return &DNSProviderDNSimple{
+		accessToken: accessToken,
+		baseURL:     dnsimpleAPIURL,
+		recordIDs:   make(map[string]int),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (d *DNSProviderDNSimple) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	recordsURL, name, err := d.recordsURL(fqdn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(dnsimpleRecord{Name: name, Type: "TXT", Content: value, TTL: ttl})
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.doRequest("POST", recordsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var created struct {
+		Data dnsimpleRecord `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &created); err != nil {
+		return fmt.Errorf("DNSimple API response could not be decoded: %v", err)
+	}
+
+	d.mu.Lock()
+	d.recordIDs[fqdn+value] = created.Data.ID
+	d.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProviderDNSimple) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	recordsURL, name, err := d.recordsURL(fqdn)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	id, ok := d.recordIDs[fqdn+value]
+	d.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		id, err := d.findRecordID(recordsURL, name, value)
+		return strconv.Itoa(id), err
+	}, func(id string) error {
+		_, err := d.doRequest("DELETE", recordsURL+"/"+id, nil)
+		return err
+	}, strconv.Itoa(id), ok)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	delete(d.recordIDs, fqdn+value)
+	d.mu.Unlock()
+
+	return nil
+}
+
+// recordsURL returns the URL of the records of the zone of fqdn and the
+// record name relative to that zone, which is empty for the zone apex.
+func (d *DNSProviderDNSimple) recordsURL(fqdn string) (string, string, error) {
+	accountID, err := d.getAccountID()
+	if err != nil {
+		return "", "", err
+	}
+
+	zone, err := findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = ""
+	}
+
+	return fmt.Sprintf("%s/%s/zones/%s/records", d.baseURL, accountID, unFqdn(zone)), name, nil
+}
+
+// getAccountID returns the ID of the account the access token belongs to.
+func (d *DNSProviderDNSimple) getAccountID() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.accountID != "" {
+		return d.accountID, nil
+	}
+
+	resp, err := d.doRequest("GET", d.baseURL+"/whoami", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var whoami struct {
+		Data struct {
+			Account *struct {
+				ID int `json:"id"`
+			} `json:"account"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &whoami); err != nil {
+		return "", fmt.Errorf("DNSimple API response could not be decoded: %v", err)
+	}
+	if whoami.Data.Account == nil {
+		return "", fmt.Errorf("DNSimple access token is not an account token")
+	}
+
+	d.accountID = fmt.Sprintf("%d", whoami.Data.Account.ID)
+	return d.accountID, nil
+}
+
+// findRecordID returns the id of the TXT record name with the given value.
+func (d *DNSProviderDNSimple) findRecordID(recordsURL, name, value string) (int, error) {
+	query := url.Values{"name": {name}, "type": {"TXT"}}
+	resp, err := d.doRequest("GET", recordsURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var records struct {
+		Data []dnsimpleRecord `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &records); err != nil {
+		return 0, fmt.Errorf("DNSimple API response could not be decoded: %v", err)
+	}
+
+	for _, rec := range records.Data {
+		if rec.Content == value {
+			return rec.ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("DNSimple TXT record %s with value %s not found", name, value)
+}
+
+type dnsimpleRecord struct {
+	ID      int    `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+}
+
+var errDNSimpleNotFound = fmt.Errorf("DNSimple API call failed with HTTP status %d", http.StatusNotFound)
+
+func (d *DNSProviderDNSimple) doRequest(method, uri string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.accessToken)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("DNSimple API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("DNSimple API call failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errDNSimpleNotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("DNSimple API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		return nil, fmt.Errorf("DNSimple API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,95 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dnsimpleTokenEnv = os.Getenv("DNSIMPLE_OAUTH_TOKEN")
+
+func restoreDNSimpleEnv() {
+	os.Setenv("DNSIMPLE_OAUTH_TOKEN", dnsimpleTokenEnv)
+}
+
+func TestNewDNSProviderDNSimpleMissingCredErr(t *testing.T) {
+	os.Setenv("DNSIMPLE_OAUTH_TOKEN", "")
+	_, err := NewDNSProviderDNSimple("")
+	assert.EqualError(t, err, "DNSimple credentials missing")
+	restoreDNSimpleEnv()
+}
+
+func TestNewDNSProviderDNSimpleValidEnv(t *testing.T) {
+	os.Setenv("DNSIMPLE_OAUTH_TOKEN", "123")
+	_, err := NewDNSProviderDNSimple("")
+	assert.NoError(t, err)
+	restoreDNSimpleEnv()
+}
+
+func TestDNSimplePresentAndCleanUp(t *testing.T) {
+	var requests []string
+	var created dnsimpleRecord
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer 123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSONResponse(w, map[string]string{"message": "Authentication failed"})
+			return
+		}
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/whoami":
+			writeJSONResponse(w, map[string]interface{}{"data": map[string]interface{}{"user": nil, "account": map[string]interface{}{"id": 1010}}})
+		case r.Method == "POST" && r.URL.Path == "/1010/zones/example.com/records":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			created.ID = 42
+			w.WriteHeader(http.StatusCreated)
+			writeJSONResponse(w, map[string]dnsimpleRecord{"data": created})
+		case r.Method == "DELETE" && r.URL.Path == "/1010/zones/example.com/records/42":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderDNSimple("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	_, value, ttl := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, dnsimpleRecord{ID: 42, Name: "_acme-challenge.www", Type: "TXT", Content: value, TTL: ttl}, created)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{
+		"GET /whoami",
+		"POST /1010/zones/example.com/records",
+		"DELETE /1010/zones/example.com/records/42",
+	}, requests, "Expected the account ID to be looked up once")
+
+	provider, err = NewDNSProviderDNSimple("bad")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "DNSimple API call failed with HTTP status 401: Authentication failed")
+}
+
+func TestDNSimpleUserToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONResponse(w, map[string]interface{}{"data": map[string]interface{}{"user": map[string]interface{}{"id": 1}, "account": nil}})
+	}))
+	defer ts.Close()
+
+	provider, err := NewDNSProviderDNSimple("123")
+	assert.NoError(t, err)
+	provider.baseURL = ts.URL
+
+	_, err = provider.getAccountID()
+	assert.EqualError(t, err, "DNSimple access token is not an account token")
+}
@@ -0,0 +1,96 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const dreamhostAPIURL = "https://api.dreamhost.com"
+
+// DNSProviderDreamhost is an implementation of the ChallengeProvider interface
+// that uses Dreamhost's command API to manage TXT records.
+type DNSProviderDreamhost struct {
+	apiKey  string
+	baseURL string
+}
+
+// NewDNSProviderDreamhost returns a DNSProviderDreamhost instance with a configured Dreamhost client.
+// Authentication is either done using the passed API key or - when empty - using the environment
+// variable DREAMHOST_API_KEY.
+func NewDNSProviderDreamhost(apiKey string) (*DNSProviderDreamhost, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("DREAMHOST_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("Dreamhost credentials missing")
+		}
+	}
+
+	return &DNSProviderDreamhost{
+		apiKey:  apiKey,
+		baseURL: dreamhostAPIURL,
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (d *DNSProviderDreamhost) Present(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	return d.doRequest("dns-add_record", unFqdn(fqdn), value)
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (d *DNSProviderDreamhost) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	return d.doRequest("dns-remove_record", unFqdn(fqdn), value)
+}
+
+// doRequest runs the API command cmd for the TXT record with the given value.
+// Dreamhost answers every command with HTTP status 200; whether it succeeded
+// is only told by the result field of the body.
+func (d *DNSProviderDreamhost) doRequest(cmd, record, value string) error {
+	query := url.Values{
+		"key":    {d.apiKey},
+		"cmd":    {cmd},
+		"record": {record},
+		"type":   {"TXT"},
+		"value":  {value},
+		"format": {"json"},
+	}
+
+	req, err := http.NewRequest("GET", d.baseURL+"/?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("Dreamhost API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return fmt.Errorf("Dreamhost API call failed: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Dreamhost API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Result string `json:"result"`
+		Data   string `json:"data"`
+	}
+	if err := json.Unmarshal(msg, &result); err != nil {
+		return fmt.Errorf("Dreamhost API response could not be decoded: %v", err)
+	}
+	if result.Result != "success" {
+		return fmt.Errorf("Dreamhost API command %s failed: %s", cmd, result.Data)
+	}
+
+	return nil
+}
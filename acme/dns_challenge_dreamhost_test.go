@@ -0,0 +1,75 @@
+package acme
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dreamhostAPIKeyEnv = os.Getenv("DREAMHOST_API_KEY")
+
+func restoreDreamhostEnv() {
+	os.Setenv("DREAMHOST_API_KEY", dreamhostAPIKeyEnv)
+}
+
+func TestNewDNSProviderDreamhostMissingCredErr(t *testing.T) {
+	os.Setenv("DREAMHOST_API_KEY", "")
+	_, err := NewDNSProviderDreamhost("")
+	assert.EqualError(t, err, "Dreamhost credentials missing")
+	restoreDreamhostEnv()
+}
+
+func TestNewDNSProviderDreamhostValidEnv(t *testing.T) {
+	os.Setenv("DREAMHOST_API_KEY", "123")
+	_, err := NewDNSProviderDreamhost("")
+	assert.NoError(t, err)
+	restoreDreamhostEnv()
+}
+
+func TestDreamhostPresentAndCleanUp(t *testing.T) {
+	var queries []url.Values
+	existing := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		queries = append(queries, query)
+		if query.Get("key") != "123" {
+			writeJSONResponse(w, map[string]string{"result": "error", "data": "invalid_api_key"})
+			return
+		}
+		if query.Get("cmd") == "dns-add_record" && existing {
+			writeJSONResponse(w, map[string]string{"result": "error", "data": "record_already_exists_not_editable"})
+			return
+		}
+		writeJSONResponse(w, map[string]string{"result": "success", "data": "record_added"})
+	}))
+	defer ts.Close()
+
+	provider, err := NewDNSProviderDreamhost("123")
+	assert.NoError(t, err)
+	provider.baseURL = ts.URL
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	if assert.Len(t, queries, 2) {
+		for i, cmd := range []string{"dns-add_record", "dns-remove_record"} {
+			assert.Equal(t, url.Values{
+				"key":    {"123"},
+				"cmd":    {cmd},
+				"record": {"_acme-challenge.www.example.com"},
+				"type":   {"TXT"},
+				"value":  {value},
+				"format": {"json"},
+			}, queries[i])
+		}
+	}
+
+	existing = true
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "Dreamhost API command dns-add_record failed: record_already_exists_not_editable")
+}
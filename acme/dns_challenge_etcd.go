@@ -0,0 +1,166 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const etcdDefaultPrefix = "/skydns"
+
+// DNSProviderEtcd is an implementation of the ChallengeProvider interface
+// that writes TXT records into etcd in the layout served by the CoreDNS etcd
+// plugin (and SkyDNS). It talks to etcd through the JSON gateway of the v3
+// API.
+type DNSProviderEtcd struct {
+	endpoints []string
+	prefix    string
+}
+
+// NewDNSProviderEtcd returns a DNSProviderEtcd instance writing to the etcd
+// cluster at the given endpoints, e.g. "http://127.0.0.1:2379", below the
+// key prefix CoreDNS is configured with. When empty, the endpoints are read
+// from the comma separated environment variable ETCD_ENDPOINTS and the prefix
+// from ETCD_PREFIX, which defaults to "/skydns".
+func NewDNSProviderEtcd(endpoints []string, prefix string) (*DNSProviderEtcd, error) {
+	if len(endpoints) == 0 {
+		for _, endpoint := range strings.Split(os.Getenv("ETCD_ENDPOINTS"), ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+		if len(endpoints) == 0 {
+			return nil, fmt.Errorf("etcd endpoints missing")
+		}
+	}
+
+	if prefix == "" {
+		prefix = os.Getenv("ETCD_PREFIX")
+		if prefix == "" {
+			prefix = etcdDefaultPrefix
+		}
+	}
+
+	trimmed := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		trimmed[i] = strings.TrimSuffix(endpoint, "/")
+	}
+
+	return &DNSProviderEtcd{
+		endpoints: trimmed,
+		prefix:    "/" + strings.Trim(prefix, "/"),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (e *DNSProviderEtcd) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+
+	record, err := json.Marshal(etcdRecord{Text: value, TTL: ttl})
+	if err != nil {
+		return err
+	}
+
+	return e.do("/v3/kv/put", etcdKeyValue{
+		Key:   base64.StdEncoding.EncodeToString([]byte(e.key(fqdn, value))),
+		Value: base64.StdEncoding.EncodeToString(record),
+	})
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (e *DNSProviderEtcd) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+
+	return e.do("/v3/kv/deleterange", etcdKeyValue{
+		Key: base64.StdEncoding.EncodeToString([]byte(e.key(fqdn, value))),
+	})
+}
+
+// key returns the etcd key of the TXT record value at fqdn. CoreDNS expects
+// the labels of the name in reverse order below the prefix, so
+// _acme-challenge.example.com. becomes /skydns/com/example/_acme-challenge.
+// Every record of a name gets its own key below that path, named after the
+// value, so that the records for a domain and its wildcard can coexist.
+func (e *DNSProviderEtcd) key(fqdn, value string) string {
+	labels := strings.Split(strings.ToLower(unFqdn(fqdn)), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return e.prefix + "/" + strings.Join(labels, "/") + "/" + value
+}
+
+// etcdRecord is the value CoreDNS reads a record from.
+type etcdRecord struct {
+	Text string `json:"text"`
+	TTL  int    `json:"ttl"`
+}
+
+// etcdKeyValue is a put or delete range request of the v3 JSON gateway.
+// Keys and values are base64 encoded.
+type etcdKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// do posts reqBody to path on the first endpoint that can be reached.
+func (e *DNSProviderEtcd) do(path string, reqBody interface{}) error {
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, endpoint := range e.endpoints {
+		err := e.post(endpoint+path, body)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(etcdCallError); ok {
+			return err
+		}
+		errs = append(errs, err.Error())
+	}
+
+	return fmt.Errorf("etcd API call failed on all endpoints: %s", strings.Join(errs, "; "))
+}
+
+// etcdCallError is returned for requests etcd received and rejected; other
+// errors mean the endpoint could not be reached and the next one is tried.
+type etcdCallError struct {
+	status int
+	msg    string
+}
+
+func (e etcdCallError) Error() string {
+	return fmt.Sprintf("etcd API call failed with HTTP status %d: %s", e.status, e.msg)
+}
+
+func (e *DNSProviderEtcd) post(uri string, body []byte) error {
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return etcdCallError{status: resp.StatusCode, msg: strings.TrimSpace(string(msg))}
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package acme
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	etcdEndpointsEnv = os.Getenv("ETCD_ENDPOINTS")
+	etcdPrefixEnv    = os.Getenv("ETCD_PREFIX")
+)
+
+func restoreEtcdEnv() {
+	os.Setenv("ETCD_ENDPOINTS", etcdEndpointsEnv)
+	os.Setenv("ETCD_PREFIX", etcdPrefixEnv)
+}
+
+func TestNewDNSProviderEtcdMissingEndpointsErr(t *testing.T) {
+	os.Setenv("ETCD_ENDPOINTS", "")
+	_, err := NewDNSProviderEtcd(nil, "")
+	assert.EqualError(t, err, "etcd endpoints missing")
+	restoreEtcdEnv()
+}
+
+func TestNewDNSProviderEtcdValidEnv(t *testing.T) {
+	os.Setenv("ETCD_ENDPOINTS", "http://10.0.0.1:2379/, http://10.0.0.2:2379")
+	os.Setenv("ETCD_PREFIX", "")
+	provider, err := NewDNSProviderEtcd(nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:2379", "http://10.0.0.2:2379"}, provider.endpoints)
+	assert.Equal(t, "/skydns", provider.prefix)
+	restoreEtcdEnv()
+}
+
+// fakeEtcd implements the put and delete range calls of the etcd v3 JSON
+// gateway on an in-memory key space.
+type fakeEtcd struct {
+	t  *testing.T
+	mu sync.Mutex
+	kv map[string]string
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req etcdKeyValue
+	assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&req))
+	key, err := base64.StdEncoding.DecodeString(req.Key)
+	assert.NoError(f.t, err)
+	value, err := base64.StdEncoding.DecodeString(req.Value)
+	assert.NoError(f.t, err)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/v3/kv/put":
+		f.kv[string(key)] = string(value)
+		writeJSONResponse(w, map[string]interface{}{"header": map[string]string{"revision": "2"}})
+	case "/v3/kv/deleterange":
+		deleted := 0
+		if _, ok := f.kv[string(key)]; ok {
+			delete(f.kv, string(key))
+			deleted = 1
+		}
+		writeJSONResponse(w, map[string]interface{}{"deleted": deleted})
+	default:
+		http.Error(w, `{"error":"Not Found","code":5}`, http.StatusNotFound)
+	}
+}
+
+func (f *fakeEtcd) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.kv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDNSProviderEtcdKeyLayout(t *testing.T) {
+	fake := &fakeEtcd{t: t, kv: make(map[string]string)}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	provider, err := NewDNSProviderEtcd([]string{ts.URL}, "/coredns/")
+	assert.NoError(t, err)
+
+	assert.NoError(t, provider.Present("www.Example.com", "", "keyAuth1"))
+	assert.NoError(t, provider.Present("*.www.example.com", "", "keyAuth2"))
+
+	_, value1, ttl := DNS01Record("www.example.com", "keyAuth1")
+	_, value2, _ := DNS01Record("*.www.example.com", "keyAuth2")
+	key1 := "/coredns/com/example/www/_acme-challenge/" + value1
+	key2 := "/coredns/com/example/www/_acme-challenge/" + value2
+
+	expected := []string{key1, key2}
+	sort.Strings(expected)
+	assert.Equal(t, expected, fake.keys())
+
+	var record etcdRecord
+	assert.NoError(t, json.Unmarshal([]byte(fake.kv[key1]), &record))
+	assert.Equal(t, etcdRecord{Text: value1, TTL: ttl}, record)
+
+	assert.NoError(t, provider.CleanUp("www.Example.com", "", "keyAuth1"))
+	assert.Equal(t, []string{key2}, fake.keys())
+	assert.NoError(t, provider.CleanUp("*.www.example.com", "", "keyAuth2"))
+	assert.Empty(t, fake.keys())
+}
+
+func TestDNSProviderEtcdEndpointFailover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	fake := &fakeEtcd{t: t, kv: make(map[string]string)}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	provider, err := NewDNSProviderEtcd([]string{downURL, ts.URL}, "")
+	assert.NoError(t, err)
+	assert.NoError(t, provider.Present("example.com", "", "keyAuth"))
+	assert.Len(t, fake.keys(), 1)
+
+	provider, err = NewDNSProviderEtcd([]string{downURL}, "")
+	assert.NoError(t, err)
+	err = provider.Present("example.com", "", "keyAuth")
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "etcd API call failed on all endpoints"), err.Error())
+	}
+}
+
+func TestDNSProviderEtcdRejected(t *testing.T) {
+	var calls int
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, `{"error":"etcdserver: permission denied","code":7}`, http.StatusForbidden)
+	}))
+	defer rejecting.Close()
+
+	fake := &fakeEtcd{t: t, kv: make(map[string]string)}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	provider, err := NewDNSProviderEtcd([]string{rejecting.URL, ts.URL}, "")
+	assert.NoError(t, err)
+	err = provider.Present("example.com", "", "keyAuth")
+	assert.EqualError(t, err, `etcd API call failed with HTTP status 403: {"error":"etcdserver: permission denied","code":7}`)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, fake.keys(), "a rejected request must not be retried on another endpoint")
+}
@@ -0,0 +1,59 @@
+package acme
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DNSProviderExec is an implementation of the ChallengeProvider interface that
+// runs an external program to create and remove TXT records.
+type DNSProviderExec struct {
+	program string
+}
+
+// NewDNSProviderExec returns a DNSProviderExec instance which runs 'program'.
+// When 'program' is empty, the path is read from the environment variable EXEC_PATH.
+//
+// The program is called as "program present <fqdn> <value> <ttl>" for Present
+// and "program cleanup <fqdn> <value>" for CleanUp. The fqdn and value are also
+// passed in the environment variables LEGO_FQDN and LEGO_VALUE.
+func NewDNSProviderExec(program string) (*DNSProviderExec, error) {
+	if program == "" {
+		program = os.Getenv("EXEC_PATH")
+	}
+	if program == "" {
+		return nil, fmt.Errorf("Exec program path missing")
+	}
+
+	return &DNSProviderExec{program: program}, nil
+}
+
+// Present runs the program to create a TXT record to fulfil the dns-01 challenge
+func (e *DNSProviderExec) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	return e.run(fqdn, value, "present", fqdn, value, strconv.Itoa(ttl))
+}
+
+// CleanUp runs the program to remove the TXT record matching the specified parameters
+func (e *DNSProviderExec) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	return e.run(fqdn, value, "cleanup", fqdn, value)
+}
+
+func (e *DNSProviderExec) run(fqdn, value string, args ...string) error {
+	cmd := exec.Command(e.program, args...)
+	cmd.Env = append(os.Environ(), "LEGO_FQDN="+fqdn, "LEGO_VALUE="+value)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Exec program %s %s failed: %v: %s", e.program, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package acme
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var execPath string
+
+func init() {
+	execPath = os.Getenv("EXEC_PATH")
+}
+
+func restoreExecEnv() {
+	os.Setenv("EXEC_PATH", execPath)
+}
+
+// writeExecScript writes a shell script to a temporary directory and
+// returns the path of the script and the file it records its calls in.
+func writeExecScript(t *testing.T, body string) (string, string, func()) {
+	dir, err := ioutil.TempDir("", "lego-exec")
+	if err != nil {
+		t.Fatal("Could not create temp dir:", err)
+	}
+
+	script := filepath.Join(dir, "hook.sh")
+	out := filepath.Join(dir, "calls")
+	err = ioutil.WriteFile(script, []byte("#!/bin/sh\n"+strings.Replace(body, "$OUT", out, -1)), 0700)
+	if err != nil {
+		t.Fatal("Could not write script:", err)
+	}
+
+	return script, out, func() { os.RemoveAll(dir) }
+}
+
+func TestNewDNSProviderExecMissingPathErr(t *testing.T) {
+	os.Setenv("EXEC_PATH", "")
+	_, err := NewDNSProviderExec("")
+	assert.EqualError(t, err, "Exec program path missing")
+	restoreExecEnv()
+}
+
+func TestNewDNSProviderExecValidEnv(t *testing.T) {
+	os.Setenv("EXEC_PATH", "/usr/local/bin/hook")
+	provider, err := NewDNSProviderExec("")
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/local/bin/hook", provider.program)
+	restoreExecEnv()
+}
+
+func TestDNSProviderExecPresentAndCleanUp(t *testing.T) {
+	script, out, cleanup := writeExecScript(t, `echo "$@ $LEGO_FQDN $LEGO_VALUE" >> $OUT`)
+	defer cleanup()
+
+	provider, err := NewDNSProviderExec(script)
+	assert.NoError(t, err)
+
+	fqdn, value, _ := DNS01Record("example.com", "123d==")
+	assert.NoError(t, provider.Present("example.com", "", "123d=="))
+	assert.NoError(t, provider.CleanUp("example.com", "", "123d=="))
+
+	calls, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"present " + fqdn + " " + value + " 120 " + fqdn + " " + value,
+		"cleanup " + fqdn + " " + value + " " + fqdn + " " + value,
+	}, strings.Split(strings.TrimSpace(string(calls)), "\n"))
+}
+
+func TestDNSProviderExecFailure(t *testing.T) {
+	script, _, cleanup := writeExecScript(t, "echo 'zone not found' >&2\nexit 3")
+	defer cleanup()
+
+	provider, err := NewDNSProviderExec(script)
+	assert.NoError(t, err)
+
+	err = provider.Present("example.com", "", "123d==")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exit status 3")
+		assert.Contains(t, err.Error(), "zone not found")
+	}
+}
@@ -0,0 +1,215 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	gandiLiveDNSURL = "https://dns.api.gandi.net/api/v5"
+	// gandiMinTTL is the lowest TTL LiveDNS accepts for a record.
+	gandiMinTTL = 300
+)
+
+// DNSProviderGandi is an implementation of the ChallengeProvider interface
+// that uses Gandi's LiveDNS API to manage TXT records.
+type DNSProviderGandi struct {
+	apiKey  string
+	baseURL string
+}
+
+// NewDNSProviderGandi returns a DNSProviderGandi instance with a configured Gandi LiveDNS client.
+// Authentication is either done using the passed API key or - when empty - using the environment
+// variable GANDI_API_KEY.
+func NewDNSProviderGandi(apiKey string) (*DNSProviderGandi, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("GANDI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("Gandi credentials missing")
+		}
+	}
+
+	return &DNSProviderGandi{
+		apiKey:  apiKey,
+		baseURL: gandiLiveDNSURL,
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge. Values already
+// present for the same name are kept, so that challenges for a domain and its
+// wildcard can be solved at the same time.
+func (g *DNSProviderGandi) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, name, err := g.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	rrset, err := g.getRRSet(zone, name)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range rrset.Values {
+		if v == value {
+			return nil
+		}
+	}
+
+	rrset.TTL = clampTTL(ttl, gandiMinTTL, "Gandi")
+	rrset.Values = append(rrset.Values, value)
+
+	return g.putRRSet(zone, name, rrset)
+}
+
+// CleanUp removes the TXT record matching the specified parameters. The rrset
+// is deleted once no other values are left in it.
+func (g *DNSProviderGandi) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, name, err := g.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	rrset, err := g.getRRSet(zone, name)
+	if err != nil {
+		return err
+	}
+
+	var keep []string
+	for _, v := range rrset.Values {
+		if v != value {
+			keep = append(keep, v)
+		}
+	}
+
+	if len(keep) > 0 {
+		rrset.Values = keep
+		return g.putRRSet(zone, name, rrset)
+	}
+
+	_, err = g.doRequest("DELETE", g.recordURL(zone, name), nil)
+	return err
+}
+
+// CleanUpAll deletes all challenge TXT records in zone.
+func (g *DNSProviderGandi) CleanUpAll(zone string) error {
+	zone = unFqdn(zone)
+
+	resp, err := g.doRequest("GET", fmt.Sprintf("%s/domains/%s/records", g.baseURL, zone), nil)
+	if err != nil {
+		return err
+	}
+
+	var records []gandiRecord
+	if err := json.Unmarshal(resp, &records); err != nil {
+		return fmt.Errorf("Gandi API response could not be decoded: %v", err)
+	}
+
+	for _, rec := range records {
+		if rec.Type != "TXT" || !isChallengeRecordName(rec.Name) {
+			continue
+		}
+		logf("[INFO] acme: Deleting stale TXT record %s.%s", rec.Name, zone)
+		if _, err := g.doRequest("DELETE", g.recordURL(zone, rec.Name), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitFqdn returns the zone of fqdn and the record name relative to that zone.
+func (g *DNSProviderGandi) splitFqdn(fqdn string) (zone, name string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = "@"
+	}
+
+	return unFqdn(zone), name, nil
+}
+
+type gandiRRSet struct {
+	TTL    int      `json:"rrset_ttl,omitempty"`
+	Values []string `json:"rrset_values"`
+}
+
+type gandiRecord struct {
+	Name string `json:"rrset_name"`
+	Type string `json:"rrset_type"`
+}
+
+func (g *DNSProviderGandi) recordURL(zone, name string) string {
+	return fmt.Sprintf("%s/domains/%s/records/%s/TXT", g.baseURL, zone, name)
+}
+
+// getRRSet returns the TXT rrset for name, which is empty if it does not exist yet.
+func (g *DNSProviderGandi) getRRSet(zone, name string) (gandiRRSet, error) {
+	var rrset gandiRRSet
+
+	resp, err := g.doRequest("GET", g.recordURL(zone, name), nil)
+	if err == errGandiNotFound {
+		return rrset, nil
+	}
+	if err != nil {
+		return rrset, err
+	}
+
+	if err := json.Unmarshal(resp, &rrset); err != nil {
+		return rrset, fmt.Errorf("Gandi API response could not be decoded: %v", err)
+	}
+
+	return rrset, nil
+}
+
+func (g *DNSProviderGandi) putRRSet(zone, name string, rrset gandiRRSet) error {
+	body, err := json.Marshal(rrset)
+	if err != nil {
+		return err
+	}
+
+	_, err = g.doRequest("PUT", g.recordURL(zone, name), bytes.NewReader(body))
+	return err
+}
+
+var errGandiNotFound = fmt.Errorf("Gandi API call failed with HTTP status %d", http.StatusNotFound)
+
+func (g *DNSProviderGandi) doRequest(method, uri string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Apikey "+g.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("Gandi API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("Gandi API call failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errGandiNotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Gandi API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,147 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var gandiAPIKeyEnv = os.Getenv("GANDI_API_KEY")
+
+func restoreGandiEnv() {
+	os.Setenv("GANDI_API_KEY", gandiAPIKeyEnv)
+}
+
+func TestNewDNSProviderGandiMissingCredErr(t *testing.T) {
+	os.Setenv("GANDI_API_KEY", "")
+	_, err := NewDNSProviderGandi("")
+	assert.EqualError(t, err, "Gandi credentials missing")
+	restoreGandiEnv()
+}
+
+func TestNewDNSProviderGandiValidEnv(t *testing.T) {
+	os.Setenv("GANDI_API_KEY", "123")
+	_, err := NewDNSProviderGandi("")
+	assert.NoError(t, err)
+	restoreGandiEnv()
+}
+
+// fakeLiveDNS stores TXT rrsets keyed by request path.
+type fakeLiveDNS struct {
+	t       *testing.T
+	rrsets  map[string]gandiRRSet
+	methods []string
+}
+
+func (f *fakeLiveDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Apikey 123" {
+		http.Error(w, `{"message": "unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	f.methods = append(f.methods, r.Method)
+
+	if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/records") {
+		var records []gandiRecord
+		for path := range f.rrsets {
+			parts := strings.Split(strings.TrimPrefix(path, r.URL.Path+"/"), "/")
+			records = append(records, gandiRecord{Name: parts[0], Type: parts[1]})
+		}
+		writeJSONResponse(w, records)
+		return
+	}
+
+	rrset, ok := f.rrsets[r.URL.Path]
+
+	switch r.Method {
+	case "GET":
+		if !ok {
+			http.Error(w, `{"message": "Can't find the DNS record"}`, http.StatusNotFound)
+			return
+		}
+		writeJSONResponse(w, rrset)
+	case "PUT":
+		var rec gandiRRSet
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&rec))
+		f.rrsets[r.URL.Path] = rec
+		w.WriteHeader(http.StatusCreated)
+	case "DELETE":
+		delete(f.rrsets, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestGandiPresentAndCleanUp(t *testing.T) {
+	recordPath := "/domains/example.com/records/_acme-challenge.www/TXT"
+	fake := &fakeLiveDNS{t: t, rrsets: map[string]gandiRRSet{}}
+	apiURL, done := startDNSProviderTest(t, fake)
+	defer done()
+
+	provider, err := NewDNSProviderGandi("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	_, value1, _ := DNS01Record("www.example.com", "123d==")
+	_, value2, _ := DNS01Record("www.example.com", "456d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.NoError(t, provider.Present("www.example.com", "", "456d=="))
+	assert.Equal(t, gandiRRSet{TTL: gandiMinTTL, Values: []string{value1, value2}}, fake.rrsets[recordPath])
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{value2}, fake.rrsets[recordPath].Values)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "456d=="))
+	_, ok := fake.rrsets[recordPath]
+	assert.False(t, ok, "Expected the rrset to be deleted")
+	assert.Equal(t, "DELETE", fake.methods[len(fake.methods)-1])
+}
+
+func TestGandiCleanUpAll(t *testing.T) {
+	fake := &fakeLiveDNS{t: t, rrsets: map[string]gandiRRSet{
+		"/domains/example.com/records/_acme-challenge/TXT":       {Values: []string{"a"}},
+		"/domains/example.com/records/_acme-challenge.www/TXT":   {Values: []string{"b"}},
+		"/domains/example.com/records/_acme-challenge.a.b/TXT":   {Values: []string{"c"}},
+		"/domains/example.com/records/_dmarc/TXT":                {Values: []string{"v=DMARC1"}},
+		"/domains/example.com/records/_acme-challenge.www/CNAME": {Values: []string{"elsewhere."}},
+	}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	provider, err := NewDNSProviderGandi("123")
+	assert.NoError(t, err)
+	provider.baseURL = ts.URL
+
+	var _ ChallengeCleaner = provider
+	assert.NoError(t, provider.CleanUpAll("example.com."))
+
+	var left []string
+	for path := range fake.rrsets {
+		left = append(left, path)
+	}
+	sort.Strings(left)
+	assert.Equal(t, []string{
+		"/domains/example.com/records/_acme-challenge.www/CNAME",
+		"/domains/example.com/records/_dmarc/TXT",
+	}, left)
+}
+
+func TestGandiAPIError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	provider, err := NewDNSProviderGandi("bad")
+	assert.NoError(t, err)
+	provider.baseURL = ts.URL
+
+	_, err = provider.getRRSet("example.com", "_acme-challenge")
+	assert.EqualError(t, err, `Gandi API call failed with HTTP status 401: {"message": "unauthorized"}`)
+}
@@ -0,0 +1,224 @@
+package acme
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/dns/v1"
+)
+
+const (
+	// googleCloudTimeout is how long to wait for a change to be done.
+	googleCloudTimeout = 180 * time.Second
+	// googleCloudInterval is how often the change status is polled.
+	googleCloudInterval = 5 * time.Second
+)
+
+// DNSProviderGoogleCloud is an implementation of the ChallengeProvider interface
+// that uses the Google Cloud DNS API to manage TXT records.
+type DNSProviderGoogleCloud struct {
+	project string
+	client  *dns.Service
+}
+
+// NewDNSProviderGoogleCloud returns a DNSProviderGoogleCloud instance with a configured Cloud DNS client.
+// Authentication is either done using the passed project and service account key (JSON) or - when
+// empty - using the environment variables GCE_PROJECT and GCE_SERVICE_ACCOUNT_FILE.
+func NewDNSProviderGoogleCloud(project string, serviceAccountJSON []byte) (*DNSProviderGoogleCloud, error) {
+	if project == "" {
+		project = os.Getenv("GCE_PROJECT")
+	}
+
+	if len(serviceAccountJSON) == 0 {
+		saFile := os.Getenv("GCE_SERVICE_ACCOUNT_FILE")
+		if saFile != "" {
+			var err error
+			serviceAccountJSON, err = ioutil.ReadFile(saFile)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read Google Cloud service account file: %v", err)
+			}
+		}
+	}
+
+	if project == "" || len(serviceAccountJSON) == 0 {
+		return nil, fmt.Errorf("Google Cloud credentials missing")
+	}
+
+	conf, err := google.JWTConfigFromJSON(serviceAccountJSON, dns.NdevClouddnsReadwriteScope)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse Google Cloud service account: %v", err)
+	}
+
+	client, err := dns.New(conf.Client(context.Background()))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create Google Cloud DNS service: %v", err)
+	}
+
+	return &DNSProviderGoogleCloud{project: project, client: client}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge. If the
+// record set exists already, e.g. for a wildcard and its base domain, the
+// value is added to it.
+func (c *DNSProviderGoogleCloud) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, err := c.getHostedZone(fqdn)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findTxtRecord(zone, fqdn)
+	if err != nil {
+		return err
+	}
+
+	rec := &dns.ResourceRecordSet{
+		Name:    fqdn,
+		Rrdatas: []string{value},
+		Ttl:     int64(ttl),
+		Type:    "TXT",
+	}
+	change := &dns.Change{
+		Additions: []*dns.ResourceRecordSet{rec},
+	}
+	// Cloud DNS rejects additions to an existing record set, so it is
+	// replaced by one with all its values.
+	if existing != nil {
+		for _, data := range existing.Rrdatas {
+			if googleCloudTxtValue(data) == value {
+				return nil
+			}
+		}
+		rec.Rrdatas = append(append([]string{}, existing.Rrdatas...), value)
+		change.Deletions = []*dns.ResourceRecordSet{existing}
+	}
+
+	chg, err := c.client.Changes.Create(c.project, zone, change).Do()
+	if err != nil {
+		return fmt.Errorf("Google Cloud API call failed: %v", err)
+	}
+
+	// Cloud DNS applies changes asynchronously. Only return
+	// once the change has transitioned from pending to done.
+	return waitFor(googleCloudTimeout, googleCloudInterval, func() (bool, error) {
+		return c.changeDone(zone, chg)
+	})
+}
+
+// CleanUp removes the TXT record matching the specified parameters. Other
+// values of the record set are kept.
+func (c *DNSProviderGoogleCloud) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, err := c.getHostedZone(fqdn)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.findTxtRecord(zone, fqdn)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return nil
+	}
+
+	var remaining []string
+	for _, data := range existing.Rrdatas {
+		if googleCloudTxtValue(data) != value {
+			remaining = append(remaining, data)
+		}
+	}
+	if len(remaining) == len(existing.Rrdatas) {
+		return nil
+	}
+
+	change := &dns.Change{
+		Deletions: []*dns.ResourceRecordSet{existing},
+	}
+	if len(remaining) > 0 {
+		change.Additions = []*dns.ResourceRecordSet{{
+			Name:    existing.Name,
+			Rrdatas: remaining,
+			Ttl:     existing.Ttl,
+			Type:    existing.Type,
+		}}
+	}
+	_, err = c.client.Changes.Create(c.project, zone, change).Do()
+	if err != nil {
+		return fmt.Errorf("Google Cloud API call failed: %v", err)
+	}
+
+	return nil
+}
+
+// changeDone reports whether the Cloud DNS change chg has been applied.
+// The status of chg is refreshed from the API until it is no longer pending.
+func (c *DNSProviderGoogleCloud) changeDone(zone string, chg *dns.Change) (bool, error) {
+	if chg.Status == "done" {
+		return true, nil
+	}
+
+	latest, err := c.client.Changes.Get(c.project, zone, chg.Id).Do()
+	if err != nil {
+		return false, err
+	}
+	*chg = *latest
+
+	return chg.Status == "done", nil
+}
+
+// getHostedZone returns the name of the managed zone with the longest
+// dnsName which fqdn is in.
+func (c *DNSProviderGoogleCloud) getHostedZone(fqdn string) (string, error) {
+	var hostedZone *dns.ManagedZone
+	err := c.client.ManagedZones.List(c.project).Pages(context.Background(), func(zones *dns.ManagedZonesListResponse) error {
+		for _, zone := range zones.ManagedZones {
+			zoneName := toFqdn(zone.DnsName)
+			if fqdn != zoneName && !strings.HasSuffix(fqdn, "."+zoneName) {
+				continue
+			}
+			if hostedZone == nil || len(zone.DnsName) > len(hostedZone.DnsName) {
+				hostedZone = zone
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Google Cloud API call failed: %v", err)
+	}
+	if hostedZone == nil {
+		return "", fmt.Errorf("No matching Google Cloud managed zone found for domain %s", fqdn)
+	}
+
+	return hostedZone.Name, nil
+}
+
+// findTxtRecord returns the TXT record set of fqdn, or nil if there is none.
+func (c *DNSProviderGoogleCloud) findTxtRecord(zone, fqdn string) (*dns.ResourceRecordSet, error) {
+	recs, err := c.client.ResourceRecordSets.List(c.project, zone).Name(fqdn).Type("TXT").Do()
+	if err != nil {
+		return nil, fmt.Errorf("Google Cloud API call failed: %v", err)
+	}
+
+	for _, r := range recs.Rrsets {
+		if r.Name == fqdn && r.Type == "TXT" {
+			return r, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// googleCloudTxtValue returns the value of the TXT rrdata data, which Cloud
+// DNS returns quoted.
+func googleCloudTxtValue(data string) string {
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		return data[1 : len(data)-1]
+	}
+	return data
+}
@@ -0,0 +1,251 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/dns/v1"
+)
+
+var (
+	gcloudProject string
+	gcloudSAFile  string
+)
+
+func init() {
+	gcloudProject = os.Getenv("GCE_PROJECT")
+	gcloudSAFile = os.Getenv("GCE_SERVICE_ACCOUNT_FILE")
+}
+
+func restoreGoogleCloudEnv() {
+	os.Setenv("GCE_PROJECT", gcloudProject)
+	os.Setenv("GCE_SERVICE_ACCOUNT_FILE", gcloudSAFile)
+}
+
+// googleCloudTestAccount returns a service account key which fetches
+// its tokens from tokenURL.
+func googleCloudTestAccount(t *testing.T, tokenURL string) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	data, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "lego@example.iam.gserviceaccount.com",
+		"private_key":  string(keyPEM),
+		"token_uri":    tokenURL,
+	})
+	if err != nil {
+		t.Fatal("Could not marshal service account:", err)
+	}
+	return data
+}
+
+func TestNewDNSProviderGoogleCloudMissingCredErr(t *testing.T) {
+	os.Setenv("GCE_PROJECT", "")
+	os.Setenv("GCE_SERVICE_ACCOUNT_FILE", "")
+	_, err := NewDNSProviderGoogleCloud("", nil)
+	assert.EqualError(t, err, "Google Cloud credentials missing")
+	restoreGoogleCloudEnv()
+}
+
+func TestNewDNSProviderGoogleCloudValidEnv(t *testing.T) {
+	f, err := ioutil.TempFile("", "lego-gcloud")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Write(googleCloudTestAccount(t, "http://localhost/token"))
+	f.Close()
+
+	os.Setenv("GCE_PROJECT", "lego-project")
+	os.Setenv("GCE_SERVICE_ACCOUNT_FILE", f.Name())
+	provider, err := NewDNSProviderGoogleCloud("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "lego-project", provider.project)
+	restoreGoogleCloudEnv()
+}
+
+// fakeCloudDNS serves the managed zones of a project two per page and
+// holds the rrsets of the zone sub-example-com. Like Cloud DNS, it rejects
+// the addition of an rrset which exists already.
+type fakeCloudDNS struct {
+	t       *testing.T
+	zones   []*dns.ManagedZone
+	rrsets  map[string]*dns.ResourceRecordSet
+	changes []*dns.Change
+}
+
+func newFakeCloudDNS(t *testing.T) *fakeCloudDNS {
+	return &fakeCloudDNS{
+		t: t,
+		zones: []*dns.ManagedZone{
+			{Name: "example-com", DnsName: "example.com."},
+			{Name: "ample-com", DnsName: "ample.com."},
+			{Name: "example-org", DnsName: "example.org."},
+			{Name: "sub-example-com", DnsName: "sub.example.com."},
+		},
+		rrsets: make(map[string]*dns.ResourceRecordSet),
+	}
+}
+
+func (f *fakeCloudDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const zone = "/managedZones/sub-example-com"
+	switch {
+	case r.URL.Path == "/token":
+		writeJSONResponse(w, map[string]interface{}{"access_token": "123", "token_type": "Bearer", "expires_in": 3600})
+	case r.Header.Get("Authorization") != "Bearer 123":
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	case strings.HasSuffix(r.URL.Path, "/managedZones"):
+		start := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			start, _ = strconv.Atoi(token)
+		}
+		end := start + 2
+		resp := &dns.ManagedZonesListResponse{ManagedZones: f.zones[start:]}
+		if end < len(f.zones) {
+			resp.ManagedZones = f.zones[start:end]
+			resp.NextPageToken = strconv.Itoa(end)
+		}
+		writeJSONResponse(w, resp)
+	case strings.HasSuffix(r.URL.Path, zone+"/changes") && r.Method == "POST":
+		var change dns.Change
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&change))
+		for _, rec := range change.Deletions {
+			delete(f.rrsets, rec.Name)
+		}
+		for _, rec := range change.Additions {
+			if _, ok := f.rrsets[rec.Name]; ok {
+				http.Error(w, "resource record set already exists", http.StatusConflict)
+				return
+			}
+			f.rrsets[rec.Name] = rec
+		}
+		f.changes = append(f.changes, &change)
+		writeJSONResponse(w, &dns.Change{Id: "1", Status: "pending"})
+	case strings.HasSuffix(r.URL.Path, zone+"/changes/1"):
+		writeJSONResponse(w, &dns.Change{Id: "1", Status: "done"})
+	case strings.HasSuffix(r.URL.Path, zone+"/rrsets"):
+		resp := &dns.ResourceRecordSetsListResponse{}
+		if rec, ok := f.rrsets[r.URL.Query().Get("name")]; ok {
+			resp.Rrsets = append(resp.Rrsets, rec)
+		}
+		writeJSONResponse(w, resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startGoogleCloudTest(t *testing.T) (*DNSProviderGoogleCloud, *fakeCloudDNS, func()) {
+	fake := newFakeCloudDNS(t)
+	ts := httptest.NewServer(fake)
+
+	provider, err := NewDNSProviderGoogleCloud("lego-project", googleCloudTestAccount(t, ts.URL+"/token"))
+	assert.NoError(t, err)
+	provider.client.BasePath = ts.URL + "/"
+
+	return provider, fake, ts.Close
+}
+
+func TestGoogleCloudPresentAndCleanUp(t *testing.T) {
+	provider, fake, done := startGoogleCloudTest(t)
+	defer done()
+
+	domain := "www.sub.example.com"
+	keyAuth := "123d=="
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+
+	err := provider.Present(domain, "", keyAuth)
+	assert.NoError(t, err)
+	if assert.Len(t, fake.changes, 1) && assert.Len(t, fake.changes[0].Additions, 1) {
+		rec := fake.changes[0].Additions[0]
+		assert.Equal(t, fqdn, rec.Name)
+		assert.Equal(t, "TXT", rec.Type)
+		assert.Equal(t, []string{value}, rec.Rrdatas)
+		assert.Equal(t, int64(ttl), rec.Ttl)
+	}
+
+	err = provider.CleanUp(domain, "", keyAuth)
+	assert.NoError(t, err)
+	if assert.Len(t, fake.changes, 2) && assert.Len(t, fake.changes[1].Deletions, 1) {
+		assert.Equal(t, fqdn, fake.changes[1].Deletions[0].Name)
+		assert.Empty(t, fake.changes[1].Additions)
+	}
+	assert.Empty(t, fake.rrsets)
+}
+
+func TestGoogleCloudExistingRecordSet(t *testing.T) {
+	provider, fake, done := startGoogleCloudTest(t)
+	defer done()
+
+	fqdn, value, ttl := DNS01Record("sub.example.com", "123d==")
+	fake.rrsets[fqdn] = &dns.ResourceRecordSet{Name: fqdn, Type: "TXT", Ttl: 300, Rrdatas: []string{`"other"`}}
+
+	assert.NoError(t, provider.Present("sub.example.com", "", "123d=="))
+	assert.Equal(t, []string{`"other"`, value}, fake.rrsets[fqdn].Rrdatas)
+	assert.Equal(t, int64(ttl), fake.rrsets[fqdn].Ttl)
+
+	// The value is there already.
+	assert.NoError(t, provider.Present("sub.example.com", "", "123d=="))
+	assert.Len(t, fake.changes, 1)
+
+	fake.rrsets[fqdn].Rrdatas = []string{`"other"`, `"` + value + `"`}
+	assert.NoError(t, provider.CleanUp("sub.example.com", "", "123d=="))
+	if assert.Contains(t, fake.rrsets, fqdn) {
+		assert.Equal(t, []string{`"other"`}, fake.rrsets[fqdn].Rrdatas)
+		assert.Equal(t, int64(ttl), fake.rrsets[fqdn].Ttl)
+	}
+}
+
+func TestGoogleCloudHostedZone(t *testing.T) {
+	provider, _, done := startGoogleCloudTest(t)
+	defer done()
+
+	for fqdn, want := range map[string]string{
+		"_acme-challenge.www.sub.example.com.": "sub-example-com",
+		"sub.example.com.":                     "sub-example-com",
+		"_acme-challenge.example.com.":         "example-com",
+		"_acme-challenge.ample.com.":           "ample-com",
+	} {
+		zone, err := provider.getHostedZone(fqdn)
+		assert.NoError(t, err)
+		assert.Equal(t, want, zone, fqdn)
+	}
+
+	_, err := provider.getHostedZone("_acme-challenge.eexample.org.")
+	assert.EqualError(t, err, "No matching Google Cloud managed zone found for domain _acme-challenge.eexample.org.")
+}
+
+func TestGoogleCloudNoMatchingZone(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			writeJSONResponse(w, map[string]interface{}{"access_token": "123", "token_type": "Bearer", "expires_in": 3600})
+		case strings.HasSuffix(r.URL.Path, "/managedZones"):
+			writeJSONResponse(w, &dns.ManagedZonesListResponse{ManagedZones: []*dns.ManagedZone{
+				{Name: "example-org", DnsName: "example.org."},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	provider, err := NewDNSProviderGoogleCloud("lego-project", googleCloudTestAccount(t, ts.URL+"/token"))
+	assert.NoError(t, err)
+	provider.client.BasePath = ts.URL + "/"
+
+	err = provider.Present("example.com", "", "123d==")
+	assert.EqualError(t, err, "No matching Google Cloud managed zone found for domain _acme-challenge.example.com.")
+}
@@ -0,0 +1,225 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const hetznerAPIURL = "https://dns.hetzner.com/api/v1"
+
+// DNSProviderHetzner is an implementation of the ChallengeProvider interface
+// that uses the Hetzner DNS Console API to manage TXT records.
+type DNSProviderHetzner struct {
+	apiKey  string
+	baseURL string
+
+	mu        sync.Mutex
+	recordIDs map[string]string
+}
+
+// NewDNSProviderHetzner returns a DNSProviderHetzner instance with a configured Hetzner client.
+// Authentication is either done using the passed API token or - when empty - using the environment
+// variable HETZNER_API_KEY.
+func NewDNSProviderHetzner(apiKey string) (*DNSProviderHetzner, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("HETZNER_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("Hetzner credentials missing")
+		}
+	}
+
+	return &DNSProviderHetzner{
+		apiKey:    apiKey,
+		baseURL:   hetznerAPIURL,
+		recordIDs: make(map[string]string),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (h *DNSProviderHetzner) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zoneID, name, err := h.lookupZone(fqdn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(hetznerRecord{ZoneID: zoneID, Type: "TXT", Name: name, Value: value, TTL: ttl})
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.doRequest("POST", h.baseURL+"/records", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var created struct {
+		Record hetznerRecord `json:"record"`
+	}
+	if err := json.Unmarshal(resp, &created); err != nil {
+		return fmt.Errorf("Hetzner API response could not be decoded: %v", err)
+	}
+
+	h.mu.Lock()
+	h.recordIDs[fqdn+value] = created.Record.ID
+	h.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (h *DNSProviderHetzner) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zoneID, name, err := h.lookupZone(fqdn)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	recordID, ok := h.recordIDs[fqdn+value]
+	h.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		return h.findRecordID(zoneID, name, value)
+	}, h.deleteRecord, recordID, ok)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	delete(h.recordIDs, fqdn+value)
+	h.mu.Unlock()
+
+	return nil
+}
+
+// lookupZone returns the Hetzner ID of the zone of fqdn and the record name
+// relative to that zone.
+func (h *DNSProviderHetzner) lookupZone(fqdn string) (string, string, error) {
+	zone, err := findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = "@"
+	}
+	zone = unFqdn(zone)
+
+	resp, err := h.doRequest("GET", h.baseURL+"/zones?"+url.Values{"name": {zone}}.Encode(), nil)
+	if err == errHetznerNotFound {
+		return "", "", fmt.Errorf("Hetzner zone %s not found", zone)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	var zones struct {
+		Zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"zones"`
+	}
+	if err := json.Unmarshal(resp, &zones); err != nil {
+		return "", "", fmt.Errorf("Hetzner API response could not be decoded: %v", err)
+	}
+
+	for _, z := range zones.Zones {
+		if strings.EqualFold(z.Name, zone) {
+			return z.ID, name, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("Hetzner zone %s not found", zone)
+}
+
+func (h *DNSProviderHetzner) deleteRecord(recordID string) error {
+	_, err := h.doRequest("DELETE", h.baseURL+"/records/"+recordID, nil)
+	return err
+}
+
+// findRecordID returns the id of the TXT record name with the given value.
+func (h *DNSProviderHetzner) findRecordID(zoneID, name, value string) (string, error) {
+	resp, err := h.doRequest("GET", h.baseURL+"/records?"+url.Values{"zone_id": {zoneID}}.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var records struct {
+		Records []hetznerRecord `json:"records"`
+	}
+	if err := json.Unmarshal(resp, &records); err != nil {
+		return "", fmt.Errorf("Hetzner API response could not be decoded: %v", err)
+	}
+
+	for _, rec := range records.Records {
+		if rec.Type == "TXT" && rec.Name == name && rec.Value == value {
+			return rec.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("Hetzner TXT record %s with value %s not found", name, value)
+}
+
+type hetznerRecord struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+var errHetznerNotFound = fmt.Errorf("Hetzner API call failed with HTTP status %d", http.StatusNotFound)
+
+func (h *DNSProviderHetzner) doRequest(method, uri string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Auth-API-Token", h.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("Hetzner API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("Hetzner API call failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errHetznerNotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil {
+			if apiErr.Error.Message != "" {
+				return nil, fmt.Errorf("Hetzner API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Error.Message)
+			}
+			if apiErr.Message != "" {
+				return nil, fmt.Errorf("Hetzner API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Message)
+			}
+		}
+		return nil, fmt.Errorf("Hetzner API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,114 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var hetznerAPIKeyEnv = os.Getenv("HETZNER_API_KEY")
+
+func restoreHetznerEnv() {
+	os.Setenv("HETZNER_API_KEY", hetznerAPIKeyEnv)
+}
+
+func TestNewDNSProviderHetznerMissingCredErr(t *testing.T) {
+	os.Setenv("HETZNER_API_KEY", "")
+	_, err := NewDNSProviderHetzner("")
+	assert.EqualError(t, err, "Hetzner credentials missing")
+	restoreHetznerEnv()
+}
+
+func TestNewDNSProviderHetznerValidEnv(t *testing.T) {
+	os.Setenv("HETZNER_API_KEY", "123")
+	_, err := NewDNSProviderHetzner("")
+	assert.NoError(t, err)
+	restoreHetznerEnv()
+}
+
+func TestHetznerPresentAndCleanUp(t *testing.T) {
+	var created hetznerRecord
+	var deleted []string
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Auth-API-Token") != "123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSONResponse(w, map[string]string{"message": "Invalid authentication credentials"})
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/zones":
+			if r.URL.Query().Get("name") != "example.com" {
+				w.WriteHeader(http.StatusNotFound)
+				writeJSONResponse(w, map[string]interface{}{"zones": nil, "error": map[string]interface{}{"message": "zone not found", "code": 404}})
+				return
+			}
+			writeJSONResponse(w, map[string]interface{}{"zones": []map[string]string{{"id": "zone1", "name": "example.com"}}})
+		case r.Method == "POST" && r.URL.Path == "/records":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			created.ID = "rec1"
+			writeJSONResponse(w, map[string]interface{}{"record": created})
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderHetzner("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, hetznerRecord{ID: "rec1", ZoneID: "zone1", Type: "TXT", Name: "_acme-challenge.www", Value: value, TTL: 120}, created)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"/records/rec1"}, deleted)
+
+	// The zone exists in DNS but is not managed by this account.
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		writeJSONResponse(w, map[string]interface{}{"error": map[string]interface{}{"message": "zone not found", "code": 404}})
+	}))
+	defer missing.Close()
+	provider.baseURL = missing.URL
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "Hetzner zone example.com not found")
+}
+
+func TestHetznerCleanUpUnknownRecordID(t *testing.T) {
+	_, value, _ := DNS01Record("example.com", "123d==")
+
+	var deleted []string
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/zones":
+			writeJSONResponse(w, map[string]interface{}{"zones": []map[string]string{{"id": "zone1", "name": "example.com"}}})
+		case r.Method == "GET" && r.URL.Path == "/records":
+			assert.Equal(t, "zone1", r.URL.Query().Get("zone_id"))
+			writeJSONResponse(w, map[string]interface{}{"records": []hetznerRecord{
+				{ID: "rec1", ZoneID: "zone1", Type: "TXT", Name: "_acme-challenge", Value: "other"},
+				{ID: "rec2", ZoneID: "zone1", Type: "TXT", Name: "_acme-challenge", Value: value},
+			}})
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderHetzner("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	assert.NoError(t, provider.CleanUp("example.com", "", "123d=="))
+	assert.Equal(t, []string{"/records/rec2"}, deleted)
+}
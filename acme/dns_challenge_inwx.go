@@ -0,0 +1,309 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const inwxAPIURL = "https://api.domrobot.com/jsonrpc/"
+
+// INWX result codes, see https://www.inwx.com/en/help/apidoc.
+const (
+	inwxCodeSuccess        = 1000
+	inwxCodeSuccessPending = 1001
+	inwxCodeAuthError      = 2200
+)
+
+// DNSProviderINWX is an implementation of the ChallengeProvider interface
+// that uses the JSON-RPC API of INWX to manage TXT records.
+//
+// INWX keeps the login in a session cookie. When the session expires, the
+// provider logs in again and retries the call.
+type DNSProviderINWX struct {
+	username     string
+	password     string
+	sharedSecret string
+	baseURL      string
+	client       *http.Client
+
+	mu        sync.Mutex
+	loggedIn  bool
+	recordIDs map[string]int
+}
+
+// NewDNSProviderINWX returns a DNSProviderINWX instance with a configured INWX client.
+// Authentication is either done using the passed credentials or - when empty - using the
+// environment variables INWX_USERNAME and INWX_PASSWORD. If two-factor authentication is
+// enabled for the account, INWX_SHARED_SECRET must hold the base32 encoded TOTP secret.
+func NewDNSProviderINWX(username, password string) (*DNSProviderINWX, error) {
+	if username == "" || password == "" {
+		username = os.Getenv("INWX_USERNAME")
+		password = os.Getenv("INWX_PASSWORD")
+		if username == "" || password == "" {
+			return nil, fmt.Errorf("INWX credentials missing")
+		}
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DNSProviderINWX{
+		username:     username,
+		password:     password,
+		sharedSecret: os.Getenv("INWX_SHARED_SECRET"),
+		baseURL:      inwxAPIURL,
+		client:       &http.Client{Jar: jar, Timeout: 30 * time.Second},
+		recordIDs:    make(map[string]int),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (i *DNSProviderINWX) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, name, err := i.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	var created struct {
+		ID int `json:"id"`
+	}
+	err = i.call("nameserver.createRecord", map[string]interface{}{
+		"domain":  zone,
+		"type":    "TXT",
+		"name":    name,
+		"content": value,
+		"ttl":     clampTTL(ttl, 300, "INWX"),
+	}, &created)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.recordIDs[fqdn+value] = created.ID
+	i.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (i *DNSProviderINWX) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+
+	i.mu.Lock()
+	id, ok := i.recordIDs[fqdn+value]
+	i.mu.Unlock()
+
+	err := deleteWithRelist(func() (string, error) {
+		zone, name, err := i.splitFqdn(fqdn)
+		if err != nil {
+			return "", err
+		}
+		id, err := i.findRecordID(zone, name, value)
+		return strconv.Itoa(id), err
+	}, func(id string) error {
+		return i.call("nameserver.deleteRecord", map[string]interface{}{"id": json.Number(id)}, nil)
+	}, strconv.Itoa(id), ok)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	delete(i.recordIDs, fqdn+value)
+	i.mu.Unlock()
+
+	return nil
+}
+
+// findRecordID returns the id of the TXT record name in zone with the given value.
+func (i *DNSProviderINWX) findRecordID(zone, name, value string) (int, error) {
+	var info struct {
+		Records []struct {
+			ID      int    `json:"id"`
+			Content string `json:"content"`
+		} `json:"record"`
+	}
+	err := i.call("nameserver.info", map[string]interface{}{"domain": zone, "name": name, "type": "TXT"}, &info)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rec := range info.Records {
+		if rec.Content == value {
+			return rec.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("INWX TXT record %s.%s not found", name, zone)
+}
+
+// splitFqdn returns the zone of fqdn and the record name relative to that
+// zone, which is empty for the zone apex.
+func (i *DNSProviderINWX) splitFqdn(fqdn string) (zone, name string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = ""
+	}
+
+	return unFqdn(zone), name, nil
+}
+
+// call runs the RPC method, logging in first if there is no session yet or
+// the session has expired.
+func (i *DNSProviderINWX) call(method string, params interface{}, result interface{}) error {
+	i.mu.Lock()
+	loggedIn := i.loggedIn
+	i.mu.Unlock()
+
+	if !loggedIn {
+		if err := i.login(); err != nil {
+			return err
+		}
+	}
+
+	err := i.doRequest(method, params, result)
+	if rpcErr, ok := err.(inwxError); ok && rpcErr.Code == inwxCodeAuthError {
+		if err := i.login(); err != nil {
+			return err
+		}
+		err = i.doRequest(method, params, result)
+	}
+	return err
+}
+
+// login starts a new session, unlocking it with a TOTP code if the account
+// uses two-factor authentication.
+func (i *DNSProviderINWX) login() error {
+	var account struct {
+		TFA string `json:"tfa"`
+	}
+	err := i.doRequest("account.login", map[string]interface{}{"user": i.username, "pass": i.password}, &account)
+	if err != nil {
+		return err
+	}
+
+	if account.TFA != "" && account.TFA != "0" {
+		if i.sharedSecret == "" {
+			return fmt.Errorf("INWX account requires two-factor authentication, but no shared secret is set")
+		}
+		tan, err := totp(i.sharedSecret, timeNow())
+		if err != nil {
+			return err
+		}
+		if err := i.doRequest("account.unlock", map[string]interface{}{"tan": tan}, nil); err != nil {
+			return err
+		}
+	}
+
+	i.mu.Lock()
+	i.loggedIn = true
+	i.mu.Unlock()
+
+	return nil
+}
+
+// inwxError is a failed RPC call.
+type inwxError struct {
+	Code   int
+	Msg    string
+	Reason string
+}
+
+func (e inwxError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("INWX API call failed with code %d: %s: %s", e.Code, e.Msg, e.Reason)
+	}
+	return fmt.Sprintf("INWX API call failed with code %d: %s", e.Code, e.Msg)
+}
+
+func (i *DNSProviderINWX) doRequest(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"method": method, "params": params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", i.baseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(i.client, req)
+	if err != nil {
+		return fmt.Errorf("INWX API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return fmt.Errorf("INWX API call failed: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("INWX API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var rpcResp struct {
+		Code    int             `json:"code"`
+		Msg     string          `json:"msg"`
+		Reason  string          `json:"reason"`
+		ResData json.RawMessage `json:"resData"`
+	}
+	if err := json.Unmarshal(msg, &rpcResp); err != nil {
+		return fmt.Errorf("INWX API response could not be decoded: %v", err)
+	}
+	if rpcResp.Code != inwxCodeSuccess && rpcResp.Code != inwxCodeSuccessPending {
+		return inwxError{Code: rpcResp.Code, Msg: rpcResp.Msg, Reason: rpcResp.Reason}
+	}
+
+	if result == nil || len(rpcResp.ResData) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(rpcResp.ResData, result); err != nil {
+		return fmt.Errorf("INWX API response could not be decoded: %v", err)
+	}
+	return nil
+}
+
+// totp returns the RFC 6238 time-based one-time password for the base32
+// encoded secret at time t, using the common parameters: HMAC-SHA1, a 30
+// second step and six digits.
+func totp(secret string, t time.Time) (string, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	if n := len(secret) % 8; n != 0 {
+		secret += strings.Repeat("=", 8-n)
+	}
+	key, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("Invalid TOTP shared secret: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
@@ -0,0 +1,209 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	inwxUsernameEnv     = os.Getenv("INWX_USERNAME")
+	inwxPasswordEnv     = os.Getenv("INWX_PASSWORD")
+	inwxSharedSecretEnv = os.Getenv("INWX_SHARED_SECRET")
+)
+
+func restoreINWXEnv() {
+	os.Setenv("INWX_USERNAME", inwxUsernameEnv)
+	os.Setenv("INWX_PASSWORD", inwxPasswordEnv)
+	os.Setenv("INWX_SHARED_SECRET", inwxSharedSecretEnv)
+}
+
+func TestNewDNSProviderINWXMissingCredErr(t *testing.T) {
+	os.Setenv("INWX_USERNAME", "")
+	os.Setenv("INWX_PASSWORD", "")
+	_, err := NewDNSProviderINWX("", "")
+	assert.EqualError(t, err, "INWX credentials missing")
+	restoreINWXEnv()
+}
+
+func TestNewDNSProviderINWXValidEnv(t *testing.T) {
+	os.Setenv("INWX_USERNAME", "user")
+	os.Setenv("INWX_PASSWORD", "secret")
+	_, err := NewDNSProviderINWX("", "")
+	assert.NoError(t, err)
+	restoreINWXEnv()
+}
+
+func TestTOTP(t *testing.T) {
+	// Test vectors of RFC 6238 for SHA1, truncated to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 2000000000: "279037"} {
+		got, err := totp(secret, time.Unix(unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, "TOTP at %d", unix)
+	}
+
+	_, err := totp("not base32!", time.Unix(59, 0))
+	assert.Error(t, err)
+}
+
+// fakeINWX implements the INWX JSON-RPC methods used by the provider. Every
+// login starts a new session; calls without the current session cookie fail
+// with an authentication error.
+type fakeINWX struct {
+	t       *testing.T
+	tfa     string
+	tan     string
+	session int
+	locked  bool
+	logins  int
+	records map[int]map[string]interface{}
+	nextID  int
+}
+
+func (f *fakeINWX) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+	assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&req))
+
+	reply := func(code int, msg string, resData interface{}) {
+		writeJSONResponse(w, map[string]interface{}{"code": code, "msg": msg, "resData": resData})
+	}
+
+	if req.Method == "account.login" {
+		if req.Params["user"] != "user" || req.Params["pass"] != "secret" {
+			reply(2200, "Authentication error", nil)
+			return
+		}
+		f.logins++
+		f.session++
+		f.locked = f.tfa != "0"
+		http.SetCookie(w, &http.Cookie{Name: "domrobot", Value: fmt.Sprintf("session-%d", f.session), Path: "/"})
+		reply(1000, "Command completed successfully", map[string]string{"tfa": f.tfa})
+		return
+	}
+
+	cookie, err := r.Cookie("domrobot")
+	if err != nil || cookie.Value != fmt.Sprintf("session-%d", f.session) {
+		reply(2200, "Authentication error", nil)
+		return
+	}
+
+	if req.Method == "account.unlock" {
+		if req.Params["tan"] != f.tan {
+			reply(2200, "Authentication error", nil)
+			return
+		}
+		f.locked = false
+		reply(1000, "Command completed successfully", nil)
+		return
+	}
+	if f.locked {
+		reply(2200, "Authentication error", nil)
+		return
+	}
+
+	switch req.Method {
+	case "nameserver.createRecord":
+		f.nextID++
+		f.records[f.nextID] = req.Params
+		reply(1000, "Command completed successfully", map[string]int{"id": f.nextID})
+	case "nameserver.deleteRecord":
+		id := int(req.Params["id"].(float64))
+		if _, ok := f.records[id]; !ok {
+			writeJSONResponse(w, map[string]interface{}{"code": 2303, "msg": "Object does not exist", "reason": "record not found"})
+			return
+		}
+		delete(f.records, id)
+		reply(1000, "Command completed successfully", nil)
+	case "nameserver.info":
+		var records []map[string]interface{}
+		for id, rec := range f.records {
+			if rec["domain"] == req.Params["domain"] && rec["name"] == req.Params["name"] {
+				records = append(records, map[string]interface{}{"id": id, "content": rec["content"]})
+			}
+		}
+		reply(1000, "Command completed successfully", map[string]interface{}{"record": records})
+	default:
+		reply(2000, "Command unrecognized", nil)
+	}
+}
+
+func startINWXTest(t *testing.T, fake *fakeINWX) (*DNSProviderINWX, func()) {
+	apiURL, done := startDNSProviderTest(t, fake)
+
+	provider, err := NewDNSProviderINWX("user", "secret")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	return provider, done
+}
+
+func TestINWXPresentAndCleanUp(t *testing.T) {
+	fake := &fakeINWX{t: t, tfa: "0", records: make(map[int]map[string]interface{})}
+	provider, stop := startINWXTest(t, fake)
+	defer stop()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, map[int]map[string]interface{}{1: {
+		"domain":  "example.com",
+		"type":    "TXT",
+		"name":    "_acme-challenge.www",
+		"content": value,
+		"ttl":     float64(300),
+	}}, fake.records)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Empty(t, fake.records)
+	assert.Equal(t, 1, fake.logins)
+
+	// A record created by another instance is looked up.
+	fake.records[7] = map[string]interface{}{"domain": "example.com", "name": "_acme-challenge.www", "content": value}
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Empty(t, fake.records)
+}
+
+func TestINWXSessionExpired(t *testing.T) {
+	fake := &fakeINWX{t: t, tfa: "0", records: make(map[int]map[string]interface{})}
+	provider, stop := startINWXTest(t, fake)
+	defer stop()
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+
+	// The server forgets the session; the provider logs in again.
+	fake.session++
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Empty(t, fake.records)
+	assert.Equal(t, 2, fake.logins)
+
+	provider.password = "wrong"
+	fake.session++
+	err := provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "INWX API call failed with code 2200: Authentication error")
+}
+
+func TestINWXTwoFactorLogin(t *testing.T) {
+	defer func() { timeNow = time.Now }()
+	now := time.Unix(1111111109, 0)
+	timeNow = func() time.Time { return now }
+
+	fake := &fakeINWX{t: t, tfa: "GOOGLE-AUTH", tan: "081804", records: make(map[int]map[string]interface{})}
+	provider, stop := startINWXTest(t, fake)
+	defer stop()
+
+	err := provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "INWX account requires two-factor authentication, but no shared secret is set")
+
+	provider.sharedSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Len(t, fake.records, 1)
+}
@@ -0,0 +1,229 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	linodeAPIURL = "https://api.linode.com/v4"
+	// linodeMinTTL is the lowest TTL Linode accepts, smaller values are rounded up.
+	linodeMinTTL = 300
+)
+
+// DNSProviderLinode is an implementation of the ChallengeProvider interface
+// that uses Linode's v4 API to manage TXT records.
+type DNSProviderLinode struct {
+	token   string
+	baseURL string
+
+	mu        sync.Mutex
+	recordIDs map[string]int
+}
+
+// NewDNSProviderLinode returns a DNSProviderLinode instance with a configured Linode client.
+// Authentication is either done using the passed personal access token or - when empty - using
+// the environment variable LINODE_TOKEN.
+func NewDNSProviderLinode(token string) (*DNSProviderLinode, error) {
+	if token == "" {
+		token = os.Getenv("LINODE_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("Linode credentials missing")
+		}
+	}
+
+	return &DNSProviderLinode{
+		token:     token,
+		baseURL:   linodeAPIURL,
+		recordIDs: make(map[string]int),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (l *DNSProviderLinode) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	domainID, name, err := l.lookupDomain(fqdn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(linodeRecord{Type: "TXT", Name: name, Target: value, TTLSec: clampTTL(ttl, linodeMinTTL, "Linode")})
+	if err != nil {
+		return err
+	}
+
+	resp, err := l.doRequest("POST", fmt.Sprintf("%s/domains/%d/records", l.baseURL, domainID), nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var rec linodeRecord
+	if err := json.Unmarshal(resp, &rec); err != nil {
+		return fmt.Errorf("Linode API response could not be decoded: %v", err)
+	}
+
+	l.mu.Lock()
+	l.recordIDs[fqdn+value] = rec.ID
+	l.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (l *DNSProviderLinode) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	domainID, name, err := l.lookupDomain(fqdn)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	recordID, ok := l.recordIDs[fqdn+value]
+	l.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		id, err := l.findRecordID(domainID, name, value)
+		return strconv.Itoa(id), err
+	}, func(id string) error {
+		return l.deleteRecord(domainID, id)
+	}, strconv.Itoa(recordID), ok)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	delete(l.recordIDs, fqdn+value)
+	l.mu.Unlock()
+
+	return nil
+}
+
+// lookupDomain returns the Linode ID of the zone of fqdn and the record name
+// relative to that zone.
+func (l *DNSProviderLinode) lookupDomain(fqdn string) (int, string, error) {
+	zone, err := findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return 0, "", err
+	}
+
+	name := strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = ""
+	}
+	zone = unFqdn(zone)
+
+	resp, err := l.doRequest("GET", l.baseURL+"/domains", map[string]string{"domain": zone}, nil)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var domains struct {
+		Data []struct {
+			ID     int    `json:"id"`
+			Domain string `json:"domain"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &domains); err != nil {
+		return 0, "", fmt.Errorf("Linode API response could not be decoded: %v", err)
+	}
+
+	for _, d := range domains.Data {
+		if strings.EqualFold(d.Domain, zone) {
+			return d.ID, name, nil
+		}
+	}
+
+	return 0, "", fmt.Errorf("Linode domain %s not found", zone)
+}
+
+func (l *DNSProviderLinode) deleteRecord(domainID int, recordID string) error {
+	_, err := l.doRequest("DELETE", fmt.Sprintf("%s/domains/%d/records/%s", l.baseURL, domainID, recordID), nil, nil)
+	return err
+}
+
+// findRecordID returns the id of the TXT record name with the given value.
+func (l *DNSProviderLinode) findRecordID(domainID int, name, value string) (int, error) {
+	resp, err := l.doRequest("GET", fmt.Sprintf("%s/domains/%d/records", l.baseURL, domainID), map[string]string{"type": "TXT", "name": name}, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var records struct {
+		Data []linodeRecord `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &records); err != nil {
+		return 0, fmt.Errorf("Linode API response could not be decoded: %v", err)
+	}
+
+	for _, rec := range records.Data {
+		if rec.Target == value {
+			return rec.ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Linode TXT record %s with value %s not found", name, value)
+}
+
+type linodeRecord struct {
+	ID     int    `json:"id,omitempty"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	TTLSec int    `json:"ttl_sec,omitempty"`
+}
+
+var errLinodeNotFound = fmt.Errorf("Linode API call failed with HTTP status %d", http.StatusNotFound)
+
+// doRequest sends a request to the Linode API. A non-nil filter is sent as
+// the JSON encoded X-Filter header Linode uses to filter list results.
+func (l *DNSProviderLinode) doRequest(method, uri string, filter map[string]string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+l.token)
+	req.Header.Set("Content-Type", "application/json")
+	if filter != nil {
+		f, err := json.Marshal(filter)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Filter", string(f))
+	}
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("Linode API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("Linode API call failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errLinodeNotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && len(apiErr.Errors) > 0 {
+			return nil, fmt.Errorf("Linode API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Errors[0].Reason)
+		}
+		return nil, fmt.Errorf("Linode API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,115 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var linodeTokenEnv = os.Getenv("LINODE_TOKEN")
+
+func restoreLinodeEnv() {
+	os.Setenv("LINODE_TOKEN", linodeTokenEnv)
+}
+
+func TestNewDNSProviderLinodeMissingCredErr(t *testing.T) {
+	os.Setenv("LINODE_TOKEN", "")
+	_, err := NewDNSProviderLinode("")
+	assert.EqualError(t, err, "Linode credentials missing")
+	restoreLinodeEnv()
+}
+
+func TestNewDNSProviderLinodeValidEnv(t *testing.T) {
+	os.Setenv("LINODE_TOKEN", "123")
+	_, err := NewDNSProviderLinode("")
+	assert.NoError(t, err)
+	restoreLinodeEnv()
+}
+
+func TestLinodePresentAndCleanUp(t *testing.T) {
+	var created linodeRecord
+	var deleted []string
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer 123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSONResponse(w, map[string]interface{}{"errors": []map[string]string{{"reason": "Invalid Token"}}})
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/domains":
+			var filter map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(r.Header.Get("X-Filter")), &filter))
+			assert.Equal(t, map[string]string{"domain": "example.com"}, filter)
+			writeJSONResponse(w, map[string]interface{}{
+				"data":  []map[string]interface{}{{"id": 1234, "domain": "example.com"}},
+				"page":  1,
+				"pages": 1,
+			})
+		case r.Method == "POST" && r.URL.Path == "/domains/1234/records":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			created.ID = 5678
+			writeJSONResponse(w, created)
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderLinode("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, linodeRecord{ID: 5678, Type: "TXT", Name: "_acme-challenge.www", Target: value, TTLSec: linodeMinTTL}, created)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"/domains/1234/records/5678"}, deleted)
+
+	provider.token = "bad"
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "Linode API call failed with HTTP status 401: Invalid Token")
+}
+
+func TestLinodeCleanUpStaleRecordID(t *testing.T) {
+	fqdn, value, _ := DNS01Record("www.example.com", "123d==")
+
+	var deleted []string
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/domains":
+			writeJSONResponse(w, map[string]interface{}{"data": []map[string]interface{}{{"id": 1234, "domain": "example.com"}}})
+		case r.Method == "GET" && r.URL.Path == "/domains/1234/records":
+			var filter map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(r.Header.Get("X-Filter")), &filter))
+			assert.Equal(t, map[string]string{"type": "TXT", "name": "_acme-challenge.www"}, filter)
+			writeJSONResponse(w, map[string]interface{}{"data": []linodeRecord{
+				{ID: 1111, Type: "TXT", Name: "_acme-challenge.www", Target: "other"},
+				{ID: 9999, Type: "TXT", Name: "_acme-challenge.www", Target: value},
+			}})
+		case r.Method == "DELETE" && r.URL.Path == "/domains/1234/records/5678":
+			w.WriteHeader(http.StatusNotFound)
+			writeJSONResponse(w, map[string]interface{}{"errors": []map[string]string{{"reason": "Not found"}}})
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderLinode("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+	provider.recordIDs[fqdn+value] = 5678
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"/domains/1234/records/9999"}, deleted)
+}
@@ -3,6 +3,7 @@ package acme
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -11,30 +12,49 @@ const (
 )
 
 // DNSProviderManual is an implementation of the ChallengeProvider interface
-type DNSProviderManual struct{}
+type DNSProviderManual struct {
+	in  io.Reader
+	out io.Writer
+}
 
-// NewDNSProviderManual returns a DNSProviderManual instance.
+// NewDNSProviderManual returns a DNSProviderManual instance which logs its
+// instructions and waits for confirmation on stdin.
 func NewDNSProviderManual() (*DNSProviderManual, error) {
-	return &DNSProviderManual{}, nil
+	return &DNSProviderManual{in: os.Stdin}, nil
+}
+
+// NewDNSProviderManualIO returns a DNSProviderManual instance which writes its
+// instructions to 'out' and waits for confirmation on 'in'.
+func NewDNSProviderManualIO(in io.Reader, out io.Writer) (*DNSProviderManual, error) {
+	return &DNSProviderManual{in: in, out: out}, nil
 }
 
 // Present prints instructions for manually creating the TXT record
-func (*DNSProviderManual) Present(domain, token, keyAuth string) error {
+func (m *DNSProviderManual) Present(domain, token, keyAuth string) error {
 	fqdn, value, ttl := DNS01Record(domain, keyAuth)
 	dnsRecord := fmt.Sprintf(dnsTemplate, fqdn, ttl, value)
-	logf("[INFO] acme: Please create the following TXT record in your DNS zone:")
-	logf("[INFO] acme: %s", dnsRecord)
-	logf("[INFO] acme: Press 'Enter' when you are done")
-	reader := bufio.NewReader(os.Stdin)
+	m.printf("[INFO] acme: Please create the following TXT record in your DNS zone:")
+	m.printf("[INFO] acme: %s", dnsRecord)
+	m.printf("[INFO] acme: Press 'Enter' when you are done")
+	reader := bufio.NewReader(m.in)
 	_, _ = reader.ReadString('\n')
 	return nil
 }
 
 // CleanUp prints instructions for manually removing the TXT record
-func (*DNSProviderManual) CleanUp(domain, token, keyAuth string) error {
+func (m *DNSProviderManual) CleanUp(domain, token, keyAuth string) error {
 	fqdn, _, ttl := DNS01Record(domain, keyAuth)
 	dnsRecord := fmt.Sprintf(dnsTemplate, fqdn, ttl, "...")
-	logf("[INFO] acme: You can now remove this TXT record from your DNS zone:")
-	logf("[INFO] acme: %s", dnsRecord)
+	m.printf("[INFO] acme: You can now remove this TXT record from your DNS zone:")
+	m.printf("[INFO] acme: %s", dnsRecord)
 	return nil
 }
+
+// printf writes a line to the configured writer or, if there is none, to the logger.
+func (m *DNSProviderManual) printf(format string, args ...interface{}) {
+	if m.out == nil {
+		logf(format, args...)
+		return
+	}
+	fmt.Fprintf(m.out, format+"\n", args...)
+}
@@ -0,0 +1,41 @@
+package acme
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSProviderManualPresentWaitsForInput(t *testing.T) {
+	in := bytes.NewBufferString("\n")
+	out := new(bytes.Buffer)
+	provider, err := NewDNSProviderManualIO(in, out)
+	assert.NoError(t, err)
+
+	fqdn, value, ttl := DNS01Record("example.com", "123d==")
+	done := make(chan error)
+	go func() { done <- provider.Present("example.com", "", "123d==") }()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Expected Present to return after reading the confirmation")
+	}
+
+	assert.Contains(t, out.String(), fmt.Sprintf(dnsTemplate, fqdn, ttl, value))
+	assert.Equal(t, 0, in.Len(), "Expected the confirmation to be consumed")
+}
+
+func TestDNSProviderManualCleanUp(t *testing.T) {
+	out := new(bytes.Buffer)
+	provider, err := NewDNSProviderManualIO(new(bytes.Buffer), out)
+	assert.NoError(t, err)
+
+	assert.NoError(t, provider.CleanUp("example.com", "", "123d=="))
+	assert.Contains(t, out.String(), "remove this TXT record")
+	assert.Contains(t, out.String(), "_acme-challenge.example.com.")
+}
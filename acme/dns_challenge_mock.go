@@ -0,0 +1,72 @@
+package acme
+
+import "sync"
+
+// MockDNSCall is a single call recorded by MockDNSProvider.
+type MockDNSCall struct {
+	// Op is either "present" or "cleanup".
+	Op      string
+	Domain  string
+	Token   string
+	KeyAuth string
+	// Fqdn and Value are the TXT record the call was made for.
+	Fqdn  string
+	Value string
+}
+
+// MockDNSProvider is an implementation of the ChallengeProvider interface
+// which does not talk to any DNS server. It records all calls made to it
+// and is meant to be used in tests of code building on this package.
+type MockDNSProvider struct {
+	mu    sync.Mutex
+	calls []MockDNSCall
+	errs  []error
+}
+
+// NewMockDNSProvider returns an empty MockDNSProvider instance.
+func NewMockDNSProvider() *MockDNSProvider {
+	return &MockDNSProvider{}
+}
+
+// QueueError makes the next call to Present or CleanUp, which has not been
+// assigned an error yet, return err. Queue a nil error to let a call succeed.
+func (m *MockDNSProvider) QueueError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errs = append(m.errs, err)
+}
+
+// Calls returns the calls recorded so far in the order they were made.
+func (m *MockDNSProvider) Calls() []MockDNSCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	calls := make([]MockDNSCall, len(m.calls))
+	copy(calls, m.calls)
+	return calls
+}
+
+// Present records the call and returns the next queued error, if any
+func (m *MockDNSProvider) Present(domain, token, keyAuth string) error {
+	return m.record("present", domain, token, keyAuth)
+}
+
+// CleanUp records the call and returns the next queued error, if any
+func (m *MockDNSProvider) CleanUp(domain, token, keyAuth string) error {
+	return m.record("cleanup", domain, token, keyAuth)
+}
+
+func (m *MockDNSProvider) record(op, domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, MockDNSCall{Op: op, Domain: domain, Token: token, KeyAuth: keyAuth, Fqdn: fqdn, Value: value})
+
+	if len(m.errs) == 0 {
+		return nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
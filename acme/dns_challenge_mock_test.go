@@ -0,0 +1,48 @@
+package acme
+
+import (
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockDNSProviderRecordsCalls(t *testing.T) {
+	provider := NewMockDNSProvider()
+
+	assert.NoError(t, provider.Present("example.com", "token", "123d=="))
+	assert.NoError(t, provider.CleanUp("example.com", "token", "123d=="))
+
+	fqdn, value, _ := DNS01Record("example.com", "123d==")
+	assert.Equal(t, []MockDNSCall{
+		{Op: "present", Domain: "example.com", Token: "token", KeyAuth: "123d==", Fqdn: fqdn, Value: value},
+		{Op: "cleanup", Domain: "example.com", Token: "token", KeyAuth: "123d==", Fqdn: fqdn, Value: value},
+	}, provider.Calls())
+}
+
+func TestMockDNSProviderQueuedErrors(t *testing.T) {
+	provider := NewMockDNSProvider()
+	provider.QueueError(nil)
+	provider.QueueError(errors.New("rate limited"))
+
+	assert.NoError(t, provider.Present("a.example.com", "", "123d=="))
+	assert.EqualError(t, provider.Present("b.example.com", "", "123d=="), "rate limited")
+	assert.NoError(t, provider.CleanUp("a.example.com", "", "123d=="))
+	assert.Len(t, provider.Calls(), 3)
+}
+
+func TestMockDNSProviderSolve(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) { return true, nil }
+
+	privKey, _ := generatePrivateKey(rsakey, 512)
+	provider := NewMockDNSProvider()
+	solver := &dnsChallenge{jws: &jws{privKey: privKey.(*rsa.PrivateKey)}, validate: stubValidate, provider: provider}
+
+	assert.NoError(t, solver.Solve(challenge{Type: DNS01, Token: "token"}, "example.com"))
+	if calls := provider.Calls(); assert.Len(t, calls, 2) {
+		assert.Equal(t, "present", calls[0].Op)
+		assert.Equal(t, "cleanup", calls[1].Op)
+	}
+}
@@ -0,0 +1,279 @@
+package acme
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	namecheapAPIURL = "https://api.namecheap.com/xml.response"
+	// namecheapClientIPURL returns the public IP of the caller as plain text.
+	namecheapClientIPURL = "https://dynamicdns.park-your-domain.com/getip"
+	// namecheapMinTTL is the lowest TTL Namecheap accepts for a host record.
+	namecheapMinTTL = 60
+)
+
+// DNSProviderNamecheap is an implementation of the ChallengeProvider interface
+// that uses Namecheap's XML API to manage TXT records.
+//
+// Namecheap's setHosts command replaces all host records of a domain, so every
+// change reads the current records, modifies them and writes the full set back.
+type DNSProviderNamecheap struct {
+	apiUser  string
+	apiKey   string
+	clientIP string
+	baseURL  string
+
+	// mu serializes the read-modify-write cycles on the host records.
+	mu sync.Mutex
+}
+
+// NewDNSProviderNamecheap returns a DNSProviderNamecheap instance with a configured Namecheap client.
+// Authentication is either done using the passed credentials or - when empty - using the environment
+// variables NAMECHEAP_API_USER and NAMECHEAP_API_KEY. Namecheap requires the public IP of the caller,
+// which is read from NAMECHEAP_CLIENT_IP or otherwise looked up.
+func NewDNSProviderNamecheap(apiUser, apiKey string) (*DNSProviderNamecheap, error) {
+	if apiUser == "" || apiKey == "" {
+		apiUser = os.Getenv("NAMECHEAP_API_USER")
+		apiKey = os.Getenv("NAMECHEAP_API_KEY")
+		if apiUser == "" || apiKey == "" {
+			return nil, fmt.Errorf("Namecheap credentials missing")
+		}
+	}
+
+	clientIP := os.Getenv("NAMECHEAP_CLIENT_IP")
+	if clientIP == "" {
+		var err error
+		clientIP, err = namecheapClientIP(namecheapClientIPURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &DNSProviderNamecheap{
+		apiUser:  apiUser,
+		apiKey:   apiKey,
+		clientIP: clientIP,
+		baseURL:  namecheapAPIURL,
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (n *DNSProviderNamecheap) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, name, err := n.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hosts, err := n.getHosts(zone)
+	if err != nil {
+		return err
+	}
+
+	hosts = append(hosts, namecheapHost{Name: name, Type: "TXT", Address: value, MXPref: "10", TTL: strconv.Itoa(clampTTL(ttl, namecheapMinTTL, "Namecheap"))})
+
+	return n.setHosts(zone, hosts)
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (n *DNSProviderNamecheap) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, name, err := n.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hosts, err := n.getHosts(zone)
+	if err != nil {
+		return err
+	}
+
+	var keep []namecheapHost
+	for _, h := range hosts {
+		if h.Type == "TXT" && h.Name == name && h.Address == value {
+			continue
+		}
+		keep = append(keep, h)
+	}
+
+	if len(keep) == len(hosts) {
+		return nil
+	}
+
+	return n.setHosts(zone, keep)
+}
+
+// CleanUpAll deletes all challenge TXT records in zone.
+func (n *DNSProviderNamecheap) CleanUpAll(zone string) error {
+	zone = unFqdn(zone)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hosts, err := n.getHosts(zone)
+	if err != nil {
+		return err
+	}
+
+	var keep []namecheapHost
+	for _, h := range hosts {
+		if h.Type == "TXT" && isChallengeRecordName(h.Name) {
+			logf("[INFO] acme: Deleting stale TXT record %s.%s", h.Name, zone)
+			continue
+		}
+		keep = append(keep, h)
+	}
+
+	if len(keep) == len(hosts) {
+		return nil
+	}
+
+	return n.setHosts(zone, keep)
+}
+
+// splitFqdn returns the zone of fqdn without trailing dot and the host name
+// relative to that zone.
+func (n *DNSProviderNamecheap) splitFqdn(fqdn string) (zone, name string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = "@"
+	}
+
+	return unFqdn(zone), name, nil
+}
+
+type namecheapHost struct {
+	Name    string `xml:",attr"`
+	Type    string `xml:",attr"`
+	Address string `xml:",attr"`
+	MXPref  string `xml:",attr"`
+	TTL     string `xml:",attr"`
+}
+
+type namecheapResponse struct {
+	XMLName xml.Name `xml:"ApiResponse"`
+	Status  string   `xml:"Status,attr"`
+	Errors  []struct {
+		Number      string `xml:"Number,attr"`
+		Description string `xml:",chardata"`
+	} `xml:"Errors>Error"`
+	Hosts    []namecheapHost `xml:"CommandResponse>DomainDNSGetHostsResult>host"`
+	SetHosts struct {
+		IsSuccess string `xml:",attr"`
+	} `xml:"CommandResponse>DomainDNSSetHostsResult"`
+}
+
+func (n *DNSProviderNamecheap) getHosts(zone string) ([]namecheapHost, error) {
+	resp, err := n.doRequest("namecheap.domains.dns.getHosts", zone, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Hosts, nil
+}
+
+func (n *DNSProviderNamecheap) setHosts(zone string, hosts []namecheapHost) error {
+	params := url.Values{}
+	for i, h := range hosts {
+		idx := strconv.Itoa(i + 1)
+		params.Set("HostName"+idx, h.Name)
+		params.Set("RecordType"+idx, h.Type)
+		params.Set("Address"+idx, h.Address)
+		params.Set("MXPref"+idx, h.MXPref)
+		params.Set("TTL"+idx, h.TTL)
+	}
+
+	resp, err := n.doRequest("namecheap.domains.dns.setHosts", zone, params)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(resp.SetHosts.IsSuccess, "true") {
+		return fmt.Errorf("Namecheap API call failed: setHosts for %s was not successful", zone)
+	}
+	return nil
+}
+
+// doRequest sends command for the domain zone to the Namecheap API. Namecheap
+// expects a domain split into its second level (SLD) and top level (TLD) part.
+func (n *DNSProviderNamecheap) doRequest(command, zone string, params url.Values) (*namecheapResponse, error) {
+	labels := strings.SplitN(zone, ".", 2)
+	if len(labels) != 2 {
+		return nil, fmt.Errorf("Namecheap API call failed: invalid domain %s", zone)
+	}
+
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("ApiUser", n.apiUser)
+	form.Set("ApiKey", n.apiKey)
+	form.Set("UserName", n.apiUser)
+	form.Set("ClientIp", n.clientIP)
+	form.Set("Command", command)
+	form.Set("SLD", labels[0])
+	form.Set("TLD", labels[1])
+
+	resp, err := httpPostWith(providerHTTPClient, n.baseURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("Namecheap API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("Namecheap API call failed: %v", err)
+	}
+
+	var r namecheapResponse
+	if err := xml.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("Namecheap API call failed with HTTP status %d: %v", resp.StatusCode, err)
+	}
+
+	if r.Status != "OK" {
+		if len(r.Errors) > 0 {
+			return nil, fmt.Errorf("Namecheap API call failed: [%s] %s", r.Errors[0].Number, strings.TrimSpace(r.Errors[0].Description))
+		}
+		return nil, fmt.Errorf("Namecheap API call failed with status %s", r.Status)
+	}
+
+	return &r, nil
+}
+
+// namecheapClientIP looks up the public IP of this host, which Namecheap
+// requires as a parameter of every API call.
+func namecheapClientIP(uri string) (string, error) {
+	resp, err := httpGetWith(providerHTTPClient, uri)
+	if err != nil {
+		return "", fmt.Errorf("Unable to determine client IP for Namecheap: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unable to determine client IP for Namecheap: HTTP status %d", resp.StatusCode)
+	}
+
+	ip, err := ioutil.ReadAll(limitReader(resp.Body, 256))
+	if err != nil {
+		return "", fmt.Errorf("Unable to determine client IP for Namecheap: %v", err)
+	}
+
+	return strings.TrimSpace(string(ip)), nil
+}
@@ -0,0 +1,227 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var namecheapEnv = []string{"NAMECHEAP_API_USER", "NAMECHEAP_API_KEY", "NAMECHEAP_CLIENT_IP"}
+
+var namecheapEnvValues = map[string]string{}
+
+func init() {
+	for _, key := range namecheapEnv {
+		namecheapEnvValues[key] = os.Getenv(key)
+	}
+}
+
+func restoreNamecheapEnv() {
+	for key, value := range namecheapEnvValues {
+		os.Setenv(key, value)
+	}
+}
+
+const namecheapGetHostsResponse = `<?xml version="1.0" encoding="utf-8"?>
+<ApiResponse Status="OK" xmlns="http://api.namecheap.com/xml.response">
+  <Errors />
+  <CommandResponse Type="namecheap.domains.dns.getHosts">
+    <DomainDNSGetHostsResult Domain="example.com" IsUsingOurDNS="true">
+      <host HostId="1" Name="@" Type="A" Address="10.0.0.1" MXPref="10" TTL="1800" />
+      %s
+    </DomainDNSGetHostsResult>
+  </CommandResponse>
+</ApiResponse>`
+
+const namecheapSetHostsResponse = `<?xml version="1.0" encoding="utf-8"?>
+<ApiResponse Status="OK" xmlns="http://api.namecheap.com/xml.response">
+  <Errors />
+  <CommandResponse Type="namecheap.domains.dns.setHosts">
+    <DomainDNSSetHostsResult Domain="example.com" IsSuccess="true" />
+  </CommandResponse>
+</ApiResponse>`
+
+const namecheapErrorResponse = `<?xml version="1.0" encoding="utf-8"?>
+<ApiResponse Status="ERROR" xmlns="http://api.namecheap.com/xml.response">
+  <Errors>
+    <Error Number="1011150">Invalid request IP: 10.0.0.2</Error>
+  </Errors>
+</ApiResponse>`
+
+func TestNewDNSProviderNamecheapMissingCredErr(t *testing.T) {
+	for _, key := range namecheapEnv {
+		os.Setenv(key, "")
+	}
+	_, err := NewDNSProviderNamecheap("", "")
+	assert.EqualError(t, err, "Namecheap credentials missing")
+	restoreNamecheapEnv()
+}
+
+func TestNewDNSProviderNamecheapValidEnv(t *testing.T) {
+	os.Setenv("NAMECHEAP_API_USER", "user")
+	os.Setenv("NAMECHEAP_API_KEY", "key")
+	os.Setenv("NAMECHEAP_CLIENT_IP", "10.0.0.2")
+	provider, err := NewDNSProviderNamecheap("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", provider.clientIP)
+	restoreNamecheapEnv()
+}
+
+func TestNamecheapClientIP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("10.0.0.2\n"))
+	}))
+	defer ts.Close()
+
+	ip, err := namecheapClientIP(ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", ip)
+}
+
+func TestNamecheapPresentAndCleanUp(t *testing.T) {
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+	txtHost := fmt.Sprintf(`<host HostId="2" Name="_acme-challenge.www" Type="TXT" Address="%s" MXPref="10" TTL="120" />`, value)
+
+	var current string
+	var setHosts []map[string][]string
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, "user", r.Form.Get("ApiUser"))
+		assert.Equal(t, "key", r.Form.Get("ApiKey"))
+		assert.Equal(t, "10.0.0.2", r.Form.Get("ClientIp"))
+		assert.Equal(t, "example", r.Form.Get("SLD"))
+		assert.Equal(t, "com", r.Form.Get("TLD"))
+
+		switch r.Form.Get("Command") {
+		case "namecheap.domains.dns.getHosts":
+			fmt.Fprintf(w, namecheapGetHostsResponse, current)
+		case "namecheap.domains.dns.setHosts":
+			setHosts = append(setHosts, r.Form)
+			current = txtHost
+			w.Write([]byte(namecheapSetHostsResponse))
+		default:
+			w.Write([]byte(namecheapErrorResponse))
+		}
+	}))
+	defer done()
+
+	provider := &DNSProviderNamecheap{apiUser: "user", apiKey: "key", clientIP: "10.0.0.2", baseURL: apiURL}
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	if assert.Len(t, setHosts, 1) {
+		form := setHosts[0]
+		assert.Equal(t, []string{"@"}, form["HostName1"])
+		assert.Equal(t, []string{"10.0.0.1"}, form["Address1"])
+		assert.Equal(t, []string{"_acme-challenge.www"}, form["HostName2"])
+		assert.Equal(t, []string{"TXT"}, form["RecordType2"])
+		assert.Equal(t, []string{value}, form["Address2"])
+		assert.Equal(t, []string{"120"}, form["TTL2"])
+	}
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	if assert.Len(t, setHosts, 2) {
+		form := setHosts[1]
+		assert.Equal(t, []string{"@"}, form["HostName1"])
+		assert.Nil(t, form["HostName2"], "Expected the TXT record to be removed")
+	}
+}
+
+func TestNamecheapConcurrentPresent(t *testing.T) {
+	var mu sync.Mutex
+	var hosts []string
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Command") {
+		case "namecheap.domains.dns.getHosts":
+			mu.Lock()
+			current := strings.Join(hosts, "\n")
+			mu.Unlock()
+			// Give concurrent changes a chance to read the same records.
+			time.Sleep(10 * time.Millisecond)
+			fmt.Fprintf(w, namecheapGetHostsResponse, current)
+		case "namecheap.domains.dns.setHosts":
+			var set []string
+			for i := 1; r.Form.Get("HostName"+strconv.Itoa(i)) != ""; i++ {
+				idx := strconv.Itoa(i)
+				if r.Form.Get("RecordType"+idx) == "TXT" {
+					set = append(set, fmt.Sprintf(`<host Name="%s" Type="TXT" Address="%s" MXPref="10" TTL="120" />`, r.Form.Get("HostName"+idx), r.Form.Get("Address"+idx)))
+				}
+			}
+			mu.Lock()
+			hosts = set
+			mu.Unlock()
+			w.Write([]byte(namecheapSetHostsResponse))
+		}
+	}))
+	defer done()
+
+	provider := &DNSProviderNamecheap{apiUser: "user", apiKey: "key", clientIP: "10.0.0.2", baseURL: apiURL}
+
+	domains := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"}
+	var wg sync.WaitGroup
+	for _, domain := range domains {
+		wg.Add(1)
+		go func(domain string) {
+			defer wg.Done()
+			assert.NoError(t, provider.Present(domain, "", "123d=="))
+		}(domain)
+	}
+	wg.Wait()
+
+	for _, domain := range domains {
+		_, value, _ := DNS01Record(domain, "123d==")
+		name := "_acme-challenge." + strings.TrimSuffix(domain, ".example.com")
+		assert.Contains(t, hosts, fmt.Sprintf(`<host Name="%s" Type="TXT" Address="%s" MXPref="10" TTL="120" />`, name, value))
+	}
+}
+
+func TestNamecheapErrorResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(namecheapErrorResponse))
+	}))
+	defer ts.Close()
+
+	provider := &DNSProviderNamecheap{apiUser: "user", apiKey: "key", clientIP: "10.0.0.2", baseURL: ts.URL}
+
+	_, err := provider.getHosts("example.com")
+	assert.EqualError(t, err, "Namecheap API call failed: [1011150] Invalid request IP: 10.0.0.2")
+}
+
+func TestNamecheapCleanUpAll(t *testing.T) {
+	hosts := `<host HostId="2" Name="_acme-challenge" Type="TXT" Address="a" MXPref="10" TTL="120" />
+      <host HostId="3" Name="_acme-challenge.www" Type="TXT" Address="b" MXPref="10" TTL="120" />
+      <host HostId="4" Name="_acme-challenge.a.b" Type="TXT" Address="c" MXPref="10" TTL="120" />
+      <host HostId="5" Name="@" Type="TXT" Address="v=spf1 -all" MXPref="10" TTL="1800" />`
+
+	var setHosts url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Command") {
+		case "namecheap.domains.dns.getHosts":
+			fmt.Fprintf(w, namecheapGetHostsResponse, hosts)
+		case "namecheap.domains.dns.setHosts":
+			setHosts = r.Form
+			w.Write([]byte(namecheapSetHostsResponse))
+		}
+	}))
+	defer ts.Close()
+
+	provider := &DNSProviderNamecheap{apiUser: "user", apiKey: "key", clientIP: "10.0.0.2", baseURL: ts.URL}
+
+	var _ ChallengeCleaner = provider
+	assert.NoError(t, provider.CleanUpAll("example.com"))
+	assert.Equal(t, []string{"@"}, setHosts["HostName1"])
+	assert.Equal(t, []string{"A"}, setHosts["RecordType1"])
+	assert.Equal(t, []string{"@"}, setHosts["HostName2"])
+	assert.Equal(t, []string{"v=spf1 -all"}, setHosts["Address2"])
+	assert.Nil(t, setHosts["HostName3"], "Expected all challenge records to be removed")
+}
@@ -0,0 +1,198 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const namecomAPIURL = "https://api.name.com/v4"
+
+// namecomMinTTL is the lowest TTL Name.com accepts for a record.
+const namecomMinTTL = 300
+
+// DNSProviderNameCom is an implementation of the ChallengeProvider interface
+// that uses Name.com's v4 API to manage TXT records.
+type DNSProviderNameCom struct {
+	username string
+	token    string
+	baseURL  string
+
+	mu        sync.Mutex
+	recordIDs map[string]int
+}
+
+// NewDNSProviderNameCom returns a DNSProviderNameCom instance with a configured Name.com client.
+// Authentication is either done using the passed username and API token or - when empty - using
+// the environment variables NAMECOM_USERNAME and NAMECOM_API_TOKEN.
+func NewDNSProviderNameCom(username, token string) (*DNSProviderNameCom, error) {
+	if username == "" || token == "" {
+		username = os.Getenv("NAMECOM_USERNAME")
+		token = os.Getenv("NAMECOM_API_TOKEN")
+		if username == "" || token == "" {
+			return nil, fmt.Errorf("Name.com credentials missing")
+		}
+	}
+
+	return &DNSProviderNameCom{
+		username:  username,
+		token:     token,
+		baseURL:   namecomAPIURL,
+		recordIDs: make(map[string]int),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (n *DNSProviderNameCom) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, host, err := n.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(namecomRecord{Host: host, Type: "TXT", Answer: value, TTL: clampTTL(ttl, namecomMinTTL, "Name.com")})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.doRequest("POST", fmt.Sprintf("%s/domains/%s/records", n.baseURL, zone), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var created namecomRecord
+	if err := json.Unmarshal(resp, &created); err != nil {
+		return fmt.Errorf("Name.com API response could not be decoded: %v", err)
+	}
+
+	n.mu.Lock()
+	n.recordIDs[fqdn+value] = created.ID
+	n.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (n *DNSProviderNameCom) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, host, err := n.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	id, ok := n.recordIDs[fqdn+value]
+	n.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		id, err := n.findRecordID(zone, host, value)
+		return strconv.Itoa(id), err
+	}, func(id string) error {
+		_, err := n.doRequest("DELETE", fmt.Sprintf("%s/domains/%s/records/%s", n.baseURL, zone, id), nil)
+		return err
+	}, strconv.Itoa(id), ok)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	delete(n.recordIDs, fqdn+value)
+	n.mu.Unlock()
+
+	return nil
+}
+
+// findRecordID pages through the records of zone and returns the id of the
+// TXT record host with the given value.
+func (n *DNSProviderNameCom) findRecordID(zone, host, value string) (int, error) {
+	for page := 1; page != 0; {
+		resp, err := n.doRequest("GET", fmt.Sprintf("%s/domains/%s/records?perPage=1000&page=%d", n.baseURL, zone, page), nil)
+		if err != nil {
+			return 0, err
+		}
+
+		var records struct {
+			Records  []namecomRecord `json:"records"`
+			NextPage int             `json:"nextPage"`
+		}
+		if err := json.Unmarshal(resp, &records); err != nil {
+			return 0, fmt.Errorf("Name.com API response could not be decoded: %v", err)
+		}
+
+		for _, rec := range records.Records {
+			if rec.Type == "TXT" && rec.Host == host && rec.Answer == value {
+				return rec.ID, nil
+			}
+		}
+		page = records.NextPage
+	}
+
+	return 0, fmt.Errorf("Name.com TXT record %s.%s not found", host, zone)
+}
+
+// splitFqdn returns the zone of fqdn and the host relative to that zone,
+// which is empty for the zone apex.
+func (n *DNSProviderNameCom) splitFqdn(fqdn string) (zone, host string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	host = strings.TrimSuffix(fqdn, "."+zone)
+	if host == fqdn {
+		host = ""
+	}
+
+	return unFqdn(zone), host, nil
+}
+
+type namecomRecord struct {
+	ID     int    `json:"id,omitempty"`
+	Host   string `json:"host"`
+	Type   string `json:"type"`
+	Answer string `json:"answer"`
+	TTL    int    `json:"ttl,omitempty"`
+}
+
+func (n *DNSProviderNameCom) doRequest(method, uri string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(n.username, n.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("Name.com API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("Name.com API call failed: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Message string `json:"message"`
+			Details string `json:"details"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Message != "" {
+			if apiErr.Details != "" {
+				apiErr.Message += ": " + apiErr.Details
+			}
+			return nil, fmt.Errorf("Name.com API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		return nil, fmt.Errorf("Name.com API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,168 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	namecomUsernameEnv = os.Getenv("NAMECOM_USERNAME")
+	namecomTokenEnv    = os.Getenv("NAMECOM_API_TOKEN")
+)
+
+func restoreNameComEnv() {
+	os.Setenv("NAMECOM_USERNAME", namecomUsernameEnv)
+	os.Setenv("NAMECOM_API_TOKEN", namecomTokenEnv)
+}
+
+func TestNewDNSProviderNameComMissingCredErr(t *testing.T) {
+	os.Setenv("NAMECOM_USERNAME", "")
+	os.Setenv("NAMECOM_API_TOKEN", "")
+	_, err := NewDNSProviderNameCom("", "")
+	assert.EqualError(t, err, "Name.com credentials missing")
+	restoreNameComEnv()
+}
+
+func TestNewDNSProviderNameComValidEnv(t *testing.T) {
+	os.Setenv("NAMECOM_USERNAME", "user")
+	os.Setenv("NAMECOM_API_TOKEN", "123")
+	_, err := NewDNSProviderNameCom("", "")
+	assert.NoError(t, err)
+	restoreNameComEnv()
+}
+
+// fakeNameCom serves the records of example.com two per page.
+type fakeNameCom struct {
+	t       *testing.T
+	records []namecomRecord
+	deleted []int
+}
+
+func (f *fakeNameCom) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "123" {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSONResponse(w, map[string]string{"message": "Unauthenticated"})
+		return
+	}
+
+	const records = "/domains/example.com/records"
+	switch {
+	case r.Method == "POST" && r.URL.Path == records:
+		var rec namecomRecord
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&rec))
+		if rec.TTL < namecomMinTTL {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSONResponse(w, map[string]string{"message": "Invalid Argument", "details": "Parameter Value Error - Invalid TTL"})
+			return
+		}
+		rec.ID = 100 + len(f.records)
+		f.records = append(f.records, rec)
+		writeJSONResponse(w, rec)
+	case r.Method == "GET" && r.URL.Path == records:
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start, end, next := (page-1)*2, page*2, page+1
+		if end >= len(f.records) {
+			end, next = len(f.records), 0
+		}
+		resp := map[string]interface{}{"records": f.records[start:end]}
+		if next != 0 {
+			resp["nextPage"] = next
+		}
+		writeJSONResponse(w, resp)
+	case r.Method == "DELETE":
+		for i, rec := range f.records {
+			if r.URL.Path == fmt.Sprintf("%s/%d", records, rec.ID) {
+				f.records = append(f.records[:i], f.records[i+1:]...)
+				f.deleted = append(f.deleted, rec.ID)
+				writeJSONResponse(w, map[string]string{})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		writeJSONResponse(w, map[string]string{"message": "Not Found"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSONResponse(w, map[string]string{"message": "Not Found"})
+	}
+}
+
+func startNameComTest(t *testing.T) (*DNSProviderNameCom, *fakeNameCom, func()) {
+	fake := &fakeNameCom{t: t}
+	apiURL, done := startDNSProviderTest(t, fake)
+
+	provider, err := NewDNSProviderNameCom("user", "123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	return provider, fake, done
+}
+
+func TestNameComPresentAndCleanUp(t *testing.T) {
+	provider, fake, done := startNameComTest(t)
+	defer done()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, []namecomRecord{{ID: 100, Host: "_acme-challenge.www", Type: "TXT", Answer: value, TTL: namecomMinTTL}}, fake.records)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []int{100}, fake.deleted)
+}
+
+func TestNameComCleanUpLooksUpRecordAcrossPages(t *testing.T) {
+	provider, fake, done := startNameComTest(t)
+	defer done()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+	fake.records = []namecomRecord{
+		{ID: 1, Host: "", Type: "A", Answer: "10.0.0.1"},
+		{ID: 2, Host: "", Type: "TXT", Answer: "v=spf1 -all"},
+		{ID: 3, Host: "_acme-challenge.www", Type: "TXT", Answer: "other"},
+		{ID: 4, Host: "_acme-challenge.www", Type: "TXT", Answer: value},
+	}
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []int{4}, fake.deleted)
+
+	err := provider.CleanUp("other.example.com", "", "123d==")
+	assert.EqualError(t, err, "Name.com TXT record _acme-challenge.other.example.com not found")
+}
+
+func TestNameComAPIError(t *testing.T) {
+	provider, _, done := startNameComTest(t)
+	defer done()
+
+	provider.token = "wrong"
+	err := provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "Name.com API call failed with HTTP status 401: Unauthenticated")
+
+	provider.token = "123"
+	provider.recordIDs = map[string]int{}
+	err = provider.CleanUp("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "Name.com TXT record _acme-challenge.www.example.com not found")
+
+	_, err = provider.doRequest("DELETE", provider.baseURL+"/domains/example.com/records/404", nil)
+	assert.EqualError(t, err, "Name.com API call failed with HTTP status 404: Not Found")
+}
+
+func TestNameComErrorDetails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSONResponse(w, map[string]string{"message": "Invalid Argument", "details": "Parameter Value Error - Invalid TTL"})
+	}))
+	defer ts.Close()
+
+	provider, err := NewDNSProviderNameCom("user", "123")
+	assert.NoError(t, err)
+
+	_, err = provider.doRequest("POST", ts.URL, nil)
+	assert.EqualError(t, err, "Name.com API call failed with HTTP status 400: Invalid Argument: Parameter Value Error - Invalid TTL")
+}
@@ -0,0 +1,199 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const ns1APIURL = "https://api.nsone.net/v1"
+
+// DNSProviderNS1 is an implementation of the ChallengeProvider interface
+// that uses NS1's API to manage TXT records.
+//
+// NS1 keeps all answers of a name and type in one record, so the values of
+// a domain and its wildcard are added to and removed from the same record.
+type DNSProviderNS1 struct {
+	apiKey  string
+	baseURL string
+
+	// mu serializes the read-modify-write cycles on records.
+	mu sync.Mutex
+}
+
+// NewDNSProviderNS1 returns a DNSProviderNS1 instance with a configured NS1 client.
+// Authentication is either done using the passed API key or - when empty - using the environment
+// variable NS1_API_KEY.
+func NewDNSProviderNS1(apiKey string) (*DNSProviderNS1, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("NS1_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("NS1 credentials missing")
+		}
+	}
+
+	return &DNSProviderNS1{
+		apiKey:  apiKey,
+		baseURL: ns1APIURL,
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge, or adds the
+// value to the TXT record of the name if there already is one.
+func (n *DNSProviderNS1) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	uri, err := n.recordURL(fqdn)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	rec, err := n.getRecord(uri)
+	if err == errNS1NotFound {
+		_, err = n.doRequest("PUT", uri, ns1Record{Answers: []ns1Answer{{Answer: []string{value}}}, TTL: ttl})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, a := range rec.Answers {
+		if a.value() == value {
+			return nil
+		}
+	}
+
+	rec.Answers = append(rec.Answers, ns1Answer{Answer: []string{value}})
+	_, err = n.doRequest("POST", uri, ns1Record{Answers: rec.Answers, TTL: rec.TTL})
+	return err
+}
+
+// CleanUp removes the value from the TXT record of the name, deleting the
+// record once no other answers are left.
+func (n *DNSProviderNS1) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	uri, err := n.recordURL(fqdn)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	rec, err := n.getRecord(uri)
+	if err == errNS1NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var keep []ns1Answer
+	for _, a := range rec.Answers {
+		if a.value() != value {
+			keep = append(keep, a)
+		}
+	}
+
+	switch {
+	case len(keep) == len(rec.Answers):
+		return nil
+	case len(keep) == 0:
+		_, err = n.doRequest("DELETE", uri, nil)
+	default:
+		_, err = n.doRequest("POST", uri, ns1Record{Answers: keep, TTL: rec.TTL})
+	}
+	return err
+}
+
+// recordURL returns the URL of the TXT record fqdn.
+func (n *DNSProviderNS1) recordURL(fqdn string) (string, error) {
+	zone, err := findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/zones/%s/%s/TXT", n.baseURL, unFqdn(zone), unFqdn(fqdn)), nil
+}
+
+func (n *DNSProviderNS1) getRecord(uri string) (*ns1Record, error) {
+	resp, err := n.doRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var rec ns1Record
+	if err := json.Unmarshal(resp, &rec); err != nil {
+		return nil, fmt.Errorf("NS1 API response could not be decoded: %v", err)
+	}
+	return &rec, nil
+}
+
+type ns1Record struct {
+	Answers []ns1Answer `json:"answers"`
+	TTL     int         `json:"ttl,omitempty"`
+}
+
+// ns1Answer is one answer of a record. Its rdata is a list of fields; a TXT
+// answer has one field holding the text.
+type ns1Answer struct {
+	Answer []string `json:"answer"`
+}
+
+func (a ns1Answer) value() string {
+	return strings.Join(a.Answer, "")
+}
+
+var errNS1NotFound = fmt.Errorf("NS1 API call failed with HTTP status %d", http.StatusNotFound)
+
+func (n *DNSProviderNS1) doRequest(method, uri string, payload interface{}) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-NSONE-Key", n.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("NS1 API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("NS1 API call failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNS1NotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("NS1 API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		return nil, fmt.Errorf("NS1 API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,143 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ns1APIKeyEnv = os.Getenv("NS1_API_KEY")
+
+func restoreNS1Env() {
+	os.Setenv("NS1_API_KEY", ns1APIKeyEnv)
+}
+
+func TestNewDNSProviderNS1MissingCredErr(t *testing.T) {
+	os.Setenv("NS1_API_KEY", "")
+	_, err := NewDNSProviderNS1("")
+	assert.EqualError(t, err, "NS1 credentials missing")
+	restoreNS1Env()
+}
+
+func TestNewDNSProviderNS1ValidEnv(t *testing.T) {
+	os.Setenv("NS1_API_KEY", "123")
+	_, err := NewDNSProviderNS1("")
+	assert.NoError(t, err)
+	restoreNS1Env()
+}
+
+// fakeNS1 holds the TXT records of the zone example.com by URL path.
+type fakeNS1 struct {
+	t       *testing.T
+	records map[string]ns1Record
+	methods []string
+}
+
+func (f *fakeNS1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-NSONE-Key") != "123" {
+		http.Error(w, `{"message": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	f.methods = append(f.methods, r.Method)
+
+	rec, ok := f.records[r.URL.Path]
+	switch r.Method {
+	case "GET":
+		if !ok {
+			http.Error(w, `{"message": "record not found"}`, http.StatusNotFound)
+			return
+		}
+		writeJSONResponse(w, rec)
+	case "PUT":
+		if ok {
+			http.Error(w, `{"message": "record already exists"}`, http.StatusBadRequest)
+			return
+		}
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&rec))
+		f.records[r.URL.Path] = rec
+		writeJSONResponse(w, rec)
+	case "POST":
+		if !ok {
+			http.Error(w, `{"message": "record not found"}`, http.StatusNotFound)
+			return
+		}
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&rec))
+		f.records[r.URL.Path] = rec
+		writeJSONResponse(w, rec)
+	case "DELETE":
+		if !ok {
+			http.Error(w, `{"message": "record not found"}`, http.StatusNotFound)
+			return
+		}
+		delete(f.records, r.URL.Path)
+		writeJSONResponse(w, map[string]string{})
+	}
+}
+
+func startNS1Test(t *testing.T) (*DNSProviderNS1, *fakeNS1, func()) {
+	fake := &fakeNS1{t: t, records: make(map[string]ns1Record)}
+	apiURL, done := startDNSProviderTest(t, fake)
+
+	provider, err := NewDNSProviderNS1("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	return provider, fake, done
+}
+
+func TestNS1PresentAndCleanUp(t *testing.T) {
+	provider, fake, done := startNS1Test(t)
+	defer done()
+
+	const path = "/zones/example.com/_acme-challenge.www.example.com/TXT"
+	_, value, ttl := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, ns1Record{Answers: []ns1Answer{{Answer: []string{value}}}, TTL: ttl}, fake.records[path])
+	assert.Equal(t, []string{"GET", "PUT"}, fake.methods)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Empty(t, fake.records)
+}
+
+func TestNS1AnswersSerialization(t *testing.T) {
+	body, err := json.Marshal(ns1Record{Answers: []ns1Answer{{Answer: []string{"abc"}}}, TTL: 120})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"answers":[{"answer":["abc"]}],"ttl":120}`, string(body))
+}
+
+func TestNS1PresentAppendsToExistingRecord(t *testing.T) {
+	provider, fake, done := startNS1Test(t)
+	defer done()
+
+	const path = "/zones/example.com/_acme-challenge.example.com/TXT"
+	_, first, _ := DNS01Record("example.com", "123d==")
+	_, second, _ := DNS01Record("*.example.com", "456e==")
+
+	assert.NoError(t, provider.Present("example.com", "", "123d=="))
+	assert.NoError(t, provider.Present("*.example.com", "", "456e=="))
+	assert.Equal(t, []ns1Answer{{Answer: []string{first}}, {Answer: []string{second}}}, fake.records[path].Answers)
+	assert.Equal(t, []string{"GET", "PUT", "GET", "POST"}, fake.methods)
+
+	// Presenting a value twice does not duplicate the answer.
+	assert.NoError(t, provider.Present("*.example.com", "", "456e=="))
+	assert.Len(t, fake.records[path].Answers, 2)
+
+	assert.NoError(t, provider.CleanUp("example.com", "", "123d=="))
+	assert.Equal(t, []ns1Answer{{Answer: []string{second}}}, fake.records[path].Answers)
+
+	assert.NoError(t, provider.CleanUp("*.example.com", "", "456e=="))
+	assert.Empty(t, fake.records)
+}
+
+func TestNS1APIError(t *testing.T) {
+	provider, _, done := startNS1Test(t)
+	defer done()
+
+	provider.apiKey = "wrong"
+	err := provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "NS1 API call failed with HTTP status 401: Unauthorized")
+}
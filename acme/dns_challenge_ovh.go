@@ -0,0 +1,267 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ovhEndpoints maps the names of the OVH API endpoints to their URLs.
+var ovhEndpoints = map[string]string{
+	"ovh-eu": "https://eu.api.ovh.com/1.0",
+	"ovh-ca": "https://ca.api.ovh.com/1.0",
+	"ovh-us": "https://api.us.ovhcloud.com/1.0",
+}
+
+// DNSProviderOVH is an implementation of the ChallengeProvider interface
+// that uses OVH's API to manage TXT records.
+type DNSProviderOVH struct {
+	endpoint          string
+	applicationKey    string
+	applicationSecret string
+	consumerKey       string
+
+	mu        sync.Mutex
+	timeDelta time.Duration
+	timeSet   bool
+	recordIDs map[string]int
+}
+
+// NewDNSProviderOVH returns a DNSProviderOVH instance with a configured OVH client.
+// The endpoint is either one of ovh-eu, ovh-ca and ovh-us or the URL of the API.
+// Authentication is either done using the passed credentials or - when empty - using
+// the environment variables OVH_ENDPOINT, OVH_APPLICATION_KEY, OVH_APPLICATION_SECRET
+// and OVH_CONSUMER_KEY.
+func NewDNSProviderOVH(endpoint, applicationKey, applicationSecret, consumerKey string) (*DNSProviderOVH, error) {
+	if endpoint == "" || applicationKey == "" || applicationSecret == "" || consumerKey == "" {
+		endpoint = os.Getenv("OVH_ENDPOINT")
+		applicationKey = os.Getenv("OVH_APPLICATION_KEY")
+		applicationSecret = os.Getenv("OVH_APPLICATION_SECRET")
+		consumerKey = os.Getenv("OVH_CONSUMER_KEY")
+		if endpoint == "" || applicationKey == "" || applicationSecret == "" || consumerKey == "" {
+			return nil, fmt.Errorf("OVH credentials missing")
+		}
+	}
+
+	if u, ok := ovhEndpoints[endpoint]; ok {
+		endpoint = u
+	} else if !strings.HasPrefix(endpoint, "https://") && !strings.HasPrefix(endpoint, "http://") {
+		return nil, fmt.Errorf("Unknown OVH endpoint %q", endpoint)
+	}
+
+	return &DNSProviderOVH{
+		endpoint:          strings.TrimSuffix(endpoint, "/"),
+		applicationKey:    applicationKey,
+		applicationSecret: applicationSecret,
+		consumerKey:       consumerKey,
+		recordIDs:         make(map[string]int),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (o *DNSProviderOVH) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, name, err := o.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	var rec ovhRecord
+	err = o.doRequest("POST", fmt.Sprintf("/domain/zone/%s/record", zone), ovhRecord{FieldType: "TXT", SubDomain: name, Target: value, TTL: ttl}, &rec)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	o.recordIDs[fqdn+value] = rec.ID
+	o.mu.Unlock()
+
+	return o.refreshZone(zone)
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (o *DNSProviderOVH) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, name, err := o.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	id, ok := o.recordIDs[fqdn+value]
+	o.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		id, err := o.findRecordID(zone, name, value)
+		return strconv.Itoa(id), err
+	}, func(id string) error {
+		return o.doRequest("DELETE", fmt.Sprintf("/domain/zone/%s/record/%s", zone, id), nil, nil)
+	}, strconv.Itoa(id), ok)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	delete(o.recordIDs, fqdn+value)
+	o.mu.Unlock()
+
+	return o.refreshZone(zone)
+}
+
+// refreshZone applies the changed records of zone to its nameservers.
+func (o *DNSProviderOVH) refreshZone(zone string) error {
+	return o.doRequest("POST", fmt.Sprintf("/domain/zone/%s/refresh", zone), nil, nil)
+}
+
+// findRecordID returns the id of the TXT record name with the given value.
+func (o *DNSProviderOVH) findRecordID(zone, name, value string) (int, error) {
+	query := url.Values{"fieldType": {"TXT"}, "subDomain": {name}}
+	var ids []int
+	if err := o.doRequest("GET", fmt.Sprintf("/domain/zone/%s/record?%s", zone, query.Encode()), nil, &ids); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		var rec ovhRecord
+		if err := o.doRequest("GET", fmt.Sprintf("/domain/zone/%s/record/%d", zone, id), nil, &rec); err != nil {
+			return 0, err
+		}
+		if strings.Trim(rec.Target, `"`) == value {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("OVH TXT record %s with value %s not found", name, value)
+}
+
+// splitFqdn returns the zone of fqdn and the record name relative to that
+// zone, which is empty for the zone apex.
+func (o *DNSProviderOVH) splitFqdn(fqdn string) (zone, name string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = ""
+	}
+
+	return unFqdn(zone), name, nil
+}
+
+type ovhRecord struct {
+	ID        int    `json:"id,omitempty"`
+	FieldType string `json:"fieldType"`
+	SubDomain string `json:"subDomain"`
+	Target    string `json:"target"`
+	TTL       int    `json:"ttl,omitempty"`
+}
+
+// ovhSignature signs a request as described in OVH's API documentation:
+// "$1$" followed by the hex encoded SHA1 of the application secret, the
+// consumer key, the method, the full URL, the body and the timestamp,
+// joined by "+".
+func ovhSignature(applicationSecret, consumerKey, method, uri, body string, timestamp int64) string {
+	h := sha1.New()
+	h.Write([]byte(strings.Join([]string{applicationSecret, consumerKey, method, uri, body, strconv.FormatInt(timestamp, 10)}, "+")))
+	return fmt.Sprintf("$1$%x", h.Sum(nil))
+}
+
+// serverTime returns the current time of the OVH API. Signatures must use
+// the server's clock, so its offset from the local clock is fetched once.
+func (o *DNSProviderOVH) serverTime() (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.timeSet {
+		resp, err := httpGetWith(providerHTTPClient, o.endpoint+"/auth/time")
+		if err != nil {
+			return 0, fmt.Errorf("OVH API call failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(limitReader(resp.Body, 64))
+		if err != nil {
+			return 0, fmt.Errorf("OVH API call failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("OVH API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		serverTime, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("OVH API returned an invalid time: %v", err)
+		}
+
+		o.timeDelta = time.Unix(serverTime, 0).Sub(time.Now())
+		o.timeSet = true
+	}
+
+	return time.Now().Add(o.timeDelta).Unix(), nil
+}
+
+func (o *DNSProviderOVH) doRequest(method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	timestamp, err := o.serverTime()
+	if err != nil {
+		return err
+	}
+
+	uri := o.endpoint + path
+	req, err := http.NewRequest(method, uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ovh-Application", o.applicationKey)
+	req.Header.Set("X-Ovh-Consumer", o.consumerKey)
+	req.Header.Set("X-Ovh-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Ovh-Signature", ovhSignature(o.applicationSecret, o.consumerKey, method, uri, string(body), timestamp))
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("OVH API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return fmt.Errorf("OVH API call failed: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("OVH API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		return fmt.Errorf("OVH API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil && len(msg) > 0 {
+		if err := json.Unmarshal(msg, out); err != nil {
+			return fmt.Errorf("OVH API response could not be decoded: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ovhEnv = []string{"OVH_ENDPOINT", "OVH_APPLICATION_KEY", "OVH_APPLICATION_SECRET", "OVH_CONSUMER_KEY"}
+
+var ovhEnvValues = map[string]string{}
+
+func init() {
+	for _, key := range ovhEnv {
+		ovhEnvValues[key] = os.Getenv(key)
+	}
+}
+
+func restoreOVHEnv() {
+	for key, value := range ovhEnvValues {
+		os.Setenv(key, value)
+	}
+}
+
+func TestNewDNSProviderOVHMissingCredErr(t *testing.T) {
+	for _, key := range ovhEnv {
+		os.Setenv(key, "")
+	}
+	_, err := NewDNSProviderOVH("", "", "", "")
+	assert.EqualError(t, err, "OVH credentials missing")
+	restoreOVHEnv()
+}
+
+func TestNewDNSProviderOVHValidEnv(t *testing.T) {
+	for _, key := range ovhEnv {
+		os.Setenv(key, "123")
+	}
+	os.Setenv("OVH_ENDPOINT", "ovh-eu")
+	provider, err := NewDNSProviderOVH("", "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://eu.api.ovh.com/1.0", provider.endpoint)
+	restoreOVHEnv()
+}
+
+func TestNewDNSProviderOVHUnknownEndpoint(t *testing.T) {
+	_, err := NewDNSProviderOVH("ovh-mars", "key", "secret", "consumer")
+	assert.EqualError(t, err, `Unknown OVH endpoint "ovh-mars"`)
+}
+
+func TestOVHSignature(t *testing.T) {
+	const secret, consumer = "EgWIz07P0HYwtQDs", "MtSwSrPpNjqfVSmJhLbPyr2i45lSwPU1"
+
+	sig := ovhSignature(secret, consumer, "POST", "https://eu.api.ovh.com/1.0/domain/zone/example.com/record", `{"fieldType":"TXT"}`, 1457018875)
+	assert.Equal(t, "$1$85f39b00b4e52fe52ca7983a64ae05a75184ad4c", sig)
+
+	sig = ovhSignature(secret, consumer, "GET", "https://eu.api.ovh.com/1.0/domain/zone/example.com/record?fieldType=TXT", "", 1457018875)
+	assert.Equal(t, "$1$d5844d5589620ebfe7e366a745cc917606936029", sig)
+}
+
+func TestOVHPresentAndCleanUp(t *testing.T) {
+	// The API clock is an hour ahead of ours.
+	serverNow := time.Now().Add(time.Hour).Unix()
+
+	var apiURL string
+	var requests []string
+	var created ovhRecord
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/time" {
+			fmt.Fprint(w, serverNow)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Ovh-Timestamp"), 10, 64)
+		assert.InDelta(t, serverNow, timestamp, 5, "Expected the request to use the server's clock")
+		assert.Equal(t, "key", r.Header.Get("X-Ovh-Application"))
+		assert.Equal(t, "consumer", r.Header.Get("X-Ovh-Consumer"))
+		assert.Equal(t, ovhSignature("secret", "consumer", r.Method, apiURL+r.URL.RequestURI(), string(body), timestamp), r.Header.Get("X-Ovh-Signature"))
+
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/domain/zone/example.com/record":
+			assert.NoError(t, json.Unmarshal(body, &created))
+			created.ID = 77
+			writeJSONResponse(w, created)
+		case r.Method == "POST" && r.URL.Path == "/domain/zone/example.com/refresh":
+		case r.Method == "DELETE" && r.URL.Path == "/domain/zone/example.com/record/77":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			writeJSONResponse(w, map[string]string{"message": "The requested object does not exist"})
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderOVH(apiURL, "key", "secret", "consumer")
+	assert.NoError(t, err)
+
+	_, value, ttl := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, ovhRecord{ID: 77, FieldType: "TXT", SubDomain: "_acme-challenge.www", Target: value, TTL: ttl}, created)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{
+		"POST /domain/zone/example.com/record",
+		"POST /domain/zone/example.com/refresh",
+		"DELETE /domain/zone/example.com/record/77",
+		"POST /domain/zone/example.com/refresh",
+	}, requests)
+
+	err = provider.CleanUp("other.example.com", "", "123d==")
+	assert.EqualError(t, err, "OVH API call failed with HTTP status 404: The requested object does not exist")
+}
@@ -0,0 +1,195 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const porkbunAPIURL = "https://api.porkbun.com/api/json/v3"
+
+// porkbunMinTTL is the lowest TTL Porkbun accepts for a record.
+const porkbunMinTTL = 600
+
+// DNSProviderPorkbun is an implementation of the ChallengeProvider interface
+// that uses Porkbun's v3 API to manage TXT records.
+type DNSProviderPorkbun struct {
+	apiKey    string
+	secretKey string
+	baseURL   string
+
+	mu        sync.Mutex
+	recordIDs map[string]string
+}
+
+// NewDNSProviderPorkbun returns a DNSProviderPorkbun instance with a configured Porkbun client.
+// Authentication is either done using the passed API and secret API key or - when empty - using
+// the environment variables PORKBUN_API_KEY and PORKBUN_SECRET_API_KEY.
+func NewDNSProviderPorkbun(apiKey, secretKey string) (*DNSProviderPorkbun, error) {
+	if apiKey == "" || secretKey == "" {
+		apiKey = os.Getenv("PORKBUN_API_KEY")
+		secretKey = os.Getenv("PORKBUN_SECRET_API_KEY")
+		if apiKey == "" || secretKey == "" {
+			return nil, fmt.Errorf("Porkbun credentials missing")
+		}
+	}
+
+	return &DNSProviderPorkbun{
+		apiKey:    apiKey,
+		secretKey: secretKey,
+		baseURL:   porkbunAPIURL,
+		recordIDs: make(map[string]string),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (p *DNSProviderPorkbun) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, name, err := p.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	var created struct {
+		ID json.Number `json:"id"`
+	}
+	err = p.doRequest("/dns/create/"+zone, map[string]string{
+		"name":    name,
+		"type":    "TXT",
+		"content": value,
+		"ttl":     fmt.Sprintf("%d", clampTTL(ttl, porkbunMinTTL, "Porkbun")),
+	}, &created)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.recordIDs[fqdn+value] = created.ID.String()
+	p.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (p *DNSProviderPorkbun) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, name, err := p.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	id, ok := p.recordIDs[fqdn+value]
+	p.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		return p.findRecordID(zone, name, value)
+	}, func(id string) error {
+		return p.doRequest("/dns/delete/"+zone+"/"+id, nil, nil)
+	}, id, ok)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.recordIDs, fqdn+value)
+	p.mu.Unlock()
+
+	return nil
+}
+
+// findRecordID returns the id of the TXT record name with the given value.
+func (p *DNSProviderPorkbun) findRecordID(zone, name, value string) (string, error) {
+	var resp struct {
+		Records []struct {
+			ID      json.Number `json:"id"`
+			Content string      `json:"content"`
+		} `json:"records"`
+	}
+	if err := p.doRequest("/dns/retrieveByNameType/"+zone+"/TXT/"+name, nil, &resp); err != nil {
+		return "", err
+	}
+
+	for _, rec := range resp.Records {
+		if rec.Content == value {
+			return rec.ID.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("Porkbun TXT record %s.%s not found", name, zone)
+}
+
+// splitFqdn returns the zone of fqdn and the record name relative to that
+// zone, which is empty for the zone apex.
+func (p *DNSProviderPorkbun) splitFqdn(fqdn string) (zone, name string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = ""
+	}
+
+	return unFqdn(zone), name, nil
+}
+
+// doRequest POSTs params to the API endpoint path, along with the API keys
+// Porkbun expects in every request body, and decodes the response into
+// result if it is not nil.
+func (p *DNSProviderPorkbun) doRequest(path string, params map[string]string, result interface{}) error {
+	payload := map[string]string{"apikey": p.apiKey, "secretapikey": p.secretKey}
+	for k, v := range params {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", p.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("Porkbun API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return fmt.Errorf("Porkbun API call failed: %v", err)
+	}
+
+	// Porkbun reports failures with a status of ERROR, usually but not
+	// always along with an HTTP error status.
+	var status struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(msg, &status); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("Porkbun API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+		return fmt.Errorf("Porkbun API response could not be decoded: %v", err)
+	}
+	if status.Status != "SUCCESS" {
+		return fmt.Errorf("Porkbun API call failed with HTTP status %d: %s", resp.StatusCode, status.Message)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(msg, result); err != nil {
+			return fmt.Errorf("Porkbun API response could not be decoded: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	porkbunAPIKeyEnv    = os.Getenv("PORKBUN_API_KEY")
+	porkbunSecretKeyEnv = os.Getenv("PORKBUN_SECRET_API_KEY")
+)
+
+func restorePorkbunEnv() {
+	os.Setenv("PORKBUN_API_KEY", porkbunAPIKeyEnv)
+	os.Setenv("PORKBUN_SECRET_API_KEY", porkbunSecretKeyEnv)
+}
+
+func TestNewDNSProviderPorkbunMissingCredErr(t *testing.T) {
+	os.Setenv("PORKBUN_API_KEY", "")
+	os.Setenv("PORKBUN_SECRET_API_KEY", "")
+	_, err := NewDNSProviderPorkbun("", "")
+	assert.EqualError(t, err, "Porkbun credentials missing")
+	restorePorkbunEnv()
+}
+
+func TestNewDNSProviderPorkbunValidEnv(t *testing.T) {
+	os.Setenv("PORKBUN_API_KEY", "pk1_123")
+	os.Setenv("PORKBUN_SECRET_API_KEY", "sk1_456")
+	_, err := NewDNSProviderPorkbun("", "")
+	assert.NoError(t, err)
+	restorePorkbunEnv()
+}
+
+type porkbunTestRecord struct {
+	ID      string
+	Name    string
+	Content string
+	TTL     string
+}
+
+// fakePorkbun holds the TXT records of example.com. Like Porkbun, it
+// answers some errors with HTTP status 200.
+type fakePorkbun struct {
+	t       *testing.T
+	records []porkbunTestRecord
+	deleted []string
+}
+
+func (f *fakePorkbun) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&req))
+	if r.Method != "POST" || req["apikey"] != "pk1_123" || req["secretapikey"] != "sk1_456" {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSONResponse(w, map[string]string{"status": "ERROR", "message": "Invalid API key. (002)"})
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/dns/create/example.com":
+		id := fmt.Sprintf("%d", 1000+len(f.records))
+		f.records = append(f.records, porkbunTestRecord{ID: id, Name: req["name"], Content: req["content"], TTL: req["ttl"]})
+		writeJSONResponse(w, map[string]interface{}{"status": "SUCCESS", "id": 1000 + len(f.records) - 1})
+	case strings.HasPrefix(r.URL.Path, "/dns/delete/example.com/"):
+		id := strings.TrimPrefix(r.URL.Path, "/dns/delete/example.com/")
+		for i, rec := range f.records {
+			if rec.ID == id {
+				f.records = append(f.records[:i], f.records[i+1:]...)
+				f.deleted = append(f.deleted, id)
+				writeJSONResponse(w, map[string]string{"status": "SUCCESS"})
+				return
+			}
+		}
+		writeJSONResponse(w, map[string]string{"status": "ERROR", "message": "Invalid record ID."})
+	case strings.HasPrefix(r.URL.Path, "/dns/retrieveByNameType/example.com/TXT/"):
+		name := strings.TrimPrefix(r.URL.Path, "/dns/retrieveByNameType/example.com/TXT/")
+		var records []map[string]string
+		for _, rec := range f.records {
+			if rec.Name == name {
+				records = append(records, map[string]string{"id": rec.ID, "name": name + ".example.com", "type": "TXT", "content": rec.Content})
+			}
+		}
+		writeJSONResponse(w, map[string]interface{}{"status": "SUCCESS", "records": records})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		writeJSONResponse(w, map[string]string{"status": "ERROR", "message": "Invalid endpoint."})
+	}
+}
+
+func startPorkbunTest(t *testing.T) (*DNSProviderPorkbun, *fakePorkbun, func()) {
+	fake := &fakePorkbun{t: t}
+	apiURL, done := startDNSProviderTest(t, fake)
+
+	provider, err := NewDNSProviderPorkbun("pk1_123", "sk1_456")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	return provider, fake, done
+}
+
+func TestPorkbunPresentAndCleanUp(t *testing.T) {
+	provider, fake, done := startPorkbunTest(t)
+	defer done()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	assert.Equal(t, []porkbunTestRecord{{ID: "1000", Name: "_acme-challenge.www", Content: value, TTL: "600"}}, fake.records)
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"1000"}, fake.deleted)
+	assert.Empty(t, fake.records)
+}
+
+func TestPorkbunCleanUpLooksUpRecord(t *testing.T) {
+	provider, fake, done := startPorkbunTest(t)
+	defer done()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+	fake.records = []porkbunTestRecord{
+		{ID: "7", Name: "_acme-challenge.www", Content: "other"},
+		{ID: "8", Name: "_acme-challenge.www", Content: value},
+	}
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"8"}, fake.deleted)
+
+	err := provider.CleanUp("other.example.com", "", "123d==")
+	assert.EqualError(t, err, "Porkbun TXT record _acme-challenge.other.example.com not found")
+}
+
+func TestPorkbunErrorStatus(t *testing.T) {
+	provider, fake, done := startPorkbunTest(t)
+	defer done()
+
+	// Porkbun reports an unknown record id with HTTP status 200.
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	fake.records = nil
+	err := provider.CleanUp("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "Porkbun API call failed with HTTP status 200: Invalid record ID.")
+
+	provider.secretKey = "wrong"
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "Porkbun API call failed with HTTP status 400: Invalid API key. (002)")
+}
@@ -0,0 +1,252 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DNSProviderPowerDNS is an implementation of the ChallengeProvider interface
+// that uses the HTTP API of a PowerDNS authoritative server to manage TXT records.
+//
+// PowerDNS only replaces or deletes whole rrsets, so every change reads the
+// current TXT rrsets and writes them back with the records added or removed.
+// It implements BatchDNSProvider, changing all records of a zone at once.
+type DNSProviderPowerDNS struct {
+	apiKey  string
+	baseURL string
+}
+
+// NewDNSProviderPowerDNS returns a DNSProviderPowerDNS instance with a configured PowerDNS client.
+// serverURL is the address of the PowerDNS web server, e.g. http://127.0.0.1:8081. Both arguments
+// fall back to the environment variables PDNS_API_URL and PDNS_API_KEY when empty.
+func NewDNSProviderPowerDNS(serverURL, apiKey string) (*DNSProviderPowerDNS, error) {
+	if serverURL == "" || apiKey == "" {
+		serverURL = os.Getenv("PDNS_API_URL")
+		apiKey = os.Getenv("PDNS_API_KEY")
+		if serverURL == "" || apiKey == "" {
+			return nil, fmt.Errorf("PowerDNS credentials missing")
+		}
+	}
+
+	return &DNSProviderPowerDNS{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(serverURL, "/") + "/api/v1/servers/localhost",
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (p *DNSProviderPowerDNS) Present(domain, token, keyAuth string) error {
+	return p.PresentBatch([]DNSChallengeRecord{{Domain: domain, Token: token, KeyAuth: keyAuth}})
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (p *DNSProviderPowerDNS) CleanUp(domain, token, keyAuth string) error {
+	return p.CleanUpBatch([]DNSChallengeRecord{{Domain: domain, Token: token, KeyAuth: keyAuth}})
+}
+
+// PresentBatch creates the TXT records of several dns-01 challenges, with a
+// single PATCH request per zone.
+func (p *DNSProviderPowerDNS) PresentBatch(records []DNSChallengeRecord) error {
+	return p.changeBatch(records, func(rrset []pdnsRecord, content string) []pdnsRecord {
+		for _, r := range rrset {
+			if r.Content == content {
+				return rrset
+			}
+		}
+		return append(rrset, pdnsRecord{Content: content})
+	})
+}
+
+// CleanUpBatch removes the TXT records of several dns-01 challenges, with a
+// single PATCH request per zone.
+func (p *DNSProviderPowerDNS) CleanUpBatch(records []DNSChallengeRecord) error {
+	return p.changeBatch(records, func(rrset []pdnsRecord, content string) []pdnsRecord {
+		var keep []pdnsRecord
+		for _, r := range rrset {
+			if r.Content != content {
+				keep = append(keep, r)
+			}
+		}
+		return keep
+	})
+}
+
+// changeBatch applies change to the TXT rrset of every record and writes the
+// rrsets that changed back, zone by zone.
+func (p *DNSProviderPowerDNS) changeBatch(records []DNSChallengeRecord, change func(rrset []pdnsRecord, content string) []pdnsRecord) error {
+	type pdnsZoneChange struct {
+		current map[string][]pdnsRecord
+		changed map[string][]pdnsRecord
+		ttl     map[string]int
+		names   []string
+	}
+
+	var zones []string
+	changes := make(map[string]*pdnsZoneChange)
+	for _, rec := range records {
+		fqdn, value, ttl := DNS01Record(rec.Domain, rec.KeyAuth)
+		zone, name, err := p.splitFqdn(fqdn)
+		if err != nil {
+			return err
+		}
+
+		zc, ok := changes[zone]
+		if !ok {
+			current, err := p.getTXTRecords(zone)
+			if err != nil {
+				return err
+			}
+			zc = &pdnsZoneChange{current: current, changed: make(map[string][]pdnsRecord), ttl: make(map[string]int)}
+			changes[zone] = zc
+			zones = append(zones, zone)
+		}
+
+		rrset, ok := zc.changed[name]
+		if !ok {
+			rrset = zc.current[name]
+			zc.names = append(zc.names, name)
+		}
+		zc.changed[name] = change(rrset, `"`+value+`"`)
+		zc.ttl[name] = ttl
+	}
+
+	for _, zone := range zones {
+		zc := changes[zone]
+		var rrsets []pdnsRRSet
+		for _, name := range zc.names {
+			rrset := zc.changed[name]
+			switch {
+			case pdnsSameRecords(rrset, zc.current[name]):
+			case len(rrset) > 0:
+				rrsets = append(rrsets, pdnsRRSet{Name: name, Type: "TXT", TTL: zc.ttl[name], ChangeType: "REPLACE", Records: rrset})
+			default:
+				rrsets = append(rrsets, pdnsRRSet{Name: name, Type: "TXT", ChangeType: "DELETE"})
+			}
+		}
+		if len(rrsets) == 0 {
+			continue
+		}
+		if err := p.patchRRSets(zone, rrsets); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pdnsSameRecords reports whether a and b hold the same records in the same
+// order; change functions only ever append or remove records.
+func pdnsSameRecords(a, b []pdnsRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFqdn returns the zone of fqdn and fqdn itself, both in the canonical
+// form PowerDNS expects: lower case and with a trailing dot.
+func (p *DNSProviderPowerDNS) splitFqdn(fqdn string) (zone, name string, err error) {
+	name = strings.ToLower(toFqdn(fqdn))
+	zone, err = findZoneByFqdn(name, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	return strings.ToLower(toFqdn(zone)), name, nil
+}
+
+type pdnsRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type pdnsRRSet struct {
+	Name       string       `json:"name"`
+	Type       string       `json:"type"`
+	TTL        int          `json:"ttl,omitempty"`
+	ChangeType string       `json:"changetype,omitempty"`
+	Records    []pdnsRecord `json:"records"`
+}
+
+// getTXTRecords returns the records of the TXT rrsets in zone by name.
+func (p *DNSProviderPowerDNS) getTXTRecords(zone string) (map[string][]pdnsRecord, error) {
+	resp, err := p.doRequest("GET", p.baseURL+"/zones/"+zone, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var z struct {
+		RRSets []pdnsRRSet `json:"rrsets"`
+	}
+	if err := json.Unmarshal(resp, &z); err != nil {
+		return nil, fmt.Errorf("PowerDNS API response could not be decoded: %v", err)
+	}
+
+	records := make(map[string][]pdnsRecord)
+	for _, rrset := range z.RRSets {
+		if rrset.Type == "TXT" {
+			records[strings.ToLower(toFqdn(rrset.Name))] = rrset.Records
+		}
+	}
+
+	return records, nil
+}
+
+func (p *DNSProviderPowerDNS) patchRRSets(zone string, rrsets []pdnsRRSet) error {
+	for i := range rrsets {
+		if rrsets[i].Records == nil {
+			rrsets[i].Records = []pdnsRecord{}
+		}
+	}
+
+	body, err := json.Marshal(map[string][]pdnsRRSet{"rrsets": rrsets})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.doRequest("PATCH", p.baseURL+"/zones/"+zone, bytes.NewReader(body))
+	return err
+}
+
+func (p *DNSProviderPowerDNS) doRequest(method, uri string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("PowerDNS API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("PowerDNS API call failed: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("PowerDNS API call failed with HTTP status %d: %s", resp.StatusCode, apiErr.Error)
+		}
+		return nil, fmt.Errorf("PowerDNS API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
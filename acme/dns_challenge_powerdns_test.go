@@ -0,0 +1,163 @@
+package acme
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	pdnsAPIURLEnv = os.Getenv("PDNS_API_URL")
+	pdnsAPIKeyEnv = os.Getenv("PDNS_API_KEY")
+)
+
+func restorePowerDNSEnv() {
+	os.Setenv("PDNS_API_URL", pdnsAPIURLEnv)
+	os.Setenv("PDNS_API_KEY", pdnsAPIKeyEnv)
+}
+
+func TestNewDNSProviderPowerDNSMissingCredErr(t *testing.T) {
+	os.Setenv("PDNS_API_URL", "")
+	os.Setenv("PDNS_API_KEY", "")
+	_, err := NewDNSProviderPowerDNS("", "")
+	assert.EqualError(t, err, "PowerDNS credentials missing")
+	restorePowerDNSEnv()
+}
+
+func TestNewDNSProviderPowerDNSValidEnv(t *testing.T) {
+	os.Setenv("PDNS_API_URL", "http://127.0.0.1:8081/")
+	os.Setenv("PDNS_API_KEY", "123")
+	provider, err := NewDNSProviderPowerDNS("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8081/api/v1/servers/localhost", provider.baseURL)
+	restorePowerDNSEnv()
+}
+
+func TestPowerDNSPresentAndCleanUp(t *testing.T) {
+	// The zone starts out with a TXT record left by another client.
+	rrsets := []pdnsRRSet{
+		{Name: "example.com.", Type: "SOA", TTL: 3600, Records: []pdnsRecord{{Content: "ns.example.com. admin.example.com. 1 7200 3600 1209600 3600"}}},
+		{Name: "_acme-challenge.www.example.com.", Type: "TXT", TTL: 120, Records: []pdnsRecord{{Content: `"other"`}}},
+	}
+	var patches []pdnsRRSet
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSONResponse(w, map[string]string{"error": "Unauthorized"})
+			return
+		}
+		if r.URL.Path != "/api/v1/servers/localhost/zones/example.com." {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSONResponse(w, map[string]string{"error": "Could not find domain"})
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSONResponse(w, map[string]interface{}{"name": "example.com.", "rrsets": rrsets})
+		case "PATCH":
+			var body struct {
+				RRSets []pdnsRRSet `json:"rrsets"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Len(t, body.RRSets, 1)
+			patch := body.RRSets[0]
+			patches = append(patches, patch)
+
+			rrsets = rrsets[:1]
+			if patch.ChangeType == "REPLACE" {
+				rrsets = append(rrsets, pdnsRRSet{Name: patch.Name, Type: patch.Type, TTL: patch.TTL, Records: patch.Records})
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderPowerDNS(apiURL, "123")
+	assert.NoError(t, err)
+
+	_, value, _ := DNS01Record("WWW.Example.com", "123d==")
+
+	assert.NoError(t, provider.Present("WWW.Example.com", "", "123d=="))
+	assert.Equal(t, []pdnsRRSet{{
+		Name:       "_acme-challenge.www.example.com.",
+		Type:       "TXT",
+		TTL:        120,
+		ChangeType: "REPLACE",
+		Records:    []pdnsRecord{{Content: `"other"`}, {Content: `"` + value + `"`}},
+	}}, patches)
+
+	patches = nil
+	assert.NoError(t, provider.CleanUp("WWW.Example.com", "", "123d=="))
+	assert.Equal(t, []pdnsRRSet{{
+		Name:       "_acme-challenge.www.example.com.",
+		Type:       "TXT",
+		TTL:        120,
+		ChangeType: "REPLACE",
+		Records:    []pdnsRecord{{Content: `"other"`}},
+	}}, patches)
+
+	// Removing the last record deletes the rrset.
+	rrsets[1].Records = []pdnsRecord{{Content: `"` + value + `"`}}
+	patches = nil
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []pdnsRRSet{{
+		Name:       "_acme-challenge.www.example.com.",
+		Type:       "TXT",
+		ChangeType: "DELETE",
+		Records:    []pdnsRecord{},
+	}}, patches)
+
+	provider.apiKey = "bad"
+	err = provider.Present("www.example.com", "", "123d==")
+	assert.EqualError(t, err, "PowerDNS API call failed with HTTP status 401: Unauthorized")
+}
+
+func TestPowerDNSBatch(t *testing.T) {
+	var gets int
+	var patches [][]pdnsRRSet
+	apiURL, done := startDNSProviderTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			gets++
+			writeJSONResponse(w, map[string]interface{}{"name": "example.com.", "rrsets": []pdnsRRSet{}})
+		case "PATCH":
+			var body struct {
+				RRSets []pdnsRRSet `json:"rrsets"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			patches = append(patches, body.RRSets)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer done()
+
+	provider, err := NewDNSProviderPowerDNS(apiURL, "123")
+	assert.NoError(t, err)
+
+	records := []DNSChallengeRecord{
+		{Domain: "www.example.com", KeyAuth: "keyAuth1"},
+		{Domain: "*.www.example.com", KeyAuth: "keyAuth2"},
+		{Domain: "mail.example.com", KeyAuth: "keyAuth3"},
+	}
+	_, value1, _ := DNS01Record("www.example.com", "keyAuth1")
+	_, value2, _ := DNS01Record("*.www.example.com", "keyAuth2")
+	_, value3, _ := DNS01Record("mail.example.com", "keyAuth3")
+
+	assert.NoError(t, provider.PresentBatch(records))
+	assert.Equal(t, 1, gets)
+	assert.Equal(t, [][]pdnsRRSet{{
+		{Name: "_acme-challenge.www.example.com.", Type: "TXT", TTL: 120, ChangeType: "REPLACE", Records: []pdnsRecord{{Content: `"` + value1 + `"`}, {Content: `"` + value2 + `"`}}},
+		{Name: "_acme-challenge.mail.example.com.", Type: "TXT", TTL: 120, ChangeType: "REPLACE", Records: []pdnsRecord{{Content: `"` + value3 + `"`}}},
+	}}, patches)
+
+	// Nothing to remove from the (still empty) zone means no PATCH at all.
+	patches = nil
+	assert.NoError(t, provider.CleanUpBatch(records))
+	assert.Nil(t, patches)
+}
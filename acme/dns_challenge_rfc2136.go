@@ -2,29 +2,53 @@ package acme
 
 import (
 	"fmt"
-	"github.com/miekg/dns"
+	"os"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 // DNSProviderRFC2136 is an implementation of the ChallengeProvider interface that
 // uses dynamic DNS updates (RFC 2136) to create TXT records on a nameserver.
 type DNSProviderRFC2136 struct {
-	nameserver string
-	zone       string
-	tsigKey    string
-	tsigSecret string
-	records    map[string]string
+	nameserver    string
+	zone          string
+	tsigAlgorithm string
+	tsigKey       string
+	tsigSecret    string
 }
 
 // NewDNSProviderRFC2136 returns a new DNSProviderRFC2136 instance.
 // To disable TSIG authentication 'tsigKey' and 'tsigSecret' must be set to the empty string.
 // 'nameserver' must be a network address in the the form "host:port". 'zone' must be the fully
-// qualified name of the zone.
-func NewDNSProviderRFC2136(nameserver, zone, tsigKey, tsigSecret string) (*DNSProviderRFC2136, error) {
+// qualified name of the zone. If 'zone' is empty, the zone of each record is looked up by
+// querying 'nameserver' for the SOA of the record's domain. 'tsigAlgorithm' is the name of
+// the TSIG algorithm, e.g. "hmac-sha256."; it defaults to HMAC-MD5 when empty.
+// Empty TSIG and nameserver arguments are read from the environment variables
+// RFC2136_NAMESERVER, RFC2136_TSIG_ALGORITHM, RFC2136_TSIG_KEY and RFC2136_TSIG_SECRET.
+func NewDNSProviderRFC2136(nameserver, zone, tsigAlgorithm, tsigKey, tsigSecret string) (*DNSProviderRFC2136, error) {
+	if nameserver == "" {
+		nameserver = os.Getenv("RFC2136_NAMESERVER")
+	}
+	if tsigAlgorithm == "" {
+		tsigAlgorithm = os.Getenv("RFC2136_TSIG_ALGORITHM")
+	}
+	if tsigKey == "" && tsigSecret == "" {
+		tsigKey = os.Getenv("RFC2136_TSIG_KEY")
+		tsigSecret = os.Getenv("RFC2136_TSIG_SECRET")
+	}
+
+	if nameserver == "" {
+		return nil, fmt.Errorf("RFC2136 nameserver missing")
+	}
+	if tsigAlgorithm == "" {
+		tsigAlgorithm = dns.HmacMD5
+	}
+
 	d := &DNSProviderRFC2136{
-		nameserver: nameserver,
-		zone:       zone,
-		records:    make(map[string]string),
+		nameserver:    nameserver,
+		zone:          zone,
+		tsigAlgorithm: dns.Fqdn(tsigAlgorithm),
 	}
 	if len(tsigKey) > 0 && len(tsigSecret) > 0 {
 		d.tsigKey = tsigKey
@@ -37,14 +61,12 @@ func NewDNSProviderRFC2136(nameserver, zone, tsigKey, tsigSecret string) (*DNSPr
 // Present creates a TXT record using the specified parameters
 func (r *DNSProviderRFC2136) Present(domain, token, keyAuth string) error {
 	fqdn, value, ttl := DNS01Record(domain, keyAuth)
-	r.records[fqdn] = value
 	return r.changeRecord("INSERT", fqdn, value, ttl)
 }
 
 // CleanUp removes the TXT record matching the specified parameters
 func (r *DNSProviderRFC2136) CleanUp(domain, token, keyAuth string) error {
-	fqdn, _, ttl := DNS01Record(domain, keyAuth)
-	value := r.records[fqdn]
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
 	return r.changeRecord("REMOVE", fqdn, value, ttl)
 }
 
@@ -52,13 +74,22 @@ func (r *DNSProviderRFC2136) changeRecord(action, fqdn, value string, ttl int) e
 	// Create RR
 	rr := new(dns.TXT)
 	rr.Hdr = dns.RR_Header{Name: fqdn, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(ttl)}
-	rr.Txt = []string{value}
+	rr.Txt = splitTXTValue(value)
 	rrs := make([]dns.RR, 1)
 	rrs[0] = rr
 
+	zone := r.zone
+	if zone == "" {
+		var err error
+		zone, err = findZoneByFqdn(fqdn, []string{r.nameserver})
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create dynamic update packet
 	m := new(dns.Msg)
-	m.SetUpdate(dns.Fqdn(r.zone))
+	m.SetUpdate(dns.Fqdn(zone))
 	switch action {
 	case "INSERT":
 		m.Insert(rrs)
@@ -73,7 +104,7 @@ func (r *DNSProviderRFC2136) changeRecord(action, fqdn, value string, ttl int) e
 	c.SingleInflight = true
 	// TSIG authentication / msg signing
 	if len(r.tsigKey) > 0 && len(r.tsigSecret) > 0 {
-		m.SetTsig(dns.Fqdn(r.tsigKey), dns.HmacMD5, 300, time.Now().Unix())
+		m.SetTsig(dns.Fqdn(r.tsigKey), r.tsigAlgorithm, 300, time.Now().Unix())
 		c.TsigSecret = map[string]string{dns.Fqdn(r.tsigKey): r.tsigSecret}
 	}
 
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"github.com/miekg/dns"
 	"net"
+	"os"
 	"strings"
 	"sync"
 	"testing"
@@ -56,7 +57,26 @@ func TestRFC2136ServerSuccess(t *testing.T) {
 	}
 	defer server.Shutdown()
 
-	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", "")
+	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", "", "")
+	if err != nil {
+		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
+	}
+	if err := provider.Present(rfc2136TestDomain, "", rfc2136TestKeyAuth); err != nil {
+		t.Errorf("Expected Present() to return no error but the error was -> %v", err)
+	}
+}
+
+func TestRFC2136ServerSuccessZoneLookup(t *testing.T) {
+	dns.HandleFunc(rfc2136TestZone, serverHandlerSOA)
+	defer dns.HandleRemove(rfc2136TestZone)
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	provider, err := NewDNSProviderRFC2136(addrstr, "", "", "", "")
 	if err != nil {
 		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
 	}
@@ -75,7 +95,7 @@ func TestRFC2136ServerError(t *testing.T) {
 	}
 	defer server.Shutdown()
 
-	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", "")
+	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", "", "")
 	if err != nil {
 		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
 	}
@@ -96,13 +116,63 @@ func TestRFC2136TsigClient(t *testing.T) {
 	}
 	defer server.Shutdown()
 
-	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, rfc2136TestTsigKey, rfc2136TestTsigSecret)
+	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", rfc2136TestTsigKey, rfc2136TestTsigSecret)
+	if err != nil {
+		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
+	}
+	if err := provider.Present(rfc2136TestDomain, "", rfc2136TestKeyAuth); err != nil {
+		t.Errorf("Expected Present() to return no error but the error was -> %v", err)
+	}
+}
+
+func TestRFC2136TsigClientAlgorithm(t *testing.T) {
+	dns.HandleFunc(rfc2136TestZone, serverHandlerPassBackRequest)
+	defer dns.HandleRemove(rfc2136TestZone)
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", true)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "hmac-sha256", rfc2136TestTsigKey, rfc2136TestTsigSecret)
 	if err != nil {
 		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
 	}
 	if err := provider.Present(rfc2136TestDomain, "", rfc2136TestKeyAuth); err != nil {
 		t.Errorf("Expected Present() to return no error but the error was -> %v", err)
 	}
+
+	rcvMsg := <-reqChan
+	if tsig := rcvMsg.IsTsig(); tsig == nil {
+		t.Errorf("Expected update to be signed but it was not")
+	} else if tsig.Algorithm != dns.HmacSHA256 {
+		t.Errorf("Expected TSIG algorithm %q but got %q", dns.HmacSHA256, tsig.Algorithm)
+	}
+}
+
+func TestRFC2136Env(t *testing.T) {
+	for _, key := range []string{"RFC2136_NAMESERVER", "RFC2136_TSIG_ALGORITHM", "RFC2136_TSIG_KEY", "RFC2136_TSIG_SECRET"} {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+
+	os.Setenv("RFC2136_NAMESERVER", "")
+	if _, err := NewDNSProviderRFC2136("", rfc2136TestZone, "", "", ""); err == nil {
+		t.Errorf("Expected NewDNSProviderRFC2136() to return an error without a nameserver")
+	}
+
+	os.Setenv("RFC2136_NAMESERVER", "127.0.0.1:53")
+	os.Setenv("RFC2136_TSIG_ALGORITHM", "hmac-sha512.")
+	os.Setenv("RFC2136_TSIG_KEY", rfc2136TestTsigKey)
+	os.Setenv("RFC2136_TSIG_SECRET", rfc2136TestTsigSecret)
+	provider, err := NewDNSProviderRFC2136("", rfc2136TestZone, "", "", "")
+	if err != nil {
+		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
+	}
+	if provider.nameserver != "127.0.0.1:53" || provider.tsigAlgorithm != dns.HmacSHA512 ||
+		provider.tsigKey != rfc2136TestTsigKey || provider.tsigSecret != rfc2136TestTsigSecret {
+		t.Errorf("Expected provider to be configured from the environment but got %+v", provider)
+	}
 }
 
 func TestRFC2136ValidUpdatePacket(t *testing.T) {
@@ -134,7 +204,7 @@ func TestRFC2136ValidUpdatePacket(t *testing.T) {
 		t.Fatalf("Error packing expect msg: %v", err)
 	}
 
-	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", "")
+	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", "", "")
 	if err != nil {
 		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
 	}
@@ -160,6 +230,41 @@ func TestRFC2136ValidUpdatePacket(t *testing.T) {
 	}
 }
 
+func TestRFC2136ValidRemovePacket(t *testing.T) {
+	dns.HandleFunc(rfc2136TestZone, serverHandlerPassBackRequest)
+	defer dns.HandleRemove(rfc2136TestZone)
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	provider, err := NewDNSProviderRFC2136(addrstr, rfc2136TestZone, "", "", "")
+	if err != nil {
+		t.Fatalf("Expected NewDNSProviderRFC2136() to return no error but the error was -> %v", err)
+	}
+
+	if err := provider.CleanUp(rfc2136TestDomain, "", "1234d=="); err != nil {
+		t.Errorf("Expected CleanUp() to return no error but the error was -> %v", err)
+	}
+
+	rcvMsg := <-reqChan
+	if len(rcvMsg.Ns) != 1 {
+		t.Fatalf("Expected exactly one RR in the update section but got %d", len(rcvMsg.Ns))
+	}
+	txt, ok := rcvMsg.Ns[0].(*dns.TXT)
+	if !ok {
+		t.Fatalf("Expected a TXT RR in the update section but got %v", rcvMsg.Ns[0])
+	}
+	if txt.Hdr.Class != dns.ClassNONE {
+		t.Errorf("Expected the RR to be removed (class NONE) but got class %d", txt.Hdr.Class)
+	}
+	if txt.Hdr.Name != rfc2136TestFqdn || len(txt.Txt) != 1 || txt.Txt[0] != rfc2136TestValue {
+		t.Errorf("Expected removal of %s TXT %q but got %v", rfc2136TestFqdn, rfc2136TestValue, txt)
+	}
+}
+
 func runLocalDNSTestServer(listenAddr string, tsig bool) (*dns.Server, string, error) {
 	pc, err := net.ListenPacket("udp", listenAddr)
 	if err != nil {
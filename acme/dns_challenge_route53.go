@@ -2,6 +2,7 @@ package acme
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -9,31 +10,53 @@ import (
 	"github.com/mitchellh/goamz/route53"
 )
 
+const (
+	// route53Timeout is how long to wait for a change to become INSYNC.
+	route53Timeout = 90 * time.Second
+	// route53Interval is how often the change status is polled.
+	route53Interval = 5 * time.Second
+)
+
 // DNSProviderRoute53 is an implementation of the DNSProvider interface
 type DNSProviderRoute53 struct {
 	client *route53.Route53
+	// role is set if the provider works with the temporary credentials of
+	// an assumed IAM role instead of client.
+	role *route53Role
 }
 
 // NewDNSProviderRoute53 returns a DNSProviderRoute53 instance with a configured route53 client.
-// Authentication is either done using the passed credentials or - when empty -
-// using the environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+// Authentication is either done using the passed credentials or - when empty - falls back to
+// the standard AWS credential chain: the shared credentials file, the environment variables
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY and finally the EC2 instance role.
+// If awsRegionName is empty, the region is read from the environment variable AWS_REGION.
+// If the environment variable AWS_ROLE_ARN is set, these credentials are only used to
+// assume that IAM role through STS, optionally with the external ID AWS_ROLE_EXTERNAL_ID.
+// The temporary credentials of the role are refreshed before they expire.
 func NewDNSProviderRoute53(awsAccessKey, awsSecretKey, awsRegionName string) (*DNSProviderRoute53, error) {
+	if awsRegionName == "" {
+		awsRegionName = os.Getenv("AWS_REGION")
+	}
+
 	region, ok := aws.Regions[awsRegionName]
 	if !ok {
 		return nil, fmt.Errorf("Invalid AWS region name %s", awsRegionName)
 	}
 
-	var auth aws.Auth
-	// First try passed in credentials
-	if awsAccessKey != "" && awsSecretKey != "" {
-		auth = aws.Auth{awsAccessKey, awsSecretKey, ""}
-	} else {
-		// try getting credentials from environment
-		envAuth, err := aws.EnvAuth()
-		if err != nil {
-			return nil, fmt.Errorf("AWS credentials missing")
+	auth, err := aws.GetAuth(awsAccessKey, awsSecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("AWS credentials missing")
+	}
+
+	if roleARN := os.Getenv("AWS_ROLE_ARN"); roleARN != "" {
+		role := &route53Role{
+			auth:       auth,
+			region:     region,
+			roleARN:    roleARN,
+			externalID: os.Getenv("AWS_ROLE_EXTERNAL_ID"),
+			baseURL:    stsAPIURL,
 		}
-		auth = envAuth
+		return &DNSProviderRoute53{role: role}, nil
 	}
 
 	client := route53.New(auth, region)
@@ -53,7 +76,12 @@ func (r *DNSProviderRoute53) CleanUp(domain, token, keyAuth string) error {
 }
 
 func (r *DNSProviderRoute53) changeRecord(action, fqdn, value string, ttl int) error {
-	hostedZoneID, err := r.getHostedZoneID(fqdn)
+	client, err := r.getClient()
+	if err != nil {
+		return err
+	}
+
+	hostedZoneID, err := getHostedZoneID(client, fqdn)
 	if err != nil {
 		return err
 	}
@@ -61,20 +89,46 @@ func (r *DNSProviderRoute53) changeRecord(action, fqdn, value string, ttl int) e
 	update := route53.Change{action, recordSet}
 	changes := []route53.Change{update}
 	req := route53.ChangeResourceRecordSetsRequest{Comment: "Created by Lego", Changes: changes}
-	_, err = r.client.ChangeResourceRecordSets(hostedZoneID, &req)
-	return err
+	resp, err := client.ChangeResourceRecordSets(hostedZoneID, &req)
+	if err != nil {
+		return err
+	}
+
+	// Route53 applies changes asynchronously. Only return once the change
+	// has been propagated to all Route53 DNS servers.
+	return waitFor(route53Timeout, route53Interval, func() (bool, error) {
+		return changeInSync(client, resp.ChangeInfo.ID)
+	})
+}
+
+// getClient returns the Route53 client to use for the next change.
+func (r *DNSProviderRoute53) getClient() (*route53.Route53, error) {
+	if r.role != nil {
+		return r.role.getClient()
+	}
+	return r.client, nil
+}
+
+// changeInSync reports whether the change with the given ID has been
+// applied to all Route53 DNS servers.
+func changeInSync(client *route53.Route53, changeID string) (bool, error) {
+	status, err := client.GetChange(changeID)
+	if err != nil {
+		return false, err
+	}
+	return status == "INSYNC", nil
 }
 
-func (r *DNSProviderRoute53) getHostedZoneID(fqdn string) (string, error) {
+func getHostedZoneID(client *route53.Route53, fqdn string) (string, error) {
 	zones := []route53.HostedZone{}
-	zoneResp, err := r.client.ListHostedZones("", 0)
+	zoneResp, err := client.ListHostedZones("", 0)
 	if err != nil {
 		return "", err
 	}
 	zones = append(zones, zoneResp.HostedZones...)
 
 	for zoneResp.IsTruncated {
-		resp, err := r.client.ListHostedZones(zoneResp.Marker, 0)
+		resp, err := client.ListHostedZones(zoneResp.Marker, 0)
 		if err != nil {
 			if rateExceeded(err) {
 				time.Sleep(time.Second)
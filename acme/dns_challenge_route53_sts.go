@@ -0,0 +1,180 @@
+package acme
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/goamz/aws"
+	"github.com/mitchellh/goamz/route53"
+)
+
+const (
+	stsAPIURL = "https://sts.amazonaws.com/"
+	// stsRegion is the region requests to the global STS endpoint are signed for.
+	stsRegion = "us-east-1"
+	// stsDuration is how long the temporary credentials of an assumed role are valid.
+	stsDuration = time.Hour
+	// stsRefreshWindow is how long before their expiration the temporary
+	// credentials are replaced.
+	stsRefreshWindow = 5 * time.Minute
+)
+
+// route53Role assumes an IAM role through STS and keeps a Route53 client
+// using the temporary credentials of that role.
+type route53Role struct {
+	auth       aws.Auth
+	region     aws.Region
+	roleARN    string
+	externalID string
+	baseURL    string
+
+	mu         sync.Mutex
+	client     *route53.Route53
+	expiration time.Time
+}
+
+// getClient returns a Route53 client with valid credentials for the role,
+// assuming the role again if the current credentials are about to expire.
+func (r *route53Role) getClient() (*route53.Route53, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client != nil && timeNow().Add(stsRefreshWindow).Before(r.expiration) {
+		return r.client, nil
+	}
+
+	auth, expiration, err := r.assumeRole()
+	if err != nil {
+		return nil, err
+	}
+
+	r.client = route53.New(auth, r.region)
+	r.expiration = expiration
+	return r.client, nil
+}
+
+// assumeRole calls STS AssumeRole and returns the temporary credentials.
+func (r *route53Role) assumeRole() (aws.Auth, time.Time, error) {
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {r.roleARN},
+		"RoleSessionName": {"lego"},
+		"DurationSeconds": {fmt.Sprintf("%d", int(stsDuration.Seconds()))},
+	}
+	if r.externalID != "" {
+		form.Set("ExternalId", r.externalID)
+	}
+	body := form.Encode()
+
+	req, err := http.NewRequest("POST", r.baseURL, strings.NewReader(body))
+	if err != nil {
+		return aws.Auth{}, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signV4(req, []byte(body), r.auth, stsRegion, "sts", timeNow())
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return aws.Auth{}, time.Time{}, fmt.Errorf("AWS STS AssumeRole failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return aws.Auth{}, time.Time{}, fmt.Errorf("AWS STS AssumeRole failed: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var stsErr struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(msg, &stsErr) == nil && stsErr.Code != "" {
+			return aws.Auth{}, time.Time{}, fmt.Errorf("AWS STS AssumeRole failed with HTTP status %d: %s: %s", resp.StatusCode, stsErr.Code, stsErr.Message)
+		}
+		return aws.Auth{}, time.Time{}, fmt.Errorf("AWS STS AssumeRole failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := xml.Unmarshal(msg, &result); err != nil {
+		return aws.Auth{}, time.Time{}, fmt.Errorf("AWS STS response could not be decoded: %v", err)
+	}
+
+	creds := result.Credentials
+	auth := aws.Auth{AccessKey: creds.AccessKeyID, SecretKey: creds.SecretAccessKey, Token: creds.SessionToken}
+	return auth, creds.Expiration, nil
+}
+
+// signV4 signs req, whose body is body, with AWS Signature Version 4.
+func signV4(req *http.Request, body []byte, auth aws.Auth, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if auth.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", auth.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for _, name := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Security-Token"} {
+		if v := req.Header.Get(name); v != "" {
+			headers[strings.ToLower(name)] = strings.TrimSpace(v)
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders string
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{req.Method, path, query, canonicalHeaders, signedHeaders, hex.EncodeToString(payloadHash[:])}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + auth.SecretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", auth.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,110 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/goamz/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite.
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	auth := aws.Auth{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now, _ := time.Parse("20060102T150405Z", "20150830T123600Z")
+
+	signV4(req, nil, auth, "us-east-1", "service", now)
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func TestNewDNSProviderRoute53RoleEnv(t *testing.T) {
+	defer os.Setenv("AWS_ROLE_ARN", os.Getenv("AWS_ROLE_ARN"))
+	defer os.Setenv("AWS_ROLE_EXTERNAL_ID", os.Getenv("AWS_ROLE_EXTERNAL_ID"))
+	os.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/lego")
+	os.Setenv("AWS_ROLE_EXTERNAL_ID", "ext")
+
+	provider, err := NewDNSProviderRoute53("123", "123", "us-east-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, provider.role) {
+		assert.Equal(t, "arn:aws:iam::123456789012:role/lego", provider.role.roleARN)
+		assert.Equal(t, "ext", provider.role.externalID)
+	}
+}
+
+func TestRoute53AssumeRoleRefresh(t *testing.T) {
+	now := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	defer func() { timeNow = time.Now }()
+	timeNow = func() time.Time { return now }
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRole", r.Form.Get("Action"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/lego", r.Form.Get("RoleArn"))
+		assert.Equal(t, "ext", r.Form.Get("ExternalId"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=base/20160301/us-east-1/sts/aws4_request"))
+		assert.Equal(t, userAgent(), r.Header.Get("User-Agent"))
+
+		calls++
+		fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>temp-%d</AccessKeyId>
+      <SecretAccessKey>secret-%d</SecretAccessKey>
+      <SessionToken>token-%d</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`, calls, calls, calls, now.Add(stsDuration).Format(time.RFC3339))
+	}))
+	defer ts.Close()
+
+	testServer := makeRoute53TestServer()
+	provider := &DNSProviderRoute53{role: &route53Role{
+		auth:       aws.Auth{AccessKey: "base", SecretKey: "secret"},
+		region:     aws.Region{Route53Endpoint: testServer.URL},
+		roleARN:    "arn:aws:iam::123456789012:role/lego",
+		externalID: "ext",
+		baseURL:    ts.URL,
+	}}
+
+	testServer.ResponseMap(3, serverResponseMap)
+	assert.NoError(t, provider.Present("example.com", "", "123456d=="))
+	testServer.WaitRequests(3)
+
+	client, err := provider.getClient()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls, "Expected the credentials to be reused while valid")
+	assert.Equal(t, aws.Auth{AccessKey: "temp-1", SecretKey: "secret-1", Token: "token-1"}, client.Auth)
+
+	// Shortly before they expire the credentials are replaced.
+	now = now.Add(stsDuration - stsRefreshWindow + time.Second)
+	client, err = provider.getClient()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "Expected the credentials to be refreshed")
+	assert.Equal(t, "temp-2", client.Auth.AccessKey)
+}
+
+func TestRoute53AssumeRoleError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>Not authorized to perform sts:AssumeRole</Message></Error></ErrorResponse>`)
+	}))
+	defer ts.Close()
+
+	provider := &DNSProviderRoute53{role: &route53Role{
+		auth:    aws.Auth{AccessKey: "base", SecretKey: "secret"},
+		roleARN: "arn:aws:iam::123456789012:role/lego",
+		baseURL: ts.URL,
+	}}
+
+	err := provider.Present("example.com", "", "123456d==")
+	assert.EqualError(t, err, "AWS STS AssumeRole failed with HTTP status 403: AccessDenied: Not authorized to perform sts:AssumeRole")
+}
@@ -25,6 +25,15 @@ var ChangeResourceRecordSetsAnswer = `<?xml version="1.0" encoding="UTF-8"?>
    </ChangeInfo>
 </ChangeResourceRecordSetsResponse>`
 
+var GetChangeAnswer = `<?xml version="1.0" encoding="UTF-8"?>
+<GetChangeResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
+   <ChangeInfo>
+      <Id>/change/asdf</Id>
+      <Status>INSYNC</Status>
+      <SubmittedAt>2016-02-10T01:36:41.958Z</SubmittedAt>
+   </ChangeInfo>
+</GetChangeResponse>`
+
 var ListHostedZonesAnswer = `<?xml version="1.0" encoding="utf-8"?>
 <ListHostedZonesResponse xmlns="https://route53.amazonaws.com/doc/2013-04-01/">
     <HostedZones>
@@ -54,6 +63,7 @@ var ListHostedZonesAnswer = `<?xml version="1.0" encoding="utf-8"?>
 var serverResponseMap = testutil.ResponseMap{
 	"/2013-04-01/hostedzone/":                      testutil.Response{200, nil, ListHostedZonesAnswer},
 	"/2013-04-01/hostedzone/Z2K123214213123/rrset": testutil.Response{200, nil, ChangeResourceRecordSetsAnswer},
+	"/2013-04-01/change/asdf":                      testutil.Response{200, nil, GetChangeAnswer},
 }
 
 func init() {
@@ -108,11 +118,24 @@ func TestNewDNSProviderRoute53InvalidRegionErr(t *testing.T) {
 	assert.EqualError(t, err, "Invalid AWS region name us-east-3")
 }
 
+func TestNewDNSProviderRoute53RegionEnv(t *testing.T) {
+	region := os.Getenv("AWS_REGION")
+	defer os.Setenv("AWS_REGION", region)
+
+	os.Setenv("AWS_REGION", "us-west-2")
+	_, err := NewDNSProviderRoute53("123", "123", "")
+	assert.NoError(t, err)
+
+	os.Setenv("AWS_REGION", "")
+	_, err = NewDNSProviderRoute53("123", "123", "")
+	assert.EqualError(t, err, "Invalid AWS region name ")
+}
+
 func TestRoute53Present(t *testing.T) {
 	assert := assert.New(t)
 	testServer := makeRoute53TestServer()
 	provider := makeRoute53Provider(testServer)
-	testServer.ResponseMap(2, serverResponseMap)
+	testServer.ResponseMap(3, serverResponseMap)
 
 	domain := "example.com"
 	keyAuth := "123456d=="
@@ -120,10 +143,12 @@ func TestRoute53Present(t *testing.T) {
 	err := provider.Present(domain, "", keyAuth)
 	assert.NoError(err, "Expected Present to return no error")
 
-	httpReqs := testServer.WaitRequests(2)
+	httpReqs := testServer.WaitRequests(3)
 	httpReq := httpReqs[1]
 
 	assert.Equal("/2013-04-01/hostedzone/Z2K123214213123/rrset", httpReq.URL.Path,
 		"Expected Present to select the correct hostedzone")
 
+	assert.Equal("/2013-04-01/change/asdf", httpReqs[2].URL.Path,
+		"Expected Present to wait for the change to be INSYNC")
 }
@@ -1,18 +1,49 @@
 package acme
 
 import (
-	"bufio"
 	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
 )
 
+// startDNSProviderTest serves the SOA of example.com from a local DNS server,
+// which is used as the recursive nameserver, and the DNS provider API with
+// api from an HTTP test server. It returns the URL of the API and a func to
+// stop both servers.
+func startDNSProviderTest(t *testing.T, api http.Handler) (string, func()) {
+	dns.HandleFunc("example.com.", serverHandlerSOA)
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+
+	nss := RecursiveNameservers
+	RecursiveNameservers = []string{addrstr}
+
+	ts := httptest.NewServer(api)
+
+	return ts.URL, func() {
+		ts.Close()
+		RecursiveNameservers = nss
+		server.Shutdown()
+		dns.HandleRemove("example.com.")
+	}
+}
+
 func TestDNSValidServerResponse(t *testing.T) {
-	preCheckDNS = func(domain, fqdn string) bool {
-		return true
+	preCheckDNS = func(fqdn, value string) (bool, error) {
+		return true, nil
 	}
 	privKey, _ := generatePrivateKey(rsakey, 512)
 
@@ -21,19 +52,513 @@ func TestDNSValidServerResponse(t *testing.T) {
 		w.Write([]byte("{\"type\":\"dns01\",\"status\":\"valid\",\"uri\":\"http://some.url\",\"token\":\"http8\"}"))
 	}))
 
-	manualProvider, _ := NewDNSProviderManual()
+	manualProvider, _ := NewDNSProviderManualIO(strings.NewReader("\n"), ioutil.Discard)
 	jws := &jws{privKey: privKey.(*rsa.PrivateKey), directoryURL: ts.URL}
 	solver := &dnsChallenge{jws: jws, validate: validate, provider: manualProvider}
 	clientChallenge := challenge{Type: "dns01", Status: "pending", URI: ts.URL, Token: "http8"}
 
-	go func() {
-		time.Sleep(time.Second * 2)
-		f := bufio.NewWriter(os.Stdout)
-		defer f.Flush()
-		f.WriteString("\n")
-	}()
-
 	if err := solver.Solve(clientChallenge, "example.com"); err != nil {
 		t.Errorf("VALID: Expected Solve to return no error but the error was -> %v", err)
 	}
 }
+
+func TestDNSDisablePropagationCheck(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+	preCheckDNS = func(fqdn, value string) (bool, error) {
+		t.Error("Expected the propagation check to be skipped")
+		return false, errors.New("never propagates")
+	}
+
+	DisablePropagationCheck = true
+	defer func() { DisablePropagationCheck = false }()
+
+	privKey, _ := generatePrivateKey(rsakey, 512)
+	solver := &dnsChallenge{jws: &jws{privKey: privKey.(*rsa.PrivateKey)}, validate: stubValidate, provider: NewMockDNSProvider()}
+
+	done := make(chan error)
+	go func() { done <- solver.Solve(challenge{Type: DNS01, Token: "token"}, "example.com") }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Solve to return no error but the error was -> %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Solve to return without waiting for propagation")
+	}
+}
+
+var findZoneByFqdnTests = []struct {
+	fqdn string
+	zone string
+}{
+	{"example.com.", "example.com."},
+	{"_acme-challenge.example.com.", "example.com."},
+	{"_acme-challenge.www.example.com", "example.com."},
+	{"_acme-challenge.a.b.c.sub.example.com.", "sub.example.com."},
+	{"sub.example.com.", "sub.example.com."},
+}
+
+func TestFindZoneByFqdn(t *testing.T) {
+	dns.HandleFunc("example.com.", serverHandlerSOA)
+	defer dns.HandleRemove("example.com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	for _, tt := range findZoneByFqdnTests {
+		zone, err := findZoneByFqdn(dns.Fqdn(tt.fqdn), []string{addrstr})
+		if err != nil {
+			t.Errorf("findZoneByFqdn(%q) returned error: %v", tt.fqdn, err)
+			continue
+		}
+		if zone != tt.zone {
+			t.Errorf("findZoneByFqdn(%q): got %q, want %q", tt.fqdn, zone, tt.zone)
+		}
+	}
+
+	if zone, err := findZoneByFqdn("example.org.", []string{addrstr}); err == nil {
+		t.Errorf("findZoneByFqdn(%q): expected an error but got zone %q", "example.org.", zone)
+	}
+}
+
+func TestZoneCacheLimit(t *testing.T) {
+	zoneCache := newApexCache()
+	for i := 0; i < maxZoneCacheEntries; i++ {
+		zoneCache.set(fmt.Sprintf("%d.example.com.", i), nil, false, 300)
+	}
+	zoneCache.set("example.com.", nil, true, 300)
+
+	if n := len(zoneCache.entries); n != 1 {
+		t.Errorf("Expected the full cache to start over, got %d entries", n)
+	}
+	if apex, ok := zoneCache.get("example.com.", nil); !apex || !ok {
+		t.Errorf("Expected example.com. to be cached as apex, got %v, %v", apex, ok)
+	}
+}
+
+func TestWaitForPropagation(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+
+	calls := 0
+	preCheckDNS = func(fqdn, value string) (bool, error) {
+		calls++
+		if calls < 3 {
+			return false, errors.New("not yet")
+		}
+		return true, nil
+	}
+	if err := WaitForPropagation("_acme-challenge.example.com.", "value", time.Second, time.Millisecond); err != nil {
+		t.Errorf("Expected WaitForPropagation to return no error but the error was -> %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected the record to be checked 3 times but it was checked %d times", calls)
+	}
+
+	preCheckDNS = func(fqdn, value string) (bool, error) {
+		return false, errors.New("not yet")
+	}
+	err := WaitForPropagation("_acme-challenge.example.com.", "value", 10*time.Millisecond, time.Millisecond)
+	if err == nil || err.Error() != "Time limit exceeded. Last error: not yet" {
+		t.Errorf("Expected WaitForPropagation to time out but the error was -> %v", err)
+	}
+}
+
+func TestCheckAuthoritativeNss(t *testing.T) {
+	dns.HandleFunc("example.com.", serverHandlerSOA)
+	defer dns.HandleRemove("example.com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	ok, err := checkAuthoritativeNss("_acme-challenge.example.com.", "expected", []string{addrstr})
+	if !ok || err != nil {
+		t.Errorf("Expected the TXT record to be found but got %v, %v", ok, err)
+	}
+
+	ok, err = checkAuthoritativeNss("_acme-challenge.example.com.", "other", []string{addrstr})
+	if ok || err == nil {
+		t.Errorf("Expected a mismatching TXT record to be reported but got %v, %v", ok, err)
+	}
+
+	ok, err = checkAuthoritativeNss("_acme-challenge.www.example.com.", "expected", []string{addrstr})
+	if ok || err == nil {
+		t.Errorf("Expected a missing TXT record to be reported but got %v, %v", ok, err)
+	}
+}
+
+func TestLookupNameservers(t *testing.T) {
+	dns.HandleFunc("example.com.", serverHandlerSOA)
+	defer dns.HandleRemove("example.com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	defer func(nss []string) { RecursiveNameservers = nss }(RecursiveNameservers)
+	RecursiveNameservers = []string{addrstr}
+
+	nss, err := lookupNameservers("_acme-challenge.www.sub.example.com.")
+	if err != nil {
+		t.Fatalf("Expected lookupNameservers to return no error but the error was -> %v", err)
+	}
+	if len(nss) != 1 || nss[0] != "ns1.sub.example.com.:53" {
+		t.Errorf("Expected nameservers [ns1.sub.example.com.:53] but got %v", nss)
+	}
+}
+
+func TestDNS01RecordFollowCNAME(t *testing.T) {
+	dns.HandleFunc("example.com.", serverHandlerCNAME)
+	defer dns.HandleRemove("example.com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	defer func(nss []string) { RecursiveNameservers = nss }(RecursiveNameservers)
+	RecursiveNameservers = []string{addrstr}
+
+	fqdn, _, _ := DNS01Record("www.example.com", "123d==")
+	if fqdn != "_acme-challenge.www.example.com." {
+		t.Errorf("Expected CNAME records to be ignored by default but got fqdn %s", fqdn)
+	}
+
+	FollowCNAME = true
+	defer func() { FollowCNAME = false }()
+
+	fqdn, _, _ = DNS01Record("www.example.com", "123d==")
+	if fqdn != "www.validation.example.com." {
+		t.Errorf("Expected fqdn www.validation.example.com. but got %s", fqdn)
+	}
+
+	fqdn, _, _ = DNS01Record("example.com", "123d==")
+	if fqdn != "_acme-challenge.example.com." {
+		t.Errorf("Expected fqdn without CNAME to stay unchanged but got %s", fqdn)
+	}
+}
+
+func TestSetDNSResolvers(t *testing.T) {
+	defer SetDNSResolvers(nil)
+
+	SetDNSResolvers([]string{"10.0.0.1", "10.0.0.2:5353", "::1"})
+	expected := []string{"10.0.0.1:53", "10.0.0.2:5353", "[::1]:53"}
+	if len(RecursiveNameservers) != len(expected) {
+		t.Fatalf("Expected resolvers %v but got %v", expected, RecursiveNameservers)
+	}
+	for i := range expected {
+		if RecursiveNameservers[i] != expected[i] {
+			t.Errorf("Expected resolvers %v but got %v", expected, RecursiveNameservers)
+		}
+	}
+
+	SetDNSResolvers(nil)
+	if len(RecursiveNameservers) != len(defaultNameservers) || RecursiveNameservers[0] != defaultNameservers[0] {
+		t.Errorf("Expected the default resolvers to be restored but got %v", RecursiveNameservers)
+	}
+}
+
+func TestSetDNSResolversUsedForZoneLookup(t *testing.T) {
+	queried := make(chan string, 10)
+	dns.HandleFunc("example.com.", func(w dns.ResponseWriter, req *dns.Msg) {
+		queried <- req.Question[0].Name
+		serverHandlerSOA(w, req)
+	})
+	defer dns.HandleRemove("example.com.")
+
+	server, addrstr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer server.Shutdown()
+
+	SetDNSResolvers([]string{addrstr})
+	defer SetDNSResolvers(nil)
+
+	nss, err := lookupNameservers("_acme-challenge.example.com.")
+	if err != nil {
+		t.Fatalf("Expected lookupNameservers to return no error but the error was -> %v", err)
+	}
+	if len(nss) != 1 || nss[0] != "ns1.example.com.:53" {
+		t.Errorf("Expected nameservers [ns1.example.com.:53] but got %v", nss)
+	}
+	if len(queried) == 0 {
+		t.Errorf("Expected the custom resolver to be queried")
+	}
+}
+
+// serverHandlerCNAME delegates _acme-challenge.www.example.com. through a
+// chain of two CNAME records.
+func serverHandlerCNAME(w dns.ResponseWriter, req *dns.Msg) {
+	chain := map[string]string{
+		"_acme-challenge.www.example.com.": "www.acme.example.com.",
+		"www.acme.example.com.":            "www.validation.example.com.",
+	}
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+	name := req.Question[0].Name
+	if target, ok := chain[name]; ok {
+		m.Answer = []dns.RR{&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+			Target: target,
+		}}
+	}
+	w.WriteMsg(m)
+}
+
+func TestCheckRecursiveNssWaitsForStaleResolver(t *testing.T) {
+	var staleAddr atomic.Value
+	var updated int32
+	dns.HandleFunc("example.com.", func(w dns.ResponseWriter, req *dns.Msg) {
+		value := "expected"
+		if w.LocalAddr().String() == staleAddr.Load() && atomic.LoadInt32(&updated) == 0 {
+			value = "old"
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+			Txt: []string{value},
+		}}
+		w.WriteMsg(m)
+	})
+	defer dns.HandleRemove("example.com.")
+
+	fresh, freshAddr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer fresh.Shutdown()
+
+	stale, addr, err := runLocalDNSTestServer("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	defer stale.Shutdown()
+	staleAddr.Store(addr)
+
+	resolvers := []string{freshAddr, addr}
+	fqdn := "_acme-challenge.example.com."
+
+	found, err := checkRecursiveNss(fqdn, "expected", resolvers)
+	if found || err == nil {
+		t.Errorf("checkRecursiveNss: got %v, %v; want not found while one resolver is stale", found, err)
+	}
+
+	polls := 0
+	err = waitFor(time.Second, 10*time.Millisecond, func() (bool, error) {
+		polls++
+		if polls == 3 {
+			atomic.StoreInt32(&updated, 1)
+		}
+		return checkRecursiveNss(fqdn, "expected", resolvers)
+	})
+	if err != nil {
+		t.Fatalf("waitFor: %v", err)
+	}
+	if polls < 3 {
+		t.Errorf("Expected to keep waiting until the stale resolver was updated, returned after %d polls", polls)
+	}
+}
+
+func TestClampTTL(t *testing.T) {
+	if ttl := clampTTL(5, 30, "test"); ttl != 30 {
+		t.Errorf("clampTTL: got %d, want the floor of 30", ttl)
+	}
+	if ttl := clampTTL(3600, 30, "test"); ttl != 3600 {
+		t.Errorf("clampTTL: got %d, want 3600 unchanged", ttl)
+	}
+}
+
+func TestDeleteWithRelist(t *testing.T) {
+	errGone := errors.New("gone")
+	records := map[string]bool{"recreated": true}
+	var deleted []string
+	find := func() (string, error) {
+		for id := range records {
+			return id, nil
+		}
+		return "", errors.New("not found")
+	}
+	del := func(id string) error {
+		if !records[id] {
+			return errGone
+		}
+		delete(records, id)
+		deleted = append(deleted, id)
+		return nil
+	}
+
+	// The stored id is gone, the record was recreated under a new id.
+	if err := deleteWithRelist(find, del, "stored", true); err != nil {
+		t.Errorf("deleteWithRelist error: got %v, want nil", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "recreated" {
+		t.Errorf("Expected the recreated record to be deleted, got %v", deleted)
+	}
+
+	// Nothing is left to find, so the error of the delete is returned.
+	if err := deleteWithRelist(find, del, "stored", true); err != errGone {
+		t.Errorf("deleteWithRelist error: got %v, want %v", err, errGone)
+	}
+
+	// Without a stored id, the record is looked up.
+	records["other"] = true
+	if err := deleteWithRelist(find, del, "", false); err != nil {
+		t.Errorf("deleteWithRelist error: got %v, want nil", err)
+	}
+	if len(deleted) != 2 || deleted[1] != "other" {
+		t.Errorf("Expected the looked up record to be deleted, got %v", deleted)
+	}
+	if err := deleteWithRelist(find, del, "", false); err == nil || err.Error() != "not found" {
+		t.Errorf("deleteWithRelist error: got %v, want not found", err)
+	}
+}
+
+func TestToASCIIFqdn(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"_acme-challenge.münchen.de.", "_acme-challenge.xn--mnchen-3ya.de."},
+		{"_acme-challenge.xn--mnchen-3ya.de.", "_acme-challenge.xn--mnchen-3ya.de."},
+		{"www.example.com", "www.example.com"},
+	}
+	for _, tt := range tests {
+		got, err := toASCIIFqdn(tt.in)
+		if err != nil {
+			t.Errorf("toASCIIFqdn(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("toASCIIFqdn(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := toASCIIFqdn("www..example.com"); err == nil {
+		t.Error("Expected an error for an empty label")
+	}
+	if _, err := toASCIIFqdn(strings.Repeat("a", 64) + ".example.com"); err == nil {
+		t.Error("Expected an error for a label longer than 63 characters")
+	}
+}
+
+func TestDNS01RecordUnicodeDomain(t *testing.T) {
+	fqdn, _, _ := DNS01Record("münchen.de", "123d==")
+	if fqdn != "_acme-challenge.xn--mnchen-3ya.de." {
+		t.Errorf("DNS01Record: got fqdn %q, want the punycode form", fqdn)
+	}
+}
+
+func TestSplitTXTValue(t *testing.T) {
+	tests := []struct {
+		length int
+		chunks []int
+	}{
+		{43, []int{43}},
+		{255, []int{255}},
+		{256, []int{255, 1}},
+		{600, []int{255, 255, 90}},
+	}
+	for _, tt := range tests {
+		value := strings.Repeat("a", tt.length)
+		chunks := splitTXTValue(value)
+
+		var lengths []int
+		for _, c := range chunks {
+			lengths = append(lengths, len(c))
+		}
+		if fmt.Sprint(lengths) != fmt.Sprint(tt.chunks) {
+			t.Errorf("splitTXTValue(%d bytes): got chunks of %v, want %v", tt.length, lengths, tt.chunks)
+		}
+		if strings.Join(chunks, "") != value {
+			t.Errorf("splitTXTValue(%d bytes): chunks do not join to the original value", tt.length)
+		}
+	}
+}
+
+func TestWaitForPropagationContextCancel(t *testing.T) {
+	defer func() { preCheckDNS = checkDNSPropagation }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	preCheckDNS = func(fqdn, value string) (bool, error) {
+		calls++
+		if calls == 1 {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+		}
+		return false, errors.New("not yet")
+	}
+
+	start := time.Now()
+	err := WaitForPropagationContext(ctx, "_acme-challenge.example.com.", "value")
+	if calls != 1 {
+		t.Errorf("Expected the check to run once before the cancellation but it ran %d times", calls)
+	}
+	if err != context.Canceled {
+		t.Errorf("Expected WaitForPropagationContext to return context.Canceled but the error was -> %v", err)
+	}
+	// The default poll interval is two seconds; cancelling must not wait for it.
+	if elapsed := time.Since(start); elapsed > propagationInterval/2 {
+		t.Errorf("Expected a prompt return after cancellation but took %v", elapsed)
+	}
+}
+
+// serverHandlerSOA answers like an authoritative server for the zones
+// example.com. and sub.example.com. Dynamic updates are accepted and
+// _acme-challenge.example.com. has the TXT record "expected".
+func serverHandlerSOA(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	if req.Opcode == dns.OpcodeUpdate {
+		w.WriteMsg(m)
+		return
+	}
+
+	name := req.Question[0].Name
+	zone := "example.com."
+	if dns.IsSubDomain("sub.example.com.", name) {
+		zone = "sub.example.com."
+	}
+
+	soa := &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Ns:      "ns1." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  300,
+	}
+
+	switch {
+	case name == zone && req.Question[0].Qtype == dns.TypeSOA:
+		m.Answer = []dns.RR{soa}
+	case name == zone && req.Question[0].Qtype == dns.TypeNS:
+		m.Answer = []dns.RR{&dns.NS{
+			Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+			Ns:  soa.Ns,
+		}}
+	case name == "_acme-challenge.example.com." && req.Question[0].Qtype == dns.TypeTXT:
+		m.Answer = []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 120},
+			Txt: []string{"expected"},
+		}}
+	default:
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{soa}
+	}
+	w.WriteMsg(m)
+}
@@ -0,0 +1,221 @@
+package acme
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const vultrAPIURL = "https://api.vultr.com/v2"
+
+// DNSProviderVultr is an implementation of the ChallengeProvider interface
+// that uses Vultr's v2 API to manage TXT records. It implements
+// PrecheckDNSProvider.
+type DNSProviderVultr struct {
+	apiKey  string
+	baseURL string
+
+	mu        sync.Mutex
+	recordIDs map[string]string
+}
+
+// NewDNSProviderVultr returns a DNSProviderVultr instance with a configured Vultr client.
+// Authentication is either done using the passed API key or - when empty - using the environment
+// variable VULTR_API_KEY.
+func NewDNSProviderVultr(apiKey string) (*DNSProviderVultr, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("VULTR_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("Vultr credentials missing")
+		}
+	}
+
+	return &DNSProviderVultr{
+		apiKey:    apiKey,
+		baseURL:   vultrAPIURL,
+		recordIDs: make(map[string]string),
+	}, nil
+}
+
+// Present creates a TXT record to fulfil the dns-01 challenge
+func (v *DNSProviderVultr) Present(domain, token, keyAuth string) error {
+	fqdn, value, ttl := DNS01Record(domain, keyAuth)
+	zone, name, err := v.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(vultrRecord{Name: name, Type: "TXT", Data: fmt.Sprintf("%q", value), TTL: ttl})
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.doRequest("POST", fmt.Sprintf("%s/domains/%s/records", v.baseURL, zone), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	var created struct {
+		Record vultrRecord `json:"record"`
+	}
+	if err := json.Unmarshal(resp, &created); err != nil {
+		return fmt.Errorf("Vultr API response could not be decoded: %v", err)
+	}
+
+	v.mu.Lock()
+	v.recordIDs[fqdn+value] = created.Record.ID
+	v.mu.Unlock()
+
+	return nil
+}
+
+// CleanUp removes the TXT record matching the specified parameters
+func (v *DNSProviderVultr) CleanUp(domain, token, keyAuth string) error {
+	fqdn, value, _ := DNS01Record(domain, keyAuth)
+	zone, name, err := v.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	id, ok := v.recordIDs[fqdn+value]
+	v.mu.Unlock()
+
+	err = deleteWithRelist(func() (string, error) {
+		return v.findRecordID(zone, name, value)
+	}, func(id string) error {
+		return v.deleteRecord(zone, id)
+	}, id, ok)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	delete(v.recordIDs, fqdn+value)
+	v.mu.Unlock()
+
+	return nil
+}
+
+// Precheck verifies the API key by fetching the account it belongs to.
+func (v *DNSProviderVultr) Precheck() error {
+	_, err := v.doRequest("GET", v.baseURL+"/account", nil)
+	return err
+}
+
+func (v *DNSProviderVultr) deleteRecord(zone, id string) error {
+	_, err := v.doRequest("DELETE", fmt.Sprintf("%s/domains/%s/records/%s", v.baseURL, zone, id), nil)
+	return err
+}
+
+// findRecordID pages through the records of zone and returns the id of the
+// TXT record name with the given value.
+func (v *DNSProviderVultr) findRecordID(zone, name, value string) (string, error) {
+	var cursor string
+	for {
+		query := url.Values{"per_page": {"100"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		resp, err := v.doRequest("GET", fmt.Sprintf("%s/domains/%s/records?%s", v.baseURL, zone, query.Encode()), nil)
+		if err != nil {
+			return "", err
+		}
+
+		var page struct {
+			Records []vultrRecord `json:"records"`
+			Meta    struct {
+				Links struct {
+					Next string `json:"next"`
+				} `json:"links"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(resp, &page); err != nil {
+			return "", fmt.Errorf("Vultr API response could not be decoded: %v", err)
+		}
+
+		for _, rec := range page.Records {
+			if rec.Type == "TXT" && rec.Name == name && strings.Trim(rec.Data, `"`) == value {
+				return rec.ID, nil
+			}
+		}
+
+		if page.Meta.Links.Next == "" {
+			return "", fmt.Errorf("Vultr TXT record %s.%s not found", name, zone)
+		}
+		cursor = page.Meta.Links.Next
+	}
+}
+
+// splitFqdn returns the zone of fqdn and the record name relative to that
+// zone, which is empty for the zone apex.
+func (v *DNSProviderVultr) splitFqdn(fqdn string) (zone, name string, err error) {
+	zone, err = findZoneByFqdn(fqdn, RecursiveNameservers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name = strings.TrimSuffix(fqdn, "."+zone)
+	if name == fqdn {
+		name = ""
+	}
+
+	return unFqdn(zone), name, nil
+}
+
+type vultrRecord struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+var errVultrNotFound = fmt.Errorf("Vultr API call failed with HTTP status %d", http.StatusNotFound)
+
+func (v *DNSProviderVultr) doRequest(method, uri string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+v.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpDo(providerHTTPClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("Vultr API call failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	msg, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("Vultr API call failed: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errVultrNotFound
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		detail := strings.TrimSpace(string(msg))
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Error != "" {
+			detail = apiErr.Error
+		}
+		return nil, &DNSProviderAuthError{Provider: "Vultr", StatusCode: resp.StatusCode, Detail: detail}
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Vultr API call failed with HTTP status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,155 @@
+package acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var vultrAPIKeyEnv = os.Getenv("VULTR_API_KEY")
+
+func restoreVultrEnv() {
+	os.Setenv("VULTR_API_KEY", vultrAPIKeyEnv)
+}
+
+func TestNewDNSProviderVultrMissingCredErr(t *testing.T) {
+	os.Setenv("VULTR_API_KEY", "")
+	_, err := NewDNSProviderVultr("")
+	assert.EqualError(t, err, "Vultr credentials missing")
+	restoreVultrEnv()
+}
+
+func TestNewDNSProviderVultrValidEnv(t *testing.T) {
+	os.Setenv("VULTR_API_KEY", "123")
+	_, err := NewDNSProviderVultr("")
+	assert.NoError(t, err)
+	restoreVultrEnv()
+}
+
+// fakeVultr serves the records of example.com two per page.
+type fakeVultr struct {
+	t       *testing.T
+	records []vultrRecord
+	deleted []string
+}
+
+func (f *fakeVultr) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer 123" {
+		http.Error(w, `{"error": "Invalid API token."}`, http.StatusUnauthorized)
+		return
+	}
+
+	const records = "/domains/example.com/records"
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/account":
+		writeJSONResponse(w, map[string]interface{}{"account": map[string]string{"email": "user@example.com"}})
+	case r.Method == "POST" && r.URL.Path == records:
+		var rec vultrRecord
+		assert.NoError(f.t, json.NewDecoder(r.Body).Decode(&rec))
+		rec.ID = fmt.Sprintf("id-%d", len(f.records))
+		f.records = append(f.records, rec)
+		w.WriteHeader(http.StatusCreated)
+		writeJSONResponse(w, map[string]vultrRecord{"record": rec})
+	case r.Method == "GET" && r.URL.Path == records:
+		start := 0
+		fmt.Sscanf(r.URL.Query().Get("cursor"), "page-%d", &start)
+		end := start + 2
+		next := fmt.Sprintf("page-%d", end)
+		if end >= len(f.records) {
+			end, next = len(f.records), ""
+		}
+		page := map[string]interface{}{"records": f.records[start:end]}
+		page["meta"] = map[string]interface{}{"total": len(f.records), "links": map[string]string{"next": next, "prev": ""}}
+		writeJSONResponse(w, page)
+	case r.Method == "DELETE":
+		for i, rec := range f.records {
+			if r.URL.Path == records+"/"+rec.ID {
+				f.records = append(f.records[:i], f.records[i+1:]...)
+				f.deleted = append(f.deleted, r.URL.Path)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		http.Error(w, `{"error": "Record not found"}`, http.StatusNotFound)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startVultrTest(t *testing.T) (*DNSProviderVultr, *fakeVultr, func()) {
+	fake := &fakeVultr{t: t}
+	apiURL, done := startDNSProviderTest(t, fake)
+
+	provider, err := NewDNSProviderVultr("123")
+	assert.NoError(t, err)
+	provider.baseURL = apiURL
+
+	return provider, fake, done
+}
+
+func TestVultrPresentAndCleanUp(t *testing.T) {
+	provider, fake, done := startVultrTest(t)
+	defer done()
+
+	_, value, ttl := DNS01Record("www.example.com", "123d==")
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+	if assert.Len(t, fake.records, 1) {
+		assert.Equal(t, vultrRecord{ID: "id-0", Type: "TXT", Name: "_acme-challenge.www", Data: `"` + value + `"`, TTL: ttl}, fake.records[0])
+	}
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"/domains/example.com/records/id-0"}, fake.deleted)
+}
+
+func TestVultrCleanUpLooksUpRecordAcrossPages(t *testing.T) {
+	provider, fake, done := startVultrTest(t)
+	defer done()
+
+	_, value, _ := DNS01Record("www.example.com", "123d==")
+	fake.records = []vultrRecord{
+		{ID: "a", Type: "A", Name: "", Data: "10.0.0.1"},
+		{ID: "b", Type: "TXT", Name: "", Data: `"v=spf1 -all"`},
+		{ID: "c", Type: "TXT", Name: "_acme-challenge.www", Data: `"other"`},
+		{ID: "d", Type: "TXT", Name: "_acme-challenge.www", Data: `"` + value + `"`},
+	}
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"/domains/example.com/records/d"}, fake.deleted)
+
+	err := provider.CleanUp("other.example.com", "", "123d==")
+	assert.EqualError(t, err, "Vultr TXT record _acme-challenge.other.example.com not found")
+}
+
+func TestVultrCleanUpStaleRecordID(t *testing.T) {
+	provider, fake, done := startVultrTest(t)
+	defer done()
+
+	assert.NoError(t, provider.Present("www.example.com", "", "123d=="))
+
+	// Simulate the record being deleted and recreated under a new id.
+	fake.records[0].ID = "recreated"
+
+	assert.NoError(t, provider.CleanUp("www.example.com", "", "123d=="))
+	assert.Equal(t, []string{"/domains/example.com/records/recreated"}, fake.deleted)
+	assert.Empty(t, fake.records)
+}
+
+func TestVultrPrecheck(t *testing.T) {
+	provider, _, done := startVultrTest(t)
+	defer done()
+
+	var _ PrecheckDNSProvider = provider
+	assert.NoError(t, provider.Precheck())
+
+	provider.apiKey = "wrong"
+	err := provider.Precheck()
+	if authErr, ok := err.(*DNSProviderAuthError); assert.True(t, ok, "expected a *DNSProviderAuthError, got %v", err) {
+		assert.Equal(t, &DNSProviderAuthError{Provider: "Vultr", StatusCode: http.StatusUnauthorized, Detail: "Invalid API token."}, authErr)
+	}
+	assert.EqualError(t, err, "Vultr API rejected the credentials with HTTP status 401: Invalid API token.")
+}
@@ -3,6 +3,7 @@ package acme
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strings"
 )
@@ -29,6 +30,17 @@ type TOSError struct {
 	RemoteError
 }
 
+// directoryError is returned by NewClient if the directory could not be
+// fetched. It keeps the cause, so that callers can tell why.
+type directoryError struct {
+	url string
+	err error
+}
+
+func (e directoryError) Error() string {
+	return fmt.Sprintf("get directory at '%s': %v", e.url, e.err)
+}
+
 type domainError struct {
 	Domain string
 	Error  error
@@ -51,13 +63,18 @@ func (c challengeError) Error() string {
 }
 
 func handleHTTPError(resp *http.Response) error {
-	var errorDetail RemoteError
-	decoder := json.NewDecoder(resp.Body)
-	err := decoder.Decode(&errorDetail)
+	body, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
 	if err != nil {
 		return err
 	}
 
+	var errorDetail RemoteError
+	if err := json.Unmarshal(body, &errorDetail); err != nil {
+		// Not a problem document, e.g. the error page of a proxy in front of
+		// the CA. Keep the status so that callers can still act on it.
+		errorDetail = RemoteError{Detail: strings.TrimSpace(string(body))}
+	}
+
 	errorDetail.StatusCode = resp.StatusCode
 
 	// Check for errors we handle specifically
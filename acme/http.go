@@ -1,76 +1,149 @@
 package acme
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"runtime"
 	"strings"
+	"time"
 )
 
 // UserAgent, if non-empty, will be tacked onto the User-Agent string in requests.
 var UserAgent string
 
-const (
-	// defaultGoUserAgent is the Go HTTP package user agent string. Too
-	// bad it isn't exported. If it changes, we should update it here, too.
-	defaultGoUserAgent = "Go-http-client/1.1"
+// userAgentComments are appended to the User-Agent string after UserAgent.
+var userAgentComments []string
 
-	// ourUserAgent is the User-Agent of this underlying library package.
-	ourUserAgent = "xenolf-acme"
-)
+// SetUserAgent sets the product identifier, e.g. "myapp/1.0", which is tacked
+// onto the User-Agent string of all requests to the ACME server and the DNS
+// provider APIs, after the identifier of lego. It is the same as setting
+// UserAgent.
+func SetUserAgent(ua string) {
+	UserAgent = ua
+}
+
+// AddUserAgentComment appends comment, in parentheses, to the User-Agent
+// string, so that embedding applications can add contact information like
+// "+https://example.com/bot".
+func AddUserAgentComment(comment string) {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return
+	}
+	userAgentComments = append(userAgentComments, "("+comment+")")
+}
+
+// Version is the version of lego named in the User-Agent string of all
+// requests. The lego command sets it to the tag it was built from.
+var Version = "0.2.0"
+
+// ourUserAgentComment follows lego/<Version> in the User-Agent string.
+const ourUserAgentComment = "(+https://github.com/saltsa/lego)"
+
+// providerHTTPClient sends all requests to DNS provider APIs.
+var providerHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// withTLSConfig returns a copy of client whose transport has the TLS
+// settings applied by update. The transport of client is cloned if it is an
+// *http.Transport, otherwise that of http.DefaultTransport is.
+func withTLSConfig(client *http.Client, update func(*tls.Config)) *http.Client {
+	base, ok := client.Transport.(*http.Transport)
+	if !ok {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	transport := base.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	update(transport.TLSClientConfig)
+
+	c := *client
+	c.Transport = transport
+	return &c
+}
+
+// httpDo sends req with client and a proper User-Agent string.
+func httpDo(client *http.Client, req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", userAgent())
+
+	waitRateLimit()
+	return client.Do(req)
+}
 
 // httpHead performs a HEAD request with a proper User-Agent string.
 // The response body (resp.Body) is already closed when this function returns.
 func httpHead(url string) (resp *http.Response, err error) {
+	return httpHeadWith(&http.Client{}, url)
+}
+
+func httpHeadWith(client *http.Client, url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", userAgent())
-
-	client := http.Client{}
-	resp, err = client.Do(req)
-	if resp.Body != nil {
-		resp.Body.Close()
+	resp, err = httpDo(client, req)
+	if err != nil {
+		return nil, err
 	}
-	return resp, err
+	resp.Body.Close()
+	return resp, nil
 }
 
 // httpPost performs a POST request with a proper User-Agent string.
 // Callers should close resp.Body when done reading from it.
 func httpPost(url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
+	return httpPostWith(&http.Client{}, url, bodyType, body)
+}
+
+func httpPostWith(client *http.Client, url string, bodyType string, body io.Reader) (resp *http.Response, err error) {
 	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", bodyType)
-	req.Header.Set("User-Agent", userAgent())
 
-	client := http.Client{}
-	return client.Do(req)
+	return httpDo(client, req)
 }
 
 // httpGet performs a GET request with a proper User-Agent string.
 // Callers should close resp.Body when done reading from it.
 func httpGet(url string) (resp *http.Response, err error) {
+	return httpGetWith(&http.Client{}, url)
+}
+
+func httpGetWith(client *http.Client, url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", userAgent())
 
-	client := http.Client{}
-	return client.Do(req)
+	return httpDo(client, req)
 }
 
-// getJSON performs an HTTP GET request and parses the response body
-// as JSON, into the provided respBody object.
-func getJSON(uri string, respBody interface{}) (http.Header, error) {
-	resp, err := httpGet(uri)
+// getJSON performs an HTTP GET request to an ACME server with client and
+// parses the response body as JSON, into the provided respBody object.
+func getJSON(client *http.Client, uri string, respBody interface{}) (http.Header, error) {
+	resp, err := httpGetWith(client, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %q: %v", uri, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp.Header, handleHTTPError(resp)
+	}
+
+	return resp.Header, json.NewDecoder(resp.Body).Decode(respBody)
+}
+
+// fetchJSON works like getJSON, but fetches the resource through j so that
+// POST-as-GET is used when the server requires it.
+func fetchJSON(j *jws, uri string, respBody interface{}) (http.Header, error) {
+	resp, err := j.get(uri)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get %q: %v", uri, err)
 	}
@@ -110,6 +183,6 @@ func postJSON(j *jws, uri string, reqBody, respBody interface{}) (http.Header, e
 
 // userAgent builds and returns the User-Agent string to use in requests.
 func userAgent() string {
-	ua := fmt.Sprintf("%s (%s; %s) %s %s", defaultGoUserAgent, runtime.GOOS, runtime.GOARCH, ourUserAgent, UserAgent)
-	return strings.TrimSpace(ua)
+	ua := fmt.Sprintf("lego/%s %s %s %s", Version, ourUserAgentComment, UserAgent, strings.Join(userAgentComments, " "))
+	return strings.Join(strings.Fields(ua), " ")
 }
@@ -21,13 +21,13 @@ func (s *httpChallenge) Solve(chlng challenge, domain string) error {
 	logf("[INFO][%s] acme: Trying to solve HTTP-01", domain)
 
 	// Generate the Key Authorization for the challenge
-	keyAuth, err := getKeyAuthorization(chlng.Token, &s.jws.privKey.PublicKey)
+	keyAuth, err := getKeyAuthorization(chlng.Token, &s.jws.key().PublicKey)
 	if err != nil {
 		return err
 	}
 
 	if s.provider == nil {
-		s.provider = &httpChallengeServer{}
+		s.provider = NewHTTPProviderServer("", "")
 	}
 
 	err = s.provider.Present(domain, chlng.Token, keyAuth)
@@ -3,6 +3,8 @@ package acme
 import (
 	"crypto/rsa"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"strings"
 	"testing"
 )
@@ -35,7 +37,7 @@ func TestHTTPChallenge(t *testing.T) {
 
 		return nil
 	}
-	solver := &httpChallenge{jws: j, validate: mockValidate, provider: &httpChallengeServer{port: "23457"}}
+	solver := &httpChallenge{jws: j, validate: mockValidate, provider: &HTTPProviderServer{port: "23457"}}
 
 	if err := solver.Solve(clientChallenge, "localhost:23457"); err != nil {
 		t.Errorf("Solve error: got %v, want nil", err)
@@ -46,7 +48,7 @@ func TestHTTPChallengeInvalidPort(t *testing.T) {
 	privKey, _ := generatePrivateKey(rsakey, 128)
 	j := &jws{privKey: privKey.(*rsa.PrivateKey)}
 	clientChallenge := challenge{Type: HTTP01, Token: "http2"}
-	solver := &httpChallenge{jws: j, validate: stubValidate, provider: &httpChallengeServer{port: "123456"}}
+	solver := &httpChallenge{jws: j, validate: stubValidate, provider: &HTTPProviderServer{port: "123456"}}
 
 	if err := solver.Solve(clientChallenge, "localhost:123456"); err == nil {
 		t.Errorf("Solve error: got %v, want error", err)
@@ -54,3 +56,65 @@ func TestHTTPChallengeInvalidPort(t *testing.T) {
 		t.Errorf("Solve error: got %q, want suffix %q", err.Error(), want)
 	}
 }
+
+func TestHTTPProviderServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	addr := listener.Addr().String()
+
+	provider := NewHTTPProviderServer("127.0.0.1", "0")
+	provider.listener = listener
+	if err := provider.Present(addr, "token", "keyAuth"); err != nil {
+		t.Fatalf("Present error: got %v, want nil", err)
+	}
+	defer provider.CleanUp(addr, "token", "keyAuth")
+
+	resp, err := httpGet("http://" + addr + HTTP01ChallengePath("token"))
+	if err != nil {
+		t.Fatalf("Get error: got %v, want nil", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Get status: got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if want := "text/plain"; resp.Header.Get("Content-Type") != want {
+		t.Errorf("Get Content-Type: got %q, want %q", resp.Header.Get("Content-Type"), want)
+	}
+	if string(body) != "keyAuth" {
+		t.Errorf("Get body: got %q, want %q", string(body), "keyAuth")
+	}
+
+	resp, err = httpGet("http://" + addr + HTTP01ChallengePath("unknown"))
+	if err != nil {
+		t.Fatalf("Get error: got %v, want nil", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Get status for unknown token: got %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestHTTPProviderServerCleanUpStopsServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	addr := listener.Addr().String()
+
+	provider := NewHTTPProviderServer("", "")
+	provider.listener = listener
+	if err := provider.Present(addr, "token", "keyAuth"); err != nil {
+		t.Fatalf("Present error: got %v, want nil", err)
+	}
+	if err := provider.CleanUp(addr, "token", "keyAuth"); err != nil {
+		t.Fatalf("CleanUp error: got %v, want nil", err)
+	}
+
+	if _, err := httpGet("http://" + addr + HTTP01ChallengePath("token")); err == nil {
+		t.Errorf("Get error: got nil, want connection error after CleanUp")
+	}
+}
@@ -0,0 +1,74 @@
+package acme
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// HTTPProviderWebroot implements ChallengeProvider for `http-01` challenge.
+// It writes the key authorization into the webroot of an existing webserver.
+type HTTPProviderWebroot struct {
+	path string
+
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+// NewHTTPProviderWebroot returns a HTTPProviderWebroot instance configured to
+// put challenge files into '<path>/.well-known/acme-challenge/'. Pass it to
+// Client.SetChallengeProvider for the HTTP01 challenge.
+func NewHTTPProviderWebroot(path string) (*HTTPProviderWebroot, error) {
+	if path == "" {
+		return nil, fmt.Errorf("Webroot path missing")
+	}
+
+	return &HTTPProviderWebroot{path: path, created: make(map[string]bool)}, nil
+}
+
+// Present makes the token available at `HTTP01ChallengePath(token)` by creating a file in the webroot
+func (w *HTTPProviderWebroot) Present(domain, token, keyAuth string) error {
+	challengeFile := filepath.Join(w.path, filepath.FromSlash(HTTP01ChallengePath(token)))
+
+	err := os.MkdirAll(filepath.Dir(challengeFile), 0755)
+	if err != nil {
+		return fmt.Errorf("Could not create required directories in webroot for HTTP challenge -> %v", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := os.Stat(challengeFile); os.IsNotExist(err) {
+		w.created[challengeFile] = true
+	}
+
+	err = ioutil.WriteFile(challengeFile, []byte(keyAuth), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write file in webroot for HTTP challenge -> %v", err)
+	}
+
+	return nil
+}
+
+// CleanUp removes the file created for the challenge. Files which already
+// existed before Present was called are left in place.
+func (w *HTTPProviderWebroot) CleanUp(domain, token, keyAuth string) error {
+	challengeFile := filepath.Join(w.path, filepath.FromSlash(HTTP01ChallengePath(token)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.created[challengeFile] {
+		return nil
+	}
+
+	err := os.Remove(challengeFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Could not remove file in webroot after HTTP challenge -> %v", err)
+	}
+	delete(w.created, challengeFile)
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package acme
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPProviderWebroot(t *testing.T) {
+	webroot, err := ioutil.TempDir("", "lego-webroot")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(webroot)
+
+	provider, err := NewHTTPProviderWebroot(webroot)
+	if err != nil {
+		t.Fatalf("Webroot provider error: got %v, want nil", err)
+	}
+
+	challengeFile := filepath.Join(webroot, ".well-known", "acme-challenge", "token")
+	if err := provider.Present("example.com", "token", "keyAuth"); err != nil {
+		t.Fatalf("Present error: got %v, want nil", err)
+	}
+
+	data, err := ioutil.ReadFile(challengeFile)
+	if err != nil {
+		t.Fatalf("Could not read challenge file: %v", err)
+	}
+	if string(data) != "keyAuth" {
+		t.Errorf("Challenge file content: got %q, want %q", string(data), "keyAuth")
+	}
+
+	if err := provider.CleanUp("example.com", "token", "keyAuth"); err != nil {
+		t.Errorf("CleanUp error: got %v, want nil", err)
+	}
+	if _, err := os.Stat(challengeFile); !os.IsNotExist(err) {
+		t.Errorf("Expected challenge file to be removed, stat returned %v", err)
+	}
+}
+
+func TestHTTPProviderWebrootKeepsExistingFiles(t *testing.T) {
+	webroot, err := ioutil.TempDir("", "lego-webroot")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(webroot)
+
+	challengeFile := filepath.Join(webroot, ".well-known", "acme-challenge", "existing")
+	os.MkdirAll(filepath.Dir(challengeFile), 0755)
+	ioutil.WriteFile(challengeFile, []byte("old"), 0644)
+
+	provider, _ := NewHTTPProviderWebroot(webroot)
+	if err := provider.Present("example.com", "existing", "keyAuth"); err != nil {
+		t.Fatalf("Present error: got %v, want nil", err)
+	}
+	if err := provider.CleanUp("example.com", "existing", "keyAuth"); err != nil {
+		t.Errorf("CleanUp error: got %v, want nil", err)
+	}
+	if _, err := os.Stat(challengeFile); err != nil {
+		t.Errorf("Expected pre-existing file to be kept, stat returned %v", err)
+	}
+
+	// Cleaning up a token which was never presented is a no-op.
+	if err := provider.CleanUp("example.com", "unknown", "keyAuth"); err != nil {
+		t.Errorf("CleanUp error: got %v, want nil", err)
+	}
+}
+
+func TestHTTPProviderWebrootMissingPath(t *testing.T) {
+	if _, err := NewHTTPProviderWebroot(""); err == nil {
+		t.Errorf("Webroot provider error: got nil, want error")
+	}
+}
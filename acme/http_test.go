@@ -1,10 +1,13 @@
 package acme
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestHTTPHeadUserAgent(t *testing.T) {
@@ -23,8 +26,8 @@ func TestHTTPHeadUserAgent(t *testing.T) {
 	if method != "HEAD" {
 		t.Errorf("Expected method to be HEAD, got %s", method)
 	}
-	if !strings.Contains(ua, ourUserAgent) {
-		t.Errorf("Expected User-Agent to contain '%s', got: '%s'", ourUserAgent, ua)
+	if !strings.HasPrefix(ua, "lego/"+Version) {
+		t.Errorf("Expected User-Agent to start with 'lego/%s', got: '%s'", Version, ua)
 	}
 }
 
@@ -45,8 +48,8 @@ func TestHTTPGetUserAgent(t *testing.T) {
 	if method != "GET" {
 		t.Errorf("Expected method to be GET, got %s", method)
 	}
-	if !strings.Contains(ua, ourUserAgent) {
-		t.Errorf("Expected User-Agent to contain '%s', got: '%s'", ourUserAgent, ua)
+	if !strings.HasPrefix(ua, "lego/"+Version) {
+		t.Errorf("Expected User-Agent to start with 'lego/%s', got: '%s'", Version, ua)
 	}
 }
 
@@ -67,34 +70,84 @@ func TestHTTPPostUserAgent(t *testing.T) {
 	if method != "POST" {
 		t.Errorf("Expected method to be POST, got %s", method)
 	}
-	if !strings.Contains(ua, ourUserAgent) {
-		t.Errorf("Expected User-Agent to contain '%s', got: '%s'", ourUserAgent, ua)
+	if !strings.HasPrefix(ua, "lego/"+Version) {
+		t.Errorf("Expected User-Agent to start with 'lego/%s', got: '%s'", Version, ua)
 	}
 }
 
 func TestUserAgent(t *testing.T) {
-	ua := userAgent()
+	defer func(ua string) { UserAgent = ua }(UserAgent)
+	UserAgent = ""
 
-	if !strings.Contains(ua, defaultGoUserAgent) {
-		t.Errorf("Expected UA to contain %s, got '%s'", defaultGoUserAgent, ua)
-	}
-	if !strings.Contains(ua, ourUserAgent) {
-		t.Errorf("Expected UA to contain %s, got '%s'", ourUserAgent, ua)
-	}
-	if strings.HasSuffix(ua, " ") {
-		t.Errorf("UA should not have trailing spaces; got '%s'", ua)
+	ua := userAgent()
+	if want := "lego/" + Version + " (+https://github.com/saltsa/lego)"; ua != want {
+		t.Errorf("Expected UA to be '%s', got '%s'", want, ua)
 	}
 
 	// customize the UA by appending a value
 	UserAgent = "MyApp/1.2.3"
 	ua = userAgent()
-	if !strings.Contains(ua, defaultGoUserAgent) {
-		t.Errorf("Expected UA to contain %s, got '%s'", defaultGoUserAgent, ua)
-	}
-	if !strings.Contains(ua, ourUserAgent) {
-		t.Errorf("Expected UA to contain %s, got '%s'", ourUserAgent, ua)
+	if !strings.HasPrefix(ua, "lego/"+Version+" ") {
+		t.Errorf("Expected UA to start with lego/%s, got '%s'", Version, ua)
 	}
 	if !strings.Contains(ua, UserAgent) {
 		t.Errorf("Expected custom UA to contain %s, got '%s'", UserAgent, ua)
 	}
 }
+
+func TestSetUserAgentProviderRequests(t *testing.T) {
+	defer func(ua string, comments []string) {
+		UserAgent, userAgentComments = ua, comments
+	}(UserAgent, userAgentComments)
+	UserAgent, userAgentComments = "", nil
+
+	var ua string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+		w.Write([]byte(`{"records": []}`))
+	}))
+	defer ts.Close()
+
+	provider := &DNSProviderVultr{apiKey: "123", baseURL: ts.URL}
+	if _, err := provider.doRequest("GET", ts.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "lego/" + Version + " (+https://github.com/saltsa/lego)"; ua != want {
+		t.Errorf("Expected the default UA '%s', got '%s'", want, ua)
+	}
+
+	SetUserAgent("MyApp/1.2.3")
+	AddUserAgentComment("+https://example.com/bot")
+	AddUserAgentComment(" ")
+	if _, err := provider.doRequest("GET", ts.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "lego/" + Version + " (+https://github.com/saltsa/lego) MyApp/1.2.3 (+https://example.com/bot)"; ua != want {
+		t.Errorf("Expected the UA '%s', got '%s'", want, ua)
+	}
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	transport := &http.Transport{ResponseHeaderTimeout: 5 * time.Second}
+	client := &http.Client{Transport: transport, Timeout: time.Minute}
+
+	pool := x509.NewCertPool()
+	got := withTLSConfig(client, func(config *tls.Config) { config.RootCAs = pool })
+
+	if got.Timeout != time.Minute {
+		t.Errorf("Expected the timeout of the client to be kept but got %v", got.Timeout)
+	}
+	gotTransport, ok := got.Transport.(*http.Transport)
+	if !ok || gotTransport == transport {
+		t.Fatalf("Expected a copy of the transport but got %#v", got.Transport)
+	}
+	if gotTransport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("Expected the settings of the transport to be kept but got %v", gotTransport.ResponseHeaderTimeout)
+	}
+	if gotTransport.TLSClientConfig.RootCAs != pool {
+		t.Error("Expected the pool to be set")
+	}
+	if transport.TLSClientConfig != nil && transport.TLSClientConfig.RootCAs != nil {
+		t.Error("Expected the original transport to be unchanged")
+	}
+}
@@ -3,17 +3,94 @@ package acme
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/hmac"
 	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/square/go-jose"
 )
 
+// nonceFetchAttempts is how often a nonce is requested from a server which
+// rate limits nonce requests before giving up.
+const nonceFetchAttempts = 3
+
+// nonceRetryInterval is the first wait before requesting a nonce again from
+// a server which rate limits nonce requests and sends no Retry-After.
+var nonceRetryInterval = time.Second
+
+// defaultNoncePoolSize is how many unused nonces are kept by default.
+const defaultNoncePoolSize = 16
+
 type jws struct {
 	directoryURL string
-	privKey      *rsa.PrivateKey
-	nonces       []string
+	// nonceURL is the newNonce resource of RFC 8555 servers. Without it,
+	// nonces are fetched with HEAD requests to the directory.
+	nonceURL string
+	// privKey is the account key. Like client, it is guarded by mu, as a
+	// key rollover may replace it while requests are signed.
+	privKey *rsa.PrivateKey
+	// client sends all requests to the ACME server, http.DefaultClient if
+	// nil. It is guarded by mu, as it may be replaced while in use.
+	client *http.Client
+
+	// nonces holds the unused nonces of past responses, the most recent
+	// last. At most maxNonces are kept, defaultNoncePoolSize if zero.
+	mu        sync.Mutex
+	nonces    []string
+	maxNonces int
+	// postAsGet makes get fetch resources with signed POST requests with
+	// an empty payload, as required by RFC 8555, instead of plain GETs. It
+	// is guarded by mu, as get turns it on when a plain GET is refused.
+	postAsGet bool
+}
+
+// httpClient returns the client for requests to the ACME server.
+func (j *jws) httpClient() *http.Client {
+	if j == nil {
+		return http.DefaultClient
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.client == nil {
+		return http.DefaultClient
+	}
+	return j.client
+}
+
+// setHTTPClient replaces the client for requests to the ACME server with
+// the one returned by update for the current client.
+func (j *jws) setHTTPClient(update func(*http.Client) *http.Client) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	client := j.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	j.client = update(client)
+}
+
+// key returns the account key.
+func (j *jws) key() *rsa.PrivateKey {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.privKey
+}
+
+// setKey replaces the account key used to sign further requests.
+func (j *jws) setKey(key *rsa.PrivateKey) {
+	j.mu.Lock()
+	j.privKey = key
+	j.mu.Unlock()
 }
 
 func keyAsJWK(key interface{}) *jose.JsonWebKey {
@@ -28,26 +105,99 @@ func keyAsJWK(key interface{}) *jose.JsonWebKey {
 	}
 }
 
-// Posts a JWS signed message to the specified URL
+// Posts a JWS signed message to the specified URL. A request the server
+// rejects because of a bad nonce is signed again with a fresh nonce and
+// retried once, as servers expect clients to do.
 func (j *jws) post(url string, content []byte) (*http.Response, error) {
+	resp, err := j.postOnce(url, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if badNonce(resp) {
+		resp.Body.Close()
+		logf("[INFO] acme: Server rejected the nonce of the request to %s; retrying with a fresh nonce", url)
+		return j.postOnce(url, content)
+	}
+
+	return resp, nil
+}
+
+func (j *jws) postOnce(url string, content []byte) (*http.Response, error) {
 	signedContent, err := j.signContent(content)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := httpPost(url, "application/jose+json", bytes.NewBuffer([]byte(signedContent.FullSerialize())))
+	resp, err := httpPostWith(j.httpClient(), url, "application/jose+json", bytes.NewBuffer([]byte(signedContent.FullSerialize())))
 	if err != nil {
 		return nil, err
 	}
 
 	j.getNonceFromResponse(resp)
 
-	return resp, err
+	return resp, nil
+}
+
+// badNonce reports whether resp is a badNonce error. The body of any other
+// error response is left for the caller to read.
+func badNonce(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusBadRequest {
+		return false
+	}
+
+	body, err := ioutil.ReadAll(limitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	// ACME v1 servers use urn:acme:error:badNonce, RFC 8555 servers
+	// urn:ietf:params:acme:error:badNonce.
+	var problem RemoteError
+	return json.Unmarshal(body, &problem) == nil && strings.HasSuffix(problem.Type, ":error:badNonce")
+}
+
+// get fetches the resource at url, using POST-as-GET if j is set up for it.
+// Servers implementing RFC 8555 answer plain GETs of most resources with 405
+// Method Not Allowed. get then retries with POST-as-GET and keeps using it
+// for all later requests.
+func (j *jws) get(url string) (*http.Response, error) {
+	if j == nil {
+		return httpGetWith(j.httpClient(), url)
+	}
+	if !j.usePostAsGet() {
+		resp, err := httpGetWith(j.httpClient(), url)
+		if err != nil {
+			return nil, err
+		}
+		j.getNonceFromResponse(resp)
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			return resp, nil
+		}
+		resp.Body.Close()
+		logf("[INFO] acme: Server refused a plain GET of %s; switching to POST-as-GET", url)
+		j.setPostAsGet(true)
+	}
+	return j.post(url, []byte{})
+}
+
+func (j *jws) usePostAsGet() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.postAsGet
+}
+
+func (j *jws) setPostAsGet(enabled bool) {
+	j.mu.Lock()
+	j.postAsGet = enabled
+	j.mu.Unlock()
 }
 
 func (j *jws) signContent(content []byte) (*jose.JsonWebSignature, error) {
 	// TODO: support other algorithms - RS512
-	signer, err := jose.NewSigner(jose.RS256, j.privKey)
+	signer, err := jose.NewSigner(jose.RS256, j.key())
 	if err != nil {
 		return nil, err
 	}
@@ -60,34 +210,113 @@ func (j *jws) signContent(content []byte) (*jose.JsonWebSignature, error) {
 	return signed, nil
 }
 
+// signKeyChange signs the content with newKey and embeds newKey in the
+// signature. It does not use a nonce, as the result is meant to be the
+// payload of a request signed by the current account key.
+func signKeyChange(newKey *rsa.PrivateKey, content []byte) (*jose.JsonWebSignature, error) {
+	signer, err := jose.NewSigner(jose.RS256, newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.Sign(content)
+}
+
+// signEABContent creates the external account binding for the account key
+// of j. It is a JWS over the account's public JWK, MAC'ed with HS256 using
+// the key the CA issued for the key identifier kid.
+func (j *jws) signEABContent(url, kid string, hmacKey []byte) (*externalAccountBinding, error) {
+	jwk, err := json.Marshal(keyAsJWK(&j.key().PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	protected, err := json.Marshal(map[string]string{"alg": "HS256", "kid": kid, "url": url})
+	if err != nil {
+		return nil, err
+	}
+
+	eab := &externalAccountBinding{
+		Protected: base64.RawURLEncoding.EncodeToString(protected),
+		Payload:   base64.RawURLEncoding.EncodeToString(jwk),
+	}
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write([]byte(eab.Protected + "." + eab.Payload))
+	eab.Signature = base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return eab, nil
+}
+
 func (j *jws) getNonceFromResponse(resp *http.Response) error {
 	nonce := resp.Header.Get("Replay-Nonce")
 	if nonce == "" {
 		return fmt.Errorf("Server did not respond with a proper nonce header.")
 	}
 
+	j.mu.Lock()
 	j.nonces = append(j.nonces, nonce)
+	max := j.maxNonces
+	if max <= 0 {
+		max = defaultNoncePoolSize
+	}
+	// Drop the oldest nonces, which are the most likely to have expired.
+	if n := len(j.nonces); n > max {
+		j.nonces = append(j.nonces[:0], j.nonces[n-max:]...)
+	}
+	j.mu.Unlock()
 	return nil
 }
 
-func (j *jws) getNonce() error {
-	resp, err := httpHead(j.directoryURL)
-	if err != nil {
-		return err
+// getNonce requests a fresh nonce from the server. If the server rate limits
+// nonce requests, it backs off and tries again.
+func (j *jws) getNonce() (string, error) {
+	url := j.nonceURL
+	if url == "" {
+		url = j.directoryURL
 	}
 
-	return j.getNonceFromResponse(resp)
+	interval := nonceRetryInterval
+	for attempt := 1; ; attempt++ {
+		resp, err := httpHeadWith(j.httpClient(), url)
+		if err != nil {
+			return "", err
+		}
+
+		limited := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if !limited {
+			nonce := resp.Header.Get("Replay-Nonce")
+			if nonce == "" {
+				return "", fmt.Errorf("Server did not respond with a proper nonce header.")
+			}
+			return nonce, nil
+		}
+		if attempt == nonceFetchAttempts {
+			return "", fmt.Errorf("acme: Could not get a nonce, the server responded with HTTP status %d", resp.StatusCode)
+		}
+
+		wait := interval
+		if ra, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(ra) * time.Second
+		} else {
+			interval *= 2
+		}
+		logf("[INFO] acme: Server rate limits nonce requests; retrying after %s", wait)
+		time.Sleep(wait)
+	}
 }
 
+// Nonce hands out the most recent unused nonce of a past response. Only when
+// there is none is a new one requested from the server.
 func (j *jws) Nonce() (string, error) {
-	nonce := ""
-	if len(j.nonces) == 0 {
-		err := j.getNonce()
-		if err != nil {
-			return nonce, err
-		}
+	j.mu.Lock()
+	if n := len(j.nonces); n > 0 {
+		nonce := j.nonces[n-1]
+		j.nonces = j.nonces[:n-1]
+		j.mu.Unlock()
+		return nonce, nil
 	}
+	j.mu.Unlock()
 
-	nonce, j.nonces = j.nonces[len(j.nonces)-1], j.nonces[:len(j.nonces)-1]
-	return nonce, nil
+	return j.getNonce()
 }
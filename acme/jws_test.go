@@ -0,0 +1,251 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/go-jose"
+)
+
+func TestJWSPostRetriesBadNonce(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var nonce, badNonces int32
+	var usedNonces []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", atomic.AddInt32(&nonce, 1)))
+		if r.Method != "POST" {
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		signed, err := jose.ParseSigned(string(body))
+		if err != nil {
+			t.Fatalf("Could not parse JWS: %v", err)
+		}
+		usedNonces = append(usedNonces, signed.Signatures[0].Header.Nonce)
+
+		if atomic.LoadInt32(&badNonces) > 0 {
+			atomic.AddInt32(&badNonces, -1)
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSONResponse(w, RemoteError{Type: "urn:ietf:params:acme:error:badNonce", Detail: "JWS has an invalid anti-replay nonce"})
+			return
+		}
+		writeJSONResponse(w, map[string]string{"status": "ok"})
+	}))
+	defer ts.Close()
+
+	j := &jws{privKey: key, directoryURL: ts.URL}
+
+	// A single badNonce is retried without the caller noticing.
+	atomic.StoreInt32(&badNonces, 1)
+	var resp map[string]string
+	if _, err := postJSON(j, ts.URL, map[string]string{}, &resp); err != nil {
+		t.Fatalf("postJSON error: got %v, want nil", err)
+	}
+	if resp["status"] != "ok" {
+		t.Errorf("Expected the response of the retried request but got %v", resp)
+	}
+	if len(usedNonces) != 2 || usedNonces[0] == usedNonces[1] {
+		t.Errorf("Expected the request to be retried with a fresh nonce, got nonces %v", usedNonces)
+	}
+
+	// The request is retried only once.
+	usedNonces = nil
+	atomic.StoreInt32(&badNonces, 2)
+	_, err = postJSON(j, ts.URL, map[string]string{}, nil)
+	if remoteErr, ok := err.(RemoteError); !ok || !strings.HasSuffix(remoteErr.Type, "badNonce") {
+		t.Errorf("Expected the second badNonce error to be returned, got %v", err)
+	}
+	if len(usedNonces) != 2 {
+		t.Errorf("Expected exactly one retry but %d requests were made", len(usedNonces))
+	}
+}
+
+func TestJWSNonceBacksOffWhenRateLimited(t *testing.T) {
+	defer func(d time.Duration) { nonceRetryInterval = d }(nonceRetryInterval)
+	nonceRetryInterval = 10 * time.Millisecond
+
+	var heads int32
+	limitedHeads := int32(2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&heads, 1) <= atomic.LoadInt32(&limitedHeads) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Replay-Nonce", "12345")
+	}))
+	defer ts.Close()
+
+	j := &jws{directoryURL: ts.URL}
+	nonce, err := j.Nonce()
+	if err != nil {
+		t.Fatalf("Nonce error: got %v, want nil", err)
+	}
+	if nonce != "12345" || atomic.LoadInt32(&heads) != 3 {
+		t.Errorf("Expected the nonce after 3 requests, got %q after %d", nonce, heads)
+	}
+
+	atomic.StoreInt32(&heads, 0)
+	atomic.StoreInt32(&limitedHeads, nonceFetchAttempts)
+	if _, err := j.Nonce(); err == nil {
+		t.Error("Expected an error if the server keeps rate limiting nonce requests")
+	}
+	if got := atomic.LoadInt32(&heads); got != nonceFetchAttempts {
+		t.Errorf("Expected %d nonce requests but got %d", nonceFetchAttempts, got)
+	}
+}
+
+func TestJWSNoncePoolUnderConcurrency(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	var nonce, newNonces int32
+	var mu sync.Mutex
+	used := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", atomic.AddInt32(&nonce, 1)))
+		switch {
+		case r.URL.Path == "/new-nonce":
+			atomic.AddInt32(&newNonces, 1)
+		case r.Method == "HEAD":
+			t.Errorf("Expected nonces to be fetched from the newNonce URL")
+		case r.Method == "POST":
+			body, _ := ioutil.ReadAll(r.Body)
+			signed, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Fatalf("Could not parse JWS: %v", err)
+			}
+			n := signed.Signatures[0].Header.Nonce
+			mu.Lock()
+			if used[n] {
+				t.Errorf("Nonce %s was used twice", n)
+			}
+			used[n] = true
+			mu.Unlock()
+			writeJSONResponse(w, map[string]string{"status": "ok"})
+		}
+	}))
+	defer ts.Close()
+
+	j := &jws{privKey: key, directoryURL: ts.URL, nonceURL: ts.URL + "/new-nonce"}
+
+	const workers, requests = 8, 10
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < requests; k++ {
+				if _, err := postJSON(j, ts.URL+"/post", map[string]string{}, nil); err != nil {
+					t.Errorf("postJSON error: got %v, want nil", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every response carries the nonce for the next request, so at most one
+	// nonce per concurrent worker has to be fetched.
+	if got := atomic.LoadInt32(&newNonces); got > workers {
+		t.Errorf("Expected at most %d newNonce requests for %d signed requests but got %d", workers, workers*requests, got)
+	}
+	if len(used) != workers*requests {
+		t.Errorf("Expected %d signed requests but the server saw %d", workers*requests, len(used))
+	}
+}
+
+func TestJWSSetKeyWhileSigning(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+
+	const workers, signatures = 4, 10
+	j := &jws{privKey: oldKey, maxNonces: workers * signatures}
+	for i := 0; i < workers*signatures; i++ {
+		j.getNonceFromResponse(&http.Response{Header: http.Header{"Replay-Nonce": {fmt.Sprintf("nonce-%d", i)}}})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < signatures; k++ {
+				signed, err := j.signContent([]byte("{}"))
+				if err != nil {
+					t.Errorf("signContent error: got %v, want nil", err)
+					continue
+				}
+				if _, err := signed.Verify(&oldKey.PublicKey); err != nil {
+					if _, err := signed.Verify(&newKey.PublicKey); err != nil {
+						t.Errorf("Expected the content to be signed by the old or the new key")
+					}
+				}
+			}
+		}()
+	}
+	j.setKey(newKey)
+	wg.Wait()
+
+	if j.key() != newKey {
+		t.Errorf("Expected the new key after setKey")
+	}
+}
+
+func TestJWSNoncePoolSize(t *testing.T) {
+	j := &jws{maxNonces: 3}
+	for i := 0; i < 5; i++ {
+		resp := &http.Response{Header: http.Header{"Replay-Nonce": {fmt.Sprintf("nonce-%d", i)}}}
+		j.getNonceFromResponse(resp)
+	}
+
+	// The most recent nonces are kept and handed out first.
+	for _, expected := range []string{"nonce-4", "nonce-3", "nonce-2"} {
+		nonce, err := j.Nonce()
+		if err != nil || nonce != expected {
+			t.Errorf("Nonce: got %q, %v, want %q", nonce, err, expected)
+		}
+	}
+	if len(j.nonces) != 0 {
+		t.Errorf("Expected the pool to be empty but it holds %v", j.nonces)
+	}
+}
+
+func TestJWSGetStoresNonce(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "from-get")
+		writeJSONResponse(w, map[string]string{"status": "ok"})
+	}))
+	defer ts.Close()
+
+	j := &jws{directoryURL: ts.URL}
+	resp, err := j.get(ts.URL)
+	if err != nil {
+		t.Fatalf("get error: got %v, want nil", err)
+	}
+	resp.Body.Close()
+
+	if len(j.nonces) != 1 || j.nonces[0] != "from-get" {
+		t.Errorf("Expected the nonce of the GET response to be pooled but got %v", j.nonces)
+	}
+}
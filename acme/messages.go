@@ -11,6 +11,39 @@ type directory struct {
 	NewCertURL    string `json:"new-cert"`
 	NewRegURL     string `json:"new-reg"`
 	RevokeCertURL string `json:"revoke-cert"`
+	KeyChangeURL  string `json:"key-change"`
+	// NewNonceURL is only present in directories of RFC 8555 servers.
+	NewNonceURL string        `json:"newNonce"`
+	Meta        directoryMeta `json:"meta"`
+}
+
+type directoryMeta struct {
+	// IdentifierTypes lists the identifier types the CA issues for, if it
+	// advertises them. CAs that don't are assumed to only support "dns".
+	IdentifierTypes []string `json:"identifierTypes"`
+}
+
+// supportsIdentifier reports whether the CA advertises the identifier type typ.
+func (d directory) supportsIdentifier(typ string) bool {
+	if len(d.Meta.IdentifierTypes) == 0 {
+		return typ == "dns"
+	}
+	for _, t := range d.Meta.IdentifierTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+type deactivationMessage struct {
+	Resource string `json:"resource"`
+	Status   string `json:"status"`
+}
+
+// accountQueryMessage fetches a registration without changing it.
+type accountQueryMessage struct {
+	Resource string `json:"resource"`
 }
 
 type recoveryKeyMessage struct {
@@ -23,6 +56,15 @@ type registrationMessage struct {
 	Resource string   `json:"resource"`
 	Contact  []string `json:"contact"`
 	//	RecoveryKey recoveryKeyMessage `json:"recoveryKey,omitempty"`
+	ExternalAccountBinding *externalAccountBinding `json:"externalAccountBinding,omitempty"`
+}
+
+// externalAccountBinding is a flattened JWS binding the account key
+// to an account the user holds with the CA outside of ACME.
+type externalAccountBinding struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
 }
 
 // Registration is returned by the ACME server after the registration
@@ -39,6 +81,7 @@ type Registration struct {
 	Agreement      string   `json:"agreement,omitempty"`
 	Authorizations string   `json:"authorizations,omitempty"`
 	Certificates   string   `json:"certificates,omitempty"`
+	Status         string   `json:"status,omitempty"`
 	//	RecoveryKey    recoveryKeyMessage `json:"recoveryKey,omitempty"`
 }
 
@@ -97,22 +140,33 @@ type csrMessage struct {
 	Resource       string   `json:"resource,omitempty"`
 	Csr            string   `json:"csr"`
 	Authorizations []string `json:"authorizations"`
+	NotBefore      string   `json:"notBefore,omitempty"`
+	NotAfter       string   `json:"notAfter,omitempty"`
+}
+
+type keyChangeMessage struct {
+	Resource string          `json:"resource"`
+	Account  string          `json:"account"`
+	NewKey   jose.JsonWebKey `json:"newKey"`
 }
 
 type revokeCertMessage struct {
 	Resource    string `json:"resource"`
 	Certificate string `json:"certificate"`
+	Reason      int    `json:"reason,omitempty"`
 }
 
 // CertificateResource represents a CA issued certificate.
-// PrivateKey and Certificate are both already PEM encoded
-// and can be directly written to disk. Certificate may
+// PrivateKey, Certificate and IssuerCertificate are all already
+// PEM encoded and can be directly written to disk. Certificate may
 // be a certificate bundle, depending on the options supplied
-// to create it.
+// to create it. IssuerCertificate always holds only the issuer
+// chain, without the issued certificate.
 type CertificateResource struct {
-	Domain        string `json:"domain"`
-	CertURL       string `json:"certUrl"`
-	CertStableURL string `json:"certStableUrl"`
-	PrivateKey    []byte `json:"-"`
-	Certificate   []byte `json:"-"`
+	Domain            string `json:"domain"`
+	CertURL           string `json:"certUrl"`
+	CertStableURL     string `json:"certStableUrl"`
+	PrivateKey        []byte `json:"-"`
+	Certificate       []byte `json:"-"`
+	IssuerCertificate []byte `json:"-"`
 }
@@ -0,0 +1,112 @@
+package acme
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CAConfig describes one of the CAs a MultiCAClient obtains certificates
+// from.
+type CAConfig struct {
+	// DirectoryURL is the URL of the ACME directory of the CA.
+	DirectoryURL string
+	// User is the account used at this CA.
+	User User
+	// KeyBits is the size of the private keys generated for certificates.
+	KeyBits int
+	// Options configure the client for this CA, e.g. WithCACertificates
+	// for an internal CA.
+	Options []ClientOption
+	// Setup, if set, is called with the client for this CA before it is
+	// used, e.g. to set challenge providers or to register the account.
+	Setup func(c *Client) error
+}
+
+// MultiCAClient obtains certificates from the first of several ACME CAs
+// that is able to issue them. A CA is skipped if it is unavailable or rate
+// limits the request, i.e. responds with HTTP status 503 or 429. Any other
+// failure, like a failed domain validation, is returned right away, as the
+// next CA would most likely fail the same way.
+type MultiCAClient struct {
+	cas []CAConfig
+}
+
+// NewMultiCAClient creates a MultiCAClient trying the CAs in the given order.
+// The client of a CA is only created once a certificate is requested from it.
+func NewMultiCAClient(cas []CAConfig) (*MultiCAClient, error) {
+	if len(cas) == 0 {
+		return nil, errors.New("no CAs configured")
+	}
+	return &MultiCAClient{cas: cas}, nil
+}
+
+// ObtainCertificate obtains a certificate for domains like
+// Client.ObtainCertificate, trying each CA in turn. If all CAs fail, the
+// returned error lists the failure of each of them.
+func (m *MultiCAClient) ObtainCertificate(domains []string, bundle bool, privKey crypto.PrivateKey) (CertificateResource, error) {
+	var msgs []string
+	for _, ca := range m.cas {
+		cert, err := m.obtain(ca, domains, bundle, privKey)
+		if err == nil {
+			return cert, nil
+		}
+		if !caUnavailable(err) {
+			return CertificateResource{}, err
+		}
+
+		logf("[INFO][%s] acme: CA at %s is unavailable, trying the next one: %v", strings.Join(domains, ", "), ca.DirectoryURL, err)
+		msgs = append(msgs, fmt.Sprintf("[%s] %v", ca.DirectoryURL, err))
+	}
+
+	return CertificateResource{}, fmt.Errorf("Could not obtain certificate from any CA:\n%s", strings.Join(msgs, "\n"))
+}
+
+func (m *MultiCAClient) obtain(ca CAConfig, domains []string, bundle bool, privKey crypto.PrivateKey) (CertificateResource, error) {
+	client, err := NewClient(ca.DirectoryURL, ca.User, ca.KeyBits, ca.Options...)
+	if err != nil {
+		return CertificateResource{}, err
+	}
+
+	if ca.Setup != nil {
+		if err := ca.Setup(client); err != nil {
+			return CertificateResource{}, err
+		}
+	}
+
+	cert, failures := client.ObtainCertificate(domains, bundle, privKey)
+	if len(failures) > 0 {
+		return CertificateResource{}, obtainFailures(failures)
+	}
+	return cert, nil
+}
+
+// obtainFailures is the error for the failures of an issuance at one CA.
+type obtainFailures map[string]error
+
+func (f obtainFailures) Error() string {
+	return obtainError(f).Error()
+}
+
+// caUnavailable reports whether err means the CA could not handle the
+// request at this time, rather than that it refused it.
+func caUnavailable(err error) bool {
+	switch e := err.(type) {
+	case obtainFailures:
+		// Only skip the CA if every domain failed this way; anything else
+		// points at a problem with the request.
+		for _, err := range e {
+			if !caUnavailable(err) {
+				return false
+			}
+		}
+		return len(e) > 0
+	case directoryError:
+		return caUnavailable(e.err)
+	case RemoteError:
+		return e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
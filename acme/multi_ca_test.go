@@ -0,0 +1,190 @@
+package acme
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/go-jose"
+)
+
+// newFakeCA starts an ACME server whose authorizations are valid right away
+// and which issues cert for every request.
+func newFakeCA(t *testing.T, key *rsa.PrivateKey, cert []byte) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/directory":
+			writeJSONResponse(w, directory{
+				NewAuthzURL:   ts.URL + "/new-authz",
+				NewCertURL:    ts.URL + "/new-cert",
+				NewRegURL:     ts.URL + "/new-reg",
+				RevokeCertURL: ts.URL + "/revoke-cert",
+			})
+		case r.Method == "POST" && r.URL.Path == "/new-authz":
+			body, _ := ioutil.ReadAll(r.Body)
+			signed, err := jose.ParseSigned(string(body))
+			if err != nil {
+				t.Fatalf("Could not parse JWS: %v", err)
+			}
+			payload, _ := signed.Verify(&key.PublicKey)
+			var msg authorization
+			json.Unmarshal(payload, &msg)
+
+			w.Header().Set("Link", "<"+ts.URL+"/new-cert>;rel=\"next\"")
+			w.Header().Set("Location", ts.URL+"/authz/"+msg.Identifier.Value)
+			writeJSONResponse(w, authorization{Identifier: msg.Identifier, Status: "valid"})
+		case r.Method == "POST" && r.URL.Path == "/new-cert":
+			w.Header().Set("Location", ts.URL+"/cert/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(cert)
+		}
+	}))
+	return ts
+}
+
+func newMultiCATestKeyAndCert(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal("Could not generate test key:", err)
+	}
+	certDER, err := generateDerCert(key, time.Now().Add(time.Hour), "example.com")
+	if err != nil {
+		t.Fatal("Could not generate test certificate:", err)
+	}
+	return key, pemEncode(derCertificateBytes(certDER))
+}
+
+func TestMultiCAClientFailover(t *testing.T) {
+	key, cert := newMultiCATestKeyAndCert(t)
+
+	var downCalls int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downCalls, 1)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	up := newFakeCA(t, key, cert)
+	defer up.Close()
+
+	user := mockUser{regres: &RegistrationResource{NewAuthzURL: up.URL + "/new-authz"}, privatekey: key}
+	var setUp []string
+	client, err := NewMultiCAClient([]CAConfig{
+		{DirectoryURL: down.URL + "/directory", User: user, KeyBits: 512},
+		{DirectoryURL: up.URL + "/directory", User: user, KeyBits: 512, Setup: func(c *Client) error {
+			setUp = append(setUp, c.jws.directoryURL)
+			return nil
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewMultiCAClient error: %v", err)
+	}
+
+	res, err := client.ObtainCertificate([]string{"example.com"}, false, key)
+	if err != nil {
+		t.Fatalf("ObtainCertificate error: got %v, want nil", err)
+	}
+	if string(res.Certificate) != string(cert) {
+		t.Errorf("Expected the certificate of the second CA")
+	}
+	if atomic.LoadInt32(&downCalls) == 0 {
+		t.Errorf("Expected the first CA to be tried")
+	}
+	if len(setUp) != 1 || setUp[0] != up.URL+"/directory" {
+		t.Errorf("Expected Setup to be called for the second CA only, got %v", setUp)
+	}
+}
+
+func TestMultiCAClientAllUnavailable(t *testing.T) {
+	key, _ := newMultiCATestKeyAndCert(t)
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		writeJSONResponse(w, RemoteError{Type: "urn:acme:error:rateLimited", Detail: "too many requests"})
+	}))
+	defer limited.Close()
+
+	user := mockUser{privatekey: key}
+	client, err := NewMultiCAClient([]CAConfig{
+		{DirectoryURL: down.URL, User: user, KeyBits: 512},
+		{DirectoryURL: limited.URL, User: user, KeyBits: 512},
+	})
+	if err != nil {
+		t.Fatalf("NewMultiCAClient error: %v", err)
+	}
+
+	_, err = client.ObtainCertificate([]string{"example.com"}, false, key)
+	if err == nil {
+		t.Fatal("Expected an error when all CAs are unavailable")
+	}
+	for _, want := range []string{down.URL, limited.URL, "too many requests"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestMultiCAClientValidationFailure(t *testing.T) {
+	key, _ := newMultiCATestKeyAndCert(t)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", "12345")
+		switch r.URL.Path {
+		case "/directory":
+			writeJSONResponse(w, directory{
+				NewAuthzURL:   ts.URL + "/new-authz",
+				NewCertURL:    ts.URL + "/new-cert",
+				NewRegURL:     ts.URL + "/new-reg",
+				RevokeCertURL: ts.URL + "/revoke-cert",
+			})
+		case "/new-authz":
+			w.WriteHeader(http.StatusForbidden)
+			writeJSONResponse(w, RemoteError{Type: "urn:acme:error:unauthorized", Detail: "domain is not allowed"})
+		}
+	}))
+	defer ts.Close()
+
+	var backupCalls int32
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupCalls, 1)
+	}))
+	defer backup.Close()
+
+	user := mockUser{regres: &RegistrationResource{NewAuthzURL: ts.URL + "/new-authz"}, privatekey: key}
+	client, err := NewMultiCAClient([]CAConfig{
+		{DirectoryURL: ts.URL + "/directory", User: user, KeyBits: 512},
+		{DirectoryURL: backup.URL + "/directory", User: user, KeyBits: 512},
+	})
+	if err != nil {
+		t.Fatalf("NewMultiCAClient error: %v", err)
+	}
+
+	_, err = client.ObtainCertificate([]string{"example.com"}, false, key)
+	if err == nil || !strings.Contains(err.Error(), "domain is not allowed") {
+		t.Errorf("Expected the validation error, got %v", err)
+	}
+	if atomic.LoadInt32(&backupCalls) != 0 {
+		t.Errorf("Expected the second CA not to be tried after a validation error")
+	}
+}
+
+func TestNewMultiCAClientNoCAs(t *testing.T) {
+	if _, err := NewMultiCAClient(nil); err == nil {
+		t.Error("Expected an error without CAs")
+	}
+}
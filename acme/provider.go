@@ -1,8 +1,261 @@
 package acme
 
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
 // ChallengeProvider presents the solution to a challenge available to be solved
 // CleanUp will be called by the challenge if Present ends in a non-error state.
 type ChallengeProvider interface {
 	Present(domain, token, keyAuth string) error
 	CleanUp(domain, token, keyAuth string) error
 }
+
+// ChallengeCleaner is implemented by DNS providers that can list the records
+// of a zone. CleanUpAll deletes every TXT record named _acme-challenge, or
+// below it, in zone. It is meant to reclaim records left behind by runs that
+// did not get to clean up and is never called automatically.
+type ChallengeCleaner interface {
+	CleanUpAll(zone string) error
+}
+
+// PrecheckDNSProvider is implemented by DNS providers that can verify their
+// configuration without changing any records. Precheck is never called
+// automatically; it lets callers find bad credentials once, up front,
+// instead of on every authorization. Rejected credentials are reported as
+// a *DNSProviderAuthError.
+type PrecheckDNSProvider interface {
+	ChallengeProvider
+	Precheck() error
+}
+
+// DNSProviderAuthError is returned by Precheck when the DNS provider's API
+// rejects the configured credentials.
+type DNSProviderAuthError struct {
+	Provider   string
+	StatusCode int
+	Detail     string
+}
+
+func (e *DNSProviderAuthError) Error() string {
+	return fmt.Sprintf("%s API rejected the credentials with HTTP status %d: %s", e.Provider, e.StatusCode, e.Detail)
+}
+
+// DNSChallengeRecord identifies the TXT record of one dns-01 challenge by the
+// arguments a ChallengeProvider gets for it.
+type DNSChallengeRecord struct {
+	Domain  string
+	Token   string
+	KeyAuth string
+}
+
+// BatchDNSProvider is implemented by DNS providers that can change several
+// records with a single API call. When the dns-01 provider implements it,
+// the records of all authorizations are presented in one PresentBatch call
+// and removed in one CleanUpBatch call, instead of one Present and CleanUp
+// call per record. The records may include several values for one name, as
+// for a domain and its wildcard.
+type BatchDNSProvider interface {
+	ChallengeProvider
+	PresentBatch(records []DNSChallengeRecord) error
+	CleanUpBatch(records []DNSChallengeRecord) error
+}
+
+// DNSProviderFactory creates a ChallengeProvider for the dns-01 challenge.
+// Factories read their configuration from the environment.
+type DNSProviderFactory func() (ChallengeProvider, error)
+
+var (
+	dnsProvidersMu sync.RWMutex
+	dnsProviders   = map[string]DNSProviderFactory{}
+)
+
+func init() {
+	RegisterDNSProvider("azure", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderAzure("", "", "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("cloudflare", newDNSProviderCloudflareFromEnv)
+	RegisterDNSProvider("cloudns", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderClouDNS("", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("desec", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderDesec("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("dnsimple", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderDNSimple("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("dreamhost", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderDreamhost("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("etcd", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderEtcd(nil, "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("exec", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderExec("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("gandi", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderGandi("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("gcloud", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderGoogleCloud("", nil)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("hetzner", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderHetzner("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("inwx", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderINWX("", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("linode", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderLinode("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("manual", func() (ChallengeProvider, error) {
+		return NewDNSProviderManual()
+	})
+	RegisterDNSProvider("namecom", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderNameCom("", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("namecheap", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderNamecheap("", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("ns1", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderNS1("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("ovh", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderOVH("", "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("pdns", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderPowerDNS("", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("porkbun", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderPorkbun("", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("rfc2136", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderRFC2136("", "", "", "", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("route53", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderRoute53("", "", "")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+	RegisterDNSProvider("vultr", func() (ChallengeProvider, error) {
+		p, err := NewDNSProviderVultr("")
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+}
+
+// RegisterDNSProvider makes a DNS provider available under the given name.
+// Registering a name twice replaces the earlier factory.
+func RegisterDNSProvider(name string, factory DNSProviderFactory) {
+	dnsProvidersMu.Lock()
+	defer dnsProvidersMu.Unlock()
+	dnsProviders[name] = factory
+}
+
+// NewDNSProviderByName creates the DNS provider registered under name,
+// configured from the environment.
+func NewDNSProviderByName(name string) (ChallengeProvider, error) {
+	dnsProvidersMu.RLock()
+	factory, ok := dnsProviders[name]
+	dnsProvidersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown DNS provider %q", name)
+	}
+
+	return factory()
+}
+
+// DNSProviderNames returns the sorted names of all registered DNS providers.
+func DNSProviderNames() []string {
+	dnsProvidersMu.RLock()
+	defer dnsProvidersMu.RUnlock()
+
+	names := make([]string, 0, len(dnsProviders))
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
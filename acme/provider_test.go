@@ -0,0 +1,48 @@
+package acme
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDNSProvider struct{}
+
+func (fakeDNSProvider) Present(domain, token, keyAuth string) error { return nil }
+func (fakeDNSProvider) CleanUp(domain, token, keyAuth string) error { return nil }
+
+func TestRegisterDNSProvider(t *testing.T) {
+	RegisterDNSProvider("fake", func() (ChallengeProvider, error) {
+		return fakeDNSProvider{}, nil
+	})
+	defer delete(dnsProviders, "fake")
+
+	provider, err := NewDNSProviderByName("fake")
+	assert.NoError(t, err)
+	assert.Equal(t, fakeDNSProvider{}, provider)
+	assert.Contains(t, DNSProviderNames(), "fake")
+}
+
+func TestNewDNSProviderByNameFactoryError(t *testing.T) {
+	RegisterDNSProvider("broken", func() (ChallengeProvider, error) {
+		return nil, errors.New("broken credentials missing")
+	})
+	defer delete(dnsProviders, "broken")
+
+	provider, err := NewDNSProviderByName("broken")
+	assert.EqualError(t, err, "broken credentials missing")
+	assert.Nil(t, provider)
+}
+
+func TestNewDNSProviderByNameUnknown(t *testing.T) {
+	_, err := NewDNSProviderByName("does-not-exist")
+	assert.EqualError(t, err, `Unknown DNS provider "does-not-exist"`)
+}
+
+func TestDNSProviderNamesBuiltin(t *testing.T) {
+	names := DNSProviderNames()
+	for _, name := range []string{"azure", "cloudflare", "cloudns", "desec", "dnsimple", "dreamhost", "etcd", "exec", "gandi", "gcloud", "hetzner", "inwx", "linode", "manual", "namecheap", "namecom", "ns1", "ovh", "pdns", "porkbun", "rfc2136", "route53", "vultr"} {
+		assert.Contains(t, names, name)
+	}
+}
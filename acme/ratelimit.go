@@ -0,0 +1,102 @@
+package acme
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// defaultRateLimiter allows 10 requests per second with bursts of up to 10
+// requests, which stays well below the limits of public ACME servers and the
+// APIs of the supported DNS providers.
+var defaultRateLimiter = NewRateLimiter(10, 10)
+
+var (
+	rateLimiterMu sync.RWMutex
+	// rateLimiter is shared by the ACME client and all DNS providers sending HTTP requests.
+	rateLimiter = defaultRateLimiter
+)
+
+// SetRateLimiter replaces the rate limiter shared by the ACME client and the
+// DNS providers. Passing nil disables rate limiting. It is safe to call while
+// requests are sent.
+func SetRateLimiter(rl *RateLimiter) {
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
+	rateLimiter = rl
+}
+
+// currentRateLimiter returns the shared rate limiter, nil if disabled.
+func currentRateLimiter() *RateLimiter {
+	rateLimiterMu.RLock()
+	defer rateLimiterMu.RUnlock()
+	return rateLimiter
+}
+
+// waitRateLimit blocks until the shared rate limiter allows another request.
+func waitRateLimit() {
+	if rl := currentRateLimiter(); rl != nil {
+		rl.Wait()
+	}
+}
+
+// RateLimiter is a token bucket which is safe for concurrent use. Callers
+// that have to wait are delayed by a small random jitter on top, so that
+// waiting goroutines do not all fire at the same instant.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter allowing rate requests per second on
+// average and bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// Wait blocks until a token is available and takes it.
+func (r *RateLimiter) Wait() {
+	r.mu.Lock()
+	now := r.now()
+	if !r.last.IsZero() {
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+	}
+	r.last = now
+
+	// Take the token right away, even if it is not there yet. The resulting
+	// debt makes later callers queue up behind this one.
+	r.tokens--
+	if r.tokens >= 0 || r.rate <= 0 {
+		r.mu.Unlock()
+		return
+	}
+	delay := time.Duration(-r.tokens / r.rate * float64(time.Second))
+	r.mu.Unlock()
+
+	r.sleep(delay + jitter(delay/10))
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,106 @@
+package acme
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFakeClockLimiter returns a RateLimiter whose sleeps advance a fake clock.
+func newFakeClockLimiter(rate float64, burst int) (*RateLimiter, *time.Time, *int) {
+	var mu sync.Mutex
+	now := time.Unix(0, 0)
+	sleeps := 0
+
+	rl := NewRateLimiter(rate, burst)
+	rl.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	rl.sleep = func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+		sleeps++
+	}
+	return rl, &now, &sleeps
+}
+
+func TestRateLimiterAllowsBurst(t *testing.T) {
+	rl, _, sleeps := newFakeClockLimiter(1, 5)
+
+	for i := 0; i < 5; i++ {
+		rl.Wait()
+	}
+	if *sleeps != 0 {
+		t.Errorf("Expected a burst of 5 to pass without waiting, waited %d times", *sleeps)
+	}
+}
+
+func TestRateLimiterThrottlesToRate(t *testing.T) {
+	rl, now, sleeps := newFakeClockLimiter(2, 2)
+	start := *now
+
+	for i := 0; i < 12; i++ {
+		rl.Wait()
+	}
+
+	// The first two requests use up the burst, the remaining ten are
+	// limited to two per second plus up to 10% jitter.
+	elapsed := now.Sub(start)
+	if elapsed < 5*time.Second || elapsed > 5500*time.Millisecond {
+		t.Errorf("Expected 12 requests at 2/s to take about 5s, took %v", elapsed)
+	}
+	if *sleeps != 10 {
+		t.Errorf("Expected 10 throttled requests, got %d", *sleeps)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	rl, now, sleeps := newFakeClockLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		rl.Wait()
+	}
+	*now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		rl.Wait()
+	}
+	if *sleeps != 0 {
+		t.Errorf("Expected the bucket to refill up to its burst size, waited %d times", *sleeps)
+	}
+}
+
+func TestSetRateLimiter(t *testing.T) {
+	defer SetRateLimiter(defaultRateLimiter)
+
+	rl, _, sleeps := newFakeClockLimiter(1, 1)
+	SetRateLimiter(rl)
+	waitRateLimit()
+	waitRateLimit()
+	if *sleeps != 1 {
+		t.Errorf("Expected the shared limiter to be used, waited %d times", *sleeps)
+	}
+
+	SetRateLimiter(nil)
+	waitRateLimit()
+}
+
+func TestSetRateLimiterConcurrent(t *testing.T) {
+	defer SetRateLimiter(defaultRateLimiter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetRateLimiter(NewRateLimiter(1000, 1000))
+		}()
+		go func() {
+			defer wg.Done()
+			waitRateLimit()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+package acme
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// TLSALPNProviderServer implements ChallengeProvider for `tls-alpn-01`
+// challenge. It may be instantiated without using the
+// NewTLSALPNProviderServer function if you want only to use the default
+// values.
+type TLSALPNProviderServer struct {
+	iface    string
+	port     string
+	done     chan bool
+	listener net.Listener
+}
+
+// NewTLSALPNProviderServer creates a new TLSALPNProviderServer on the selected
+// interface and port. Setting iface and / or port to an empty string will make
+// the server fall back to the "any" interface and port 443 respectively.
+func NewTLSALPNProviderServer(iface, port string) *TLSALPNProviderServer {
+	return &TLSALPNProviderServer{iface: iface, port: port}
+}
+
+// Present starts a TLS server which presents the challenge certificate for
+// domain to clients negotiating the `acme-tls/1` protocol.
+func (s *TLSALPNProviderServer) Present(domain, token, keyAuth string) error {
+	if s.port == "" {
+		s.port = "443"
+	}
+
+	cert, err := TLSALPN01ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+
+	// A listener may already have been set up, e.g. bound to a random port in tests.
+	if s.listener == nil {
+		s.listener, err = net.Listen("tcp", net.JoinHostPort(s.iface, s.port))
+		if err != nil {
+			return fmt.Errorf("Could not start HTTPS server for challenge -> %v", err)
+		}
+	}
+
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		// Only acme-tls/1 is offered, so that clients not asking for it
+		// fail the handshake instead of getting the challenge certificate.
+		NextProtos: []string{ACMETLS1Protocol},
+	}
+	listener := tls.NewListener(s.listener, tlsConf)
+
+	s.done = make(chan bool)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				break
+			}
+			// The validation is over once the handshake is.
+			go func(conn net.Conn) {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}(conn)
+		}
+		s.done <- true
+	}()
+	return nil
+}
+
+// CleanUp stops the TLS server started by Present.
+func (s *TLSALPNProviderServer) CleanUp(domain, token, keyAuth string) error {
+	if s.listener == nil {
+		return nil
+	}
+	s.listener.Close()
+	<-s.done
+	s.listener = nil
+	return nil
+}
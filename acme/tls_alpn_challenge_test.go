@@ -0,0 +1,90 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/asn1"
+	"net"
+	"testing"
+)
+
+func TestTLSALPNChallenge(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	addr := listener.Addr().String()
+
+	privKey, _ := generatePrivateKey(rsakey, 512)
+	j := &jws{privKey: privKey.(*rsa.PrivateKey)}
+	clientChallenge := challenge{Type: TLSALPN01, Token: "tlsalpn1"}
+	mockValidate := func(_ *jws, _, _ string, chlng challenge) error {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{
+			ServerName:         "example.com",
+			NextProtos:         []string{ACMETLS1Protocol},
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatalf("Expected to connect to challenge server without an error. %s", err.Error())
+		}
+		defer conn.Close()
+
+		connState := conn.ConnectionState()
+		if connState.NegotiatedProtocol != ACMETLS1Protocol {
+			t.Errorf("Expected the challenge server to negotiate %s but got %q", ACMETLS1Protocol, connState.NegotiatedProtocol)
+		}
+
+		// Expect the server to only return one certificate
+		if count := len(connState.PeerCertificates); count != 1 {
+			t.Fatalf("Expected the challenge server to return exactly one certificate but got %d", count)
+		}
+
+		remoteCert := connState.PeerCertificates[0]
+		if len(remoteCert.DNSNames) != 1 || remoteCert.DNSNames[0] != "example.com" {
+			t.Errorf("Expected the challenge certificate to be for example.com only but was for %v", remoteCert.DNSNames)
+		}
+
+		var found bool
+		for _, ext := range remoteCert.Extensions {
+			if !ext.Id.Equal(idPeAcmeIdentifier) {
+				continue
+			}
+			found = true
+			if !ext.Critical {
+				t.Error("Expected the acmeIdentifier extension to be critical")
+			}
+
+			var value []byte
+			if _, err := asn1.Unmarshal(ext.Value, &value); err != nil {
+				t.Fatalf("Could not decode the acmeIdentifier extension: %v", err)
+			}
+			digest := sha256.Sum256([]byte(chlng.KeyAuthorization))
+			if !bytes.Equal(value, digest[:]) {
+				t.Errorf("Expected the acmeIdentifier extension to hold %x but was %x", digest[:], value)
+			}
+		}
+		if !found {
+			t.Error("Expected the challenge certificate to have an acmeIdentifier extension")
+		}
+
+		// Clients not asking for acme-tls/1 must not get the certificate.
+		plain, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+		if err == nil {
+			plain.Close()
+			t.Error("Expected the handshake without acme-tls/1 to fail")
+		}
+
+		return nil
+	}
+	solver := &tlsALPNChallenge{jws: j, validate: mockValidate, provider: &TLSALPNProviderServer{listener: listener}}
+
+	if err := solver.Solve(clientChallenge, "example.com"); err != nil {
+		t.Errorf("Solve error: got %v, want nil", err)
+	}
+
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected the challenge server to be stopped after CleanUp")
+	}
+}
@@ -28,14 +28,11 @@ func main() {
 	app.Name = "lego"
 	app.Usage = "Let's encrypt client to go!"
 
-	version := "0.2.0"
 	if strings.HasPrefix(gittag, "v") {
-		version = gittag
+		acme.Version = gittag
 	}
 
-	app.Version = version
-
-	acme.UserAgent = "lego/" + app.Version
+	app.Version = acme.Version
 
 	cwd, err := os.Getwd()
 	if err != nil {